@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"strings"
@@ -9,7 +10,7 @@ import (
 	"reddock/pkg/config"
 )
 
-func (c *Command) executeAddons() error {
+func (c *Command) executeAddons(ctx context.Context) error {
 	if len(c.Args) == 0 {
 		return c.showAddonsHelp()
 	}
@@ -21,7 +22,7 @@ func (c *Command) executeAddons() error {
 	case "list":
 		return c.executeAddonsList()
 	case "build":
-		return c.executeAddonsBuild(subArgs)
+		return c.executeAddonsBuild(ctx, subArgs)
 	case "prepare":
 		return c.executeAddonsPrepare(subArgs)
 	default:
@@ -72,7 +73,7 @@ func (c *Command) executeAddonsList() error {
 	return nil
 }
 
-func (c *Command) executeAddonsBuild(args []string) error {
+func (c *Command) executeAddonsBuild(ctx context.Context, args []string) error {
 	if len(args) < 3 {
 		return fmt.Errorf("Command invalid!\nUsage: reddock addons build <image-name> <android-version> <addon1> [addon2] ...\nFormat: Use NAMESPACE/REPOSITORY[:TAG] (Avoid HOST[:PORT]/ for local images)")
 	}
@@ -95,7 +96,7 @@ func (c *Command) executeAddonsBuild(args []string) error {
 	}
 
 	baseImage := fmt.Sprintf("redroid/redroid:%s-latest", version)
-	return manager.BuildCustomImage(baseImage, imageName, version, arch, addonNames)
+	return manager.BuildCustomImage(ctx, baseImage, imageName, version, arch, addonNames)
 }
 
 // executeAddonsPrepare prepares addon files without building an image
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"reddock/pkg/container"
+)
+
+// splitSelector extracts the selection flags and names, returning the other flags
+func splitSelector(args []string) ([]string, container.Selector, int, error) {
+	var rest []string
+	var sel container.Selector
+	parallel := 0
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		flag, value, inline := strings.Cut(arg, "=")
+		switch flag {
+		case "--all":
+			sel.All = true
+			continue
+		case "-l", "--label", "--parallel":
+			if !inline {
+				if i+1 >= len(args) {
+					return nil, sel, 0, fmt.Errorf("%s requires a value", flag)
+				}
+				i++
+				value = args[i]
+			}
+			if flag == "--parallel" {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					return nil, sel, 0, fmt.Errorf("Invalid --parallel '%s', expected a positive number", value)
+				}
+				parallel = n
+			} else {
+				sel.Labels = append(sel.Labels, value)
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+		} else {
+			sel.Names = append(sel.Names, arg)
+		}
+	}
+	return rest, sel, parallel, nil
+}
+
+func runBulk(ctx context.Context, sel container.Selector, parallel int, verb string, op container.BulkFunc) error {
+	bulk := container.NewBulk(parallel)
+	names, err := bulk.Select(sel)
+	if err != nil {
+		return err
+	}
+	return bulk.Run(ctx, names, verb, op)
+}
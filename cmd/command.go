@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"os"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"reddock/pkg/addons"
 	"reddock/pkg/config"
@@ -27,48 +32,123 @@ func CheckRoot() error {
 	return container.CheckRoot()
 }
 
-func (c *Command) Execute() error {
+// ParseGlobalFlags applies global options such as --runtime and returns the rest
+func ParseGlobalFlags(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--runtime":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--runtime requires a value (%s)", strings.Join(container.RuntimeNames(), ", "))
+			}
+			i++
+			if err := container.SetRuntimeOverride(args[i]); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(arg, "--runtime="):
+			if err := container.SetRuntimeOverride(strings.TrimPrefix(arg, "--runtime=")); err != nil {
+				return nil, err
+			}
+		case arg == "--host":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--host requires an endpoint (unix://, tcp:// or ssh://)")
+			}
+			i++
+			if err := container.SetHostOverride(args[i]); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(arg, "--host="):
+			if err := container.SetHostOverride(strings.TrimPrefix(arg, "--host=")); err != nil {
+				return nil, err
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, nil
+}
+
+// Execute runs the command, cancelling ctx aborts in-flight operations
+func (c *Command) Execute(ctx context.Context) error {
 	switch c.Name {
 	case "init":
-		return c.executeInit()
+		return c.executeInit(ctx)
 	case "start":
-		return c.executeStart()
+		return c.executeStart(ctx)
 	case "stop":
-		return c.executeStop()
+		return c.executeStop(ctx)
 	case "restart":
-		return c.executeRestart()
+		return c.executeRestart(ctx)
+	case "pause":
+		return c.executePause(ctx)
+	case "resume":
+		return c.executeResume(ctx)
 	case "status":
-		return c.executeStatus()
+		return c.executeStatus(ctx)
 	case "shell":
-		return c.executeShell()
+		return c.executeShell(ctx)
 	case "adb-connect":
-		return c.executeAdbConnect()
+		return c.executeAdbConnect(ctx)
+	case "port":
+		return c.executePort(ctx)
 	case "remove":
-		return c.executeRemove()
+		return c.executeRemove(ctx)
+	case "clone":
+		return c.executeClone(ctx)
+	case "rename":
+		return c.executeRename(ctx)
+	case "adopt":
+		return c.executeAdopt(ctx)
+	case "sync":
+		return c.executeSync(ctx)
+	case "plan":
+		return c.executePlan(ctx)
+	case "apply":
+		return c.executeApply(ctx)
 	case "list":
-		return c.executeList()
+		return c.executeList(ctx)
 	case "log":
-		return c.executeLog()
+		return c.executeLog(ctx)
+	case "events":
+		return c.executeEvents(ctx)
+	case "stats":
+		return c.executeStats(ctx)
+	case "wait":
+		return c.executeWait(ctx)
+	case "supervise":
+		return c.executeSupervise(ctx)
+	case "systemd":
+		return c.executeSystemd(ctx)
+	case "doctor":
+		return c.executeDoctor(ctx)
 	case "prune":
-		return c.executePrune()
+		return c.executePrune(ctx)
 	case "version":
 		return c.executeVersion()
 	case "dockerfile":
-		return c.executeDockerfile()
+		return c.executeDockerfile(ctx)
 	case "addons":
-		return c.executeAddons()
+		return c.executeAddons(ctx)
+	case "config":
+		return c.executeConfig(ctx)
 	default:
 		return fmt.Errorf("Unknown command: %s", c.Name)
 	}
 }
 
-func (c *Command) executeInit() error {
+func (c *Command) executeInit(ctx context.Context) error {
 	var containerName string
 	var image string
 	offerAddons := false
 
-	if len(c.Args) > 0 {
-		containerName = c.Args[0]
+	args, settings, err := splitSettingFlags(c.Args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 0 {
+		containerName = args[0]
 	} else {
 		fmt.Print("Enter container name: ")
 		_, err := fmt.Scanln(&containerName)
@@ -77,8 +157,8 @@ func (c *Command) executeInit() error {
 		}
 	}
 
-	if len(c.Args) > 1 {
-		image = c.Args[1]
+	if len(args) > 1 {
+		image = args[1]
 		if strings.HasPrefix(image, "redroid/redroid") {
 			offerAddons = true
 		}
@@ -231,7 +311,7 @@ func (c *Command) executeInit() error {
 
 				fmt.Printf("\nBuilding custom image '%s' with selected features...\n", customImageName)
 
-				if err := am.BuildCustomImage(image, customImageName, version, arch, selectedAddons); err != nil {
+				if err := am.BuildCustomImage(ctx, image, customImageName, version, arch, selectedAddons); err != nil {
 					return fmt.Errorf("Failed to build custom image: %v", err)
 				}
 				image = customImageName
@@ -240,76 +320,283 @@ func (c *Command) executeInit() error {
 	}
 
 	init := container.NewInitializer(containerName, image)
-	return init.Initialize()
+	if err := init.ApplySettings(settings); err != nil {
+		return err
+	}
+	return init.Initialize(ctx)
 }
 
-func (c *Command) executeStart() error {
-	var containerName string
+func (c *Command) executeStart(ctx context.Context) error {
 	verbose := false
+	wait := false
 
-	for _, arg := range c.Args {
-		if arg == "-v" || arg == "--verbose" {
+	args, timeout, err := splitTimeoutFlag(c.Args)
+	if err != nil {
+		return err
+	}
+	flags, sel, parallel, err := splitSelector(args)
+	if err != nil {
+		return err
+	}
+	usage := "Usage: reddock start <container-name>...|--all|-l <label> [-v] [--wait [--timeout <duration>]] [--parallel <n>]"
+	for _, arg := range flags {
+		switch arg {
+		case "-v", "--verbose":
 			verbose = true
-		} else if containerName == "" {
-			containerName = arg
+		case "--wait", "-w":
+			wait = true
+		default:
+			return fmt.Errorf("Unknown option '%s'. %s", arg, usage)
 		}
 	}
+	// A boot timeout only makes sense when waiting for the boot
+	if timeout > 0 {
+		wait = true
+	}
 
-	if containerName == "" {
-		return fmt.Errorf("Container name is required! Usage: reddock start <container-name> [-v]")
+	if sel.Empty() {
+		return fmt.Errorf("Container name is required! %s", usage)
+	}
+	if verbose && (len(sel.Names) != 1 || sel.All || len(sel.Labels) > 0) {
+		return fmt.Errorf("-v follows the logs of a single container")
 	}
 
-	mgr := container.NewManagerForContainer(containerName)
-	return mgr.Start(verbose)
+	return runBulk(ctx, sel, parallel, "start", func(ctx context.Context, store config.Store, name string) error {
+		mgr := container.NewManagerWith(store, nil, name)
+		if !wait {
+			return mgr.Start(ctx, verbose)
+		}
+		if err := mgr.Start(ctx, false); err != nil {
+			return err
+		}
+		if _, err := mgr.WaitForBoot(ctx, timeout); err != nil {
+			return err
+		}
+		if verbose {
+			return mgr.FollowLogs(ctx)
+		}
+		return nil
+	})
 }
 
-func (c *Command) executeStop() error {
-	var containerName string
+func (c *Command) executeWait(ctx context.Context) error {
+	args, timeout, err := splitTimeoutFlag(c.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("Container name is required! Usage: reddock wait <container-name> [--timeout <duration>]")
+	}
 
-	if len(c.Args) > 0 {
-		containerName = c.Args[0]
-	} else {
-		return fmt.Errorf("Container name is required! Usage: reddock stop <container-name>")
+	mgr := container.NewManagerForContainer(args[0])
+	_, err = mgr.WaitForBoot(ctx, timeout)
+	return err
+}
+
+func (c *Command) executeSupervise(ctx context.Context) error {
+	names, interval, err := splitDurationFlag(c.Args, "--interval")
+	if err != nil {
+		return err
+	}
+	supervisor := container.NewSupervisor(interval)
+	return supervisor.Run(ctx, names)
+}
+
+func (c *Command) executeSystemd(ctx context.Context) error {
+	usage := "Usage: reddock systemd generate <container-name>...|--all [--install]"
+	if len(c.Args) == 0 || c.Args[0] != "generate" {
+		return fmt.Errorf("Unknown systemd command. %s", usage)
 	}
 
-	mgr := container.NewManagerForContainer(containerName)
-	return mgr.Stop()
+	var names []string
+	all, install := false, false
+	for _, arg := range c.Args[1:] {
+		switch arg {
+		case "--all":
+			all = true
+		case "--install":
+			install = true
+		default:
+			names = append(names, arg)
+		}
+	}
+	if all == (len(names) > 0) {
+		return fmt.Errorf("Give container names or --all. %s", usage)
+	}
+
+	generator := container.NewSystemdGenerator()
+	units, err := generator.Units(names)
+	if err != nil {
+		return err
+	}
+	if install {
+		return generator.Install(ctx, units)
+	}
+
+	paths, err := generator.Write(units, ".")
+	for _, path := range paths {
+		fmt.Printf("Wrote %s\n", path)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Copy them to %s and enable them, or rerun with --install\n", container.SystemdUnitDir)
+	return nil
 }
 
-func (c *Command) executeRestart() error {
-	var containerName string
+func (c *Command) executeDoctor(ctx context.Context) error {
+	asJSON, fix := false, false
+	for _, arg := range c.Args {
+		switch arg {
+		case "--json":
+			asJSON = true
+		case "--fix":
+			fix = true
+		default:
+			return fmt.Errorf("Unknown option '%s'. Usage: reddock doctor [--json] [--fix]", arg)
+		}
+	}
+	doctor := container.NewDoctor()
+	return doctor.Report(ctx, os.Stdout, asJSON, fix)
+}
+
+// splitTimeoutFlag extracts --timeout from the arguments, zero when absent
+func splitTimeoutFlag(args []string) ([]string, time.Duration, error) {
+	return splitDurationFlag(args, "--timeout")
+}
+
+// splitDurationFlag extracts a duration flag from the arguments, zero when absent
+func splitDurationFlag(args []string, flag string) ([]string, time.Duration, error) {
+	var rest []string
+	var duration time.Duration
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var value string
+		switch {
+		case arg == flag:
+			if i+1 >= len(args) {
+				return nil, 0, fmt.Errorf("%s requires a duration such as 90s or 5m", flag)
+			}
+			i++
+			value = args[i]
+		case strings.HasPrefix(arg, flag+"="):
+			value = strings.TrimPrefix(arg, flag+"=")
+		default:
+			rest = append(rest, arg)
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, 0, fmt.Errorf("Invalid %s '%s', expected a duration such as 90s or 5m", strings.TrimPrefix(flag, "--"), value)
+		}
+		duration = d
+	}
+	return rest, duration, nil
+}
+
+func (c *Command) executeStop(ctx context.Context) error {
+	remove := false
+
+	flags, sel, parallel, err := splitSelector(c.Args)
+	if err != nil {
+		return err
+	}
+	usage := "Usage: reddock stop <container-name>...|--all|-l <label> [--rm] [--parallel <n>]"
+	for _, arg := range flags {
+		if arg != "--rm" {
+			return fmt.Errorf("Unknown option '%s'. %s", arg, usage)
+		}
+		remove = true
+	}
+
+	if sel.Empty() {
+		return fmt.Errorf("Container name is required! %s", usage)
+	}
+
+	return runBulk(ctx, sel, parallel, "stop", func(ctx context.Context, store config.Store, name string) error {
+		return container.NewManagerWith(store, nil, name).Stop(ctx, remove)
+	})
+}
+
+func (c *Command) executePause(ctx context.Context) error {
+	if len(c.Args) == 0 {
+		return fmt.Errorf("Container name is required! Usage: reddock pause <container-name>")
+	}
+	mgr := container.NewManagerForContainer(c.Args[0])
+	return mgr.Pause(ctx)
+}
+
+func (c *Command) executeResume(ctx context.Context) error {
+	if len(c.Args) == 0 {
+		return fmt.Errorf("Container name is required! Usage: reddock resume <container-name>")
+	}
+	mgr := container.NewManagerForContainer(c.Args[0])
+	return mgr.Resume(ctx)
+}
+
+func (c *Command) executeRestart(ctx context.Context) error {
 	verbose := false
 
-	for _, arg := range c.Args {
-		if arg == "-v" || arg == "--verbose" {
-			verbose = true
-		} else if containerName == "" {
-			containerName = arg
+	flags, sel, parallel, err := splitSelector(c.Args)
+	if err != nil {
+		return err
+	}
+	usage := "Usage: reddock restart <container-name>...|--all|-l <label> [-v] [--parallel <n>]"
+	for _, arg := range flags {
+		if arg != "-v" && arg != "--verbose" {
+			return fmt.Errorf("Unknown option '%s'. %s", arg, usage)
 		}
+		verbose = true
 	}
 
-	if containerName == "" {
-		return fmt.Errorf("Container name is required! Usage: reddock restart <container-name> [-v]")
+	if sel.Empty() {
+		return fmt.Errorf("Container name is required! %s", usage)
+	}
+	if verbose && (len(sel.Names) != 1 || sel.All || len(sel.Labels) > 0) {
+		return fmt.Errorf("-v follows the logs of a single container")
 	}
 
-	mgr := container.NewManagerForContainer(containerName)
-	return mgr.Restart(verbose)
+	return runBulk(ctx, sel, parallel, "restart", func(ctx context.Context, store config.Store, name string) error {
+		return container.NewManagerWith(store, nil, name).Restart(ctx, verbose)
+	})
 }
 
-func (c *Command) executeStatus() error {
-	var containerName string
+func (c *Command) executeStatus(ctx context.Context) error {
+	_, sel, parallel, err := splitSelector(c.Args)
+	if err != nil {
+		return err
+	}
+	if sel.Empty() {
+		return fmt.Errorf("Container name is required! Usage: reddock status <container-name>...|--all|-l <label> [--parallel <n>]")
+	}
 
-	if len(c.Args) > 0 {
-		containerName = c.Args[0]
-	} else {
-		return fmt.Errorf("Container name is required! Usage: reddock status <container-name>")
+	bulk := container.NewBulk(parallel)
+	names, err := bulk.Select(sel)
+	if err != nil {
+		return err
+	}
+	if len(names) == 1 {
+		return utils.NewStatusManager(names[0]).Show(ctx)
 	}
 
-	status := utils.NewStatusManager(containerName)
-	return status.Show()
+	// Query in parallel, print in order
+	reports := make(map[string]*bytes.Buffer, len(names))
+	for _, name := range names {
+		reports[name] = &bytes.Buffer{}
+	}
+	results := bulk.Each(ctx, names, func(ctx context.Context, store config.Store, name string) error {
+		return utils.NewStatusManagerWith(store, name, reports[name]).Show(ctx)
+	})
+	for i, name := range names {
+		if i > 0 {
+			fmt.Println()
+		}
+		os.Stdout.Write(reports[name].Bytes())
+	}
+	return container.NewBulkError("report status", results)
 }
 
-func (c *Command) executeShell() error {
+func (c *Command) executeShell(ctx context.Context) error {
 	var containerName string
 
 	if len(c.Args) > 0 {
@@ -319,10 +606,10 @@ func (c *Command) executeShell() error {
 	}
 
 	shell := utils.NewShellManager(containerName)
-	return shell.Enter()
+	return shell.Enter(ctx)
 }
 
-func (c *Command) executeAdbConnect() error {
+func (c *Command) executeAdbConnect(ctx context.Context) error {
 	var containerName string
 
 	if len(c.Args) > 0 {
@@ -332,35 +619,218 @@ func (c *Command) executeAdbConnect() error {
 	}
 
 	adb := utils.NewAdbManager(containerName)
-	return adb.ShowConnection()
+	return adb.ShowConnection(ctx)
 }
 
-func (c *Command) executeRemove() error {
-	var containerName string
-	removeImage := false
+func (c *Command) executePort(ctx context.Context) error {
+	if len(c.Args) == 0 || len(c.Args) > 2 {
+		return fmt.Errorf("Container name is required! Usage: reddock port <container-name> [new-port]")
+	}
+
+	mgr := container.NewManagerForContainer(c.Args[0])
+	if len(c.Args) == 1 {
+		return mgr.ShowPort(ctx)
+	}
+	port, err := strconv.Atoi(c.Args[1])
+	if err != nil {
+		return fmt.Errorf("Invalid port '%s'", c.Args[1])
+	}
+	return mgr.SetPort(ctx, port)
+}
+
+func (c *Command) executeClone(ctx context.Context) error {
+	usage := "Usage: reddock clone <source> <new-name> [--stop] [--data <path>]"
+	var names []string
+	var opts container.CloneOptions
+	for i := 0; i < len(c.Args); i++ {
+		arg := c.Args[i]
+		switch {
+		case arg == "--stop":
+			opts.StopSource = true
+		case arg == "--data":
+			if i+1 >= len(c.Args) {
+				return fmt.Errorf("--data requires a path. %s", usage)
+			}
+			i++
+			opts.DataPath = c.Args[i]
+		case strings.HasPrefix(arg, "--data="):
+			opts.DataPath = strings.TrimPrefix(arg, "--data=")
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("Unknown flag %s. %s", arg, usage)
+		default:
+			names = append(names, arg)
+		}
+	}
+	if len(names) != 2 {
+		return fmt.Errorf("Source and new container name are required! %s", usage)
+	}
+	return container.NewCloner().Clone(ctx, names[0], names[1], opts)
+}
 
+func (c *Command) executeRename(ctx context.Context) error {
+	var names []string
+	moveData := false
 	for _, arg := range c.Args {
+		if arg == "--move-data" {
+			moveData = true
+		} else {
+			names = append(names, arg)
+		}
+	}
+	if len(names) != 2 {
+		return fmt.Errorf("Old and new container name are required! Usage: reddock rename <old-name> <new-name> [--move-data]")
+	}
+	return container.NewRenamer().Rename(ctx, names[0], names[1], moveData)
+}
+
+func (c *Command) executeAdopt(ctx context.Context) error {
+	if len(c.Args) != 1 {
+		return fmt.Errorf("Container name is required! Usage: reddock adopt <container-name>")
+	}
+	return container.NewAdopter().Adopt(ctx, c.Args[0])
+}
+
+func (c *Command) executeSync(ctx context.Context) error {
+	dryRun := false
+	yes := false
+	for _, arg := range c.Args {
+		switch arg {
+		case "--dry-run", "-n":
+			dryRun = true
+		case "--yes", "-y":
+			yes = true
+		default:
+			return fmt.Errorf("Unknown option %s. Usage: reddock sync [--dry-run] [-y]", arg)
+		}
+	}
+
+	syncer := container.NewSyncer()
+	report, err := syncer.Check(ctx)
+	if err != nil {
+		return err
+	}
+	report.Print(os.Stdout)
+	if dryRun || len(report.Drifts) == 0 {
+		return nil
+	}
+
+	if !yes {
+		fmt.Print("\nFix the drift? [y/N]: ")
+		var response string
+		fmt.Scanln(&response)
+		if response != "y" && response != "Y" && response != "yes" {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+	return syncer.Fix(ctx, report)
+}
+
+func (c *Command) executeRemove(ctx context.Context) error {
+	removeImage := false
+	yes := false
+
+	flags, sel, parallel, err := splitSelector(c.Args)
+	if err != nil {
+		return err
+	}
+	for _, arg := range flags {
 		if arg == "--image" || arg == "-i" {
 			removeImage = true
-		} else if containerName == "" {
-			containerName = arg
+		} else if arg == "--yes" || arg == "-y" {
+			yes = true
 		}
 	}
 
-	if containerName == "" {
-		return fmt.Errorf("Container name is required! Usage: reddock remove <container-name> [--image]")
+	if sel.Empty() {
+		return fmt.Errorf("Container name is required! Usage: reddock remove <container-name>...|--all|-l <label> [--image] [-y] [--parallel <n>]")
+	}
+
+	bulk := container.NewBulk(parallel)
+	names, err := bulk.Select(sel)
+	if err != nil {
+		return err
+	}
+	if len(names) == 1 {
+		return container.NewRemover(names[0]).Remove(ctx, removeImage)
 	}
 
-	remover := container.NewRemover(containerName)
-	return remover.Remove(removeImage)
+	// Ask once instead of once per container
+	if !yes {
+		fmt.Printf("Remove %d containers and their data: %s? [y/N]: ", len(names), strings.Join(names, ", "))
+		var response string
+		fmt.Scanln(&response)
+		if response != "y" && response != "Y" && response != "yes" {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+	return bulk.Run(ctx, names, "remove", func(ctx context.Context, store config.Store, name string) error {
+		return container.NewRemoverWith(store, nil, name).WithoutPrompt().Remove(ctx, removeImage)
+	})
 }
 
-func (c *Command) executeList() error {
+func (c *Command) executeList(ctx context.Context) error {
 	lister := container.NewLister()
-	return lister.ListReddockContainers()
+	return lister.ListReddockContainers(ctx)
 }
 
-func (c *Command) executeLog() error {
+func (c *Command) executeEvents(ctx context.Context) error {
+	var names []string
+	asJSON := false
+
+	for _, arg := range c.Args {
+		if arg == "--json" {
+			asJSON = true
+		} else {
+			names = append(names, arg)
+		}
+	}
+
+	streamer := container.NewEventStreamer()
+	return streamer.Stream(ctx, names, os.Stdout, asJSON)
+}
+
+func (c *Command) executeStats(ctx context.Context) error {
+	args, interval, err := splitDurationFlag(c.Args, "--interval")
+	if err != nil {
+		return err
+	}
+	var names []string
+	asJSON := false
+	noStream := false
+	for _, arg := range args {
+		switch {
+		case arg == "--json":
+			asJSON = true
+		case arg == "--no-stream":
+			noStream = true
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("Unknown option %s. Usage: reddock stats [<container-name>...] [--no-stream] [--json] [--interval <d>]", arg)
+		default:
+			names = append(names, arg)
+		}
+	}
+
+	monitor := container.NewStatsMonitor()
+	if !asJSON && !noStream {
+		return monitor.Watch(ctx, names, os.Stdout, interval)
+	}
+	samples, err := monitor.Sample(ctx, names)
+	if err != nil && len(samples) == 0 {
+		return err
+	}
+	if asJSON {
+		if printErr := container.PrintStatsJSON(os.Stdout, samples); printErr != nil {
+			return printErr
+		}
+	} else {
+		container.PrintStats(os.Stdout, samples)
+	}
+	return err
+}
+
+func (c *Command) executeLog(ctx context.Context) error {
 	var containerName string
 
 	if len(c.Args) > 0 {
@@ -370,15 +840,15 @@ func (c *Command) executeLog() error {
 	}
 
 	logger := utils.NewLogManager(containerName)
-	return logger.Show()
+	return logger.Show(ctx)
 }
 
-func (c *Command) executePrune() error {
+func (c *Command) executePrune(ctx context.Context) error {
 	pruner := container.NewPruner()
-	return pruner.Prune()
+	return pruner.Prune(ctx)
 }
 
-func (c *Command) executeDockerfile() error {
+func (c *Command) executeDockerfile(ctx context.Context) error {
 	if len(c.Args) < 1 {
 		return fmt.Errorf("Usage: reddock dockerfile <subcommand> <container-name> [options]\n\n" +
 			"Subcommands:\n" +
@@ -421,7 +891,12 @@ func (c *Command) executeDockerfile() error {
 		if err := generator.SaveToFile(generator.GetDockerfilePath()); err != nil {
 			return err
 		}
-		return generator.Build(imageName)
+		// The generated Dockerfile is only a build input, drop it if interrupted
+		err := generator.Build(ctx, imageName)
+		if ctx.Err() != nil {
+			generator.Cleanup()
+		}
+		return err
 
 	case "commit":
 		if len(c.Args) < 3 {
@@ -434,7 +909,7 @@ func (c *Command) executeDockerfile() error {
 			message = strings.Join(c.Args[3:], " ")
 		}
 		generator := container.NewDockerfileGenerator(containerName)
-		return generator.CommitContainer(imageName, message)
+		return generator.CommitContainer(ctx, imageName, message)
 
 	case "install":
 		if len(c.Args) < 3 {
@@ -447,17 +922,18 @@ func (c *Command) executeDockerfile() error {
 		generator := container.NewDockerfileGenerator(containerName)
 		// Check if container is running
 		mgr := container.NewManagerForContainer(containerName)
-		if !mgr.IsRunning() {
-			return fmt.Errorf("Container '%s' is not running. Start it first with: sudo reddock start %s", containerName, containerName)
+		if !mgr.IsRunning(ctx) {
+			return container.NewError(container.ErrNotRunning, containerName,
+				"Container '%s' is not running. Start it first with: sudo reddock start %s", containerName, containerName)
 		}
-		return generator.InstallAddonToRunningContainer("/tmp/reddock-addons", addonName)
+		return generator.InstallAddonToRunningContainer(ctx, "/tmp/reddock-addons", addonName)
 
 	case "interactive", "i":
 		if len(c.Args) < 2 {
 			return fmt.Errorf("Container name is required! Usage: reddock dockerfile interactive <container-name>")
 		}
 		generator := container.NewDockerfileGenerator(c.Args[1])
-		return generator.Interactive()
+		return generator.Interactive(ctx)
 
 	default:
 		// Backward compatibility: treat first arg as container name for "show"
@@ -468,21 +944,50 @@ func (c *Command) executeDockerfile() error {
 
 func PrintUsage() {
 	fmt.Printf("Reddock %s\n", Version)
-	fmt.Println("\nUsage: reddock [command] [options]")
+	fmt.Println("\nUsage: reddock [--runtime <name>] [--host <endpoint>] [command] [options]")
+	fmt.Println("\nGlobal Options:")
+	fmt.Println("  --runtime <name>               	Container runtime: auto, docker, docker-api, podman, nerdctl")
+	fmt.Println("                                 	(also REDDOCK_RUNTIME or \"runtime\" in config.json)")
+	fmt.Println("  --host <endpoint>              	Engine for new containers: unix:///path, tcp://host[:port], ssh://[user@]host")
+	fmt.Println("                                 	(also REDDOCK_HOST or \"host\" in config.json)")
 	fmt.Println("\nCommands:")
-	fmt.Println("  init [<n>] [<image>]        		Initialize container (interactive if name/image omitted)")
-	fmt.Println("  start <n> [-v]              		Start container (use -v for foreground/logs)")
-	fmt.Println("  stop <n>                    		Stop container (name required)")
-	fmt.Println("  restart <n> [-v]            		Restart container (use -v for foreground/logs)")
-	fmt.Println("  status <n>                  		Show container status (name required)")
+	fmt.Println("  init [<n>] [<image>] [limits]		Initialize container (interactive if name/image omitted)")
+	fmt.Println("                                 	limits: --cpus, --memory, --cpuset, --pids-limit, --device, -e, --mount")
+	fmt.Println("                                 	binder: --binder auto|binderfs|host")
+	fmt.Println("                                 	display: --width, --height, --dpi, --fps, --gpu-mode, --gpu-node, --prop k=v")
+	fmt.Println("                                 	restart: --restart no|on-failure|always, --restart-max, --restart-delay")
+	fmt.Println("                                 	network: --network bridge|host|macvlan|<name>, --ip, --subnet, --gateway, --macvlan-parent, -p")
+	fmt.Println("  start <n>... [-v] [--wait]  		Start containers (use -v for foreground/logs, --wait to wait for boot)")
+	fmt.Println("  wait <n> [--timeout <d>]    		Wait until Android finished booting")
+	fmt.Println("  stop <n>... [--rm]          		Stop containers, keeping them unless --rm is given")
+	fmt.Println("  pause <n>                   		Freeze a running container")
+	fmt.Println("  resume <n>                  		Resume a paused container")
+	fmt.Println("  restart <n>... [-v]         		Restart containers (use -v for foreground/logs)")
+	fmt.Println("  status <n>...               		Show container status (name required)")
 	fmt.Println("  shell <n>                   		Enter container shell (name required)")
 	fmt.Println("  adb-connect <n>             		Show ADB connection command (name required)")
-	fmt.Println("  remove <n> [--image]        		Remove container and data (--image to also remove image)")
+	fmt.Println("  port <n> [<port>]           		Show the ADB address, or move ADB to another host port")
+	fmt.Println("  clone <src> <n> [--stop]    		Copy a container and its data (--stop keeps the copy consistent)")
+	fmt.Println("  rename <n> <new> [--move-data]	Rename a stopped container (--move-data to rename its data directory)")
+	fmt.Println("  adopt <n>                   		Import an existing redroid container into the config")
+	fmt.Println("  sync [--dry-run] [-y]          	Report and fix drift between the config and the runtime")
+	fmt.Println("  remove <n>... [--image] [-y]		Remove containers and data (--image to also remove image)")
+	fmt.Println("                                 	start, stop, restart, status and remove take names, globs (farm-*),")
+	fmt.Println("                                 	--all or -l <label>, and --parallel <n> (default 4)")
 	fmt.Println("  list                           	List all Reddock containers")
+	fmt.Println("  plan [-f <file>] [--prune]     	Show what apply changes to match the fleet spec (reddock.yaml)")
+	fmt.Println("  apply [-f <file>] [--prune] [-y]	Create, rebuild, recreate or remove containers to match the fleet spec")
 	fmt.Println("  log <n>                     		Show container logs (name required)")
+	fmt.Println("  events [<n>...] [--json]       	Stream container events (Ctrl+C to stop)")
+	fmt.Println("  stats [<n>...] [--no-stream] [--json]	Show live CPU, memory, network, block I/O and PIDs")
+	fmt.Println("  supervise [<n>...] [--interval <d>]	Health check containers and restart them per their restart policy")
+	fmt.Println("  systemd generate <n>...|--all [--install]	Write systemd units starting containers at boot")
+	fmt.Println("  doctor [--json] [--fix]        	Check the host for redroid, --fix loads missing modules")
 	fmt.Println("  prune                          	Remove unused images")
 	fmt.Println("  dockerfile <cmd> <n> ...       	Dockerfile management (see below)")
 	fmt.Println("  addons <cmd> ...               	Addon management (see below)")
+	fmt.Println("  config set <n> <key=value...>  	Change container settings (applied on next start)")
+	fmt.Println("  config get <n>                 	Show container settings")
 	fmt.Println("  version                        	Show version information")
 	fmt.Println("\nDockerfile Subcommands:")
 	fmt.Println("  dockerfile show <n>              	Show generated Dockerfile (name required)")
@@ -497,7 +1002,10 @@ func PrintUsage() {
 	fmt.Println("  addons build <n> <v> <addons...>      	Build custom image with addons")
 	fmt.Println("\nExamples:")
 	fmt.Println("  sudo reddock init android13")
+	fmt.Println("  sudo reddock init farm1 redroid/redroid:13.0.0-latest --cpus 2 --memory 4g --device /dev/kvm")
 	fmt.Println("  sudo reddock start android13 -v")
+	fmt.Println("  sudo reddock clone android13 android13-test --stop")
+	fmt.Println("  sudo reddock adopt my-redroid")
 	fmt.Println("  sudo reddock remove android13")
 	fmt.Println("  sudo reddock remove android13 --image  # Also remove Docker image")
 	fmt.Println("  sudo reddock addons build custom-android13 13.0.0 litegapps ndk")
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"reddock/pkg/config"
+	"reddock/pkg/container"
+)
+
+// settingFlags maps init flags onto setting keys
+var settingFlags = map[string]string{
+	"--cpus":           config.KeyCPUs,
+	"--memory":         config.KeyMemory,
+	"--cpuset":         config.KeyCPUSet,
+	"--pids-limit":     config.KeyPidsLimit,
+	"--device":         config.KeyDevice,
+	"--env":            config.KeyEnv,
+	"-e":               config.KeyEnv,
+	"--mount":          config.KeyMount,
+	"--binder":         config.KeyBinder,
+	"--width":          config.KeyWidth,
+	"--height":         config.KeyHeight,
+	"--dpi":            config.KeyDPI,
+	"--fps":            config.KeyFPS,
+	"--gpu-mode":       config.KeyGPUMode,
+	"--gpu-node":       config.KeyGPUNode,
+	"--restart":        config.KeyRestart,
+	"--restart-max":    config.KeyRestartMax,
+	"--restart-delay":  config.KeyRestartDelay,
+	"--network":        config.KeyNetwork,
+	"--ip":             config.KeyIP,
+	"--subnet":         config.KeySubnet,
+	"--gateway":        config.KeyGateway,
+	"--macvlan-parent": config.KeyMacvlanParent,
+	"--publish":        config.KeyPublish,
+	"-p":               config.KeyPublish,
+	"--label":          config.KeyLabel,
+	// --prop takes a whole ro.* or androidboot.* assignment
+	"--prop": "",
+}
+
+// splitSettingFlags returns the setting flags as key=value pairs and the rest
+func splitSettingFlags(args []string) ([]string, []string, error) {
+	var rest, pairs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		flag, value, inline := strings.Cut(arg, "=")
+		key, ok := settingFlags[flag]
+		if !ok || !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+			continue
+		}
+		if !inline {
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("%s requires a value", flag)
+			}
+			i++
+			value = args[i]
+		}
+		if key == "" {
+			pairs = append(pairs, value)
+		} else {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+
+	// Validate up front so a typo does not surface after the image pull
+	if err := (&config.Container{}).ApplySettings(pairs); err != nil {
+		return nil, nil, err
+	}
+	return rest, pairs, nil
+}
+
+func (c *Command) executeConfig(ctx context.Context) error {
+	if len(c.Args) < 2 {
+		return c.showConfigHelp()
+	}
+
+	subCommand := c.Args[0]
+	containerName := c.Args[1]
+
+	settings := container.NewSettingsManager()
+	switch subCommand {
+	case "set":
+		return settings.Set(ctx, containerName, c.Args[2:])
+	case "get", "show":
+		return settings.Show(containerName)
+	default:
+		return fmt.Errorf("unknown config subcommand: %s", subCommand)
+	}
+}
+
+func (c *Command) showConfigHelp() error {
+	fmt.Println("Container Settings")
+	fmt.Println("\nUsage: reddock config [set|get] <n> [key=value...]")
+	fmt.Println("\nKeys:")
+	fmt.Println("  cpus=<n>                     	CPU quota, e.g. 1.5")
+	fmt.Println("  memory=<size>                	Memory limit, e.g. 4g")
+	fmt.Println("  cpuset=<list>                	CPUs to pin to, e.g. 0-3")
+	fmt.Println("  pids-limit=<n>               	Maximum number of processes (-1 for unlimited)")
+	fmt.Println("  device=<path[:path[:perms]]> 	Extra device (repeatable)")
+	fmt.Println("  env=<NAME=value>             	Extra environment variable (repeatable)")
+	fmt.Println("  mount=<src:dst[:opts]>       	Extra bind mount (repeatable)")
+	fmt.Println("  width=<px> height=<px>       	Display size")
+	fmt.Println("  dpi=<n> fps=<n>              	Display density and refresh rate")
+	fmt.Println("  gpu-mode=<auto|host|guest>   	GPU rendering mode")
+	fmt.Println("  gpu-node=<path>              	GPU render node, e.g. /dev/dri/renderD128")
+	fmt.Println("  network=<bridge|host|macvlan|name>	Network to join, named networks are created on demand")
+	fmt.Println("  ip=<address>                 	Static IPv4 address on a named or macvlan network")
+	fmt.Println("  subnet=<cidr> gateway=<ip>   	Subnet and gateway of a network reddock creates")
+	fmt.Println("  macvlan-parent=<iface>       	Host interface macvlan attaches to, e.g. eth0")
+	fmt.Println("  publish=<host:container[/proto]>	Extra published port, e.g. 27042:27042 (repeatable)")
+	fmt.Println("  label=<name=value>           	Label for selecting containers with -l (repeatable)")
+	fmt.Println("  ro.<prop>=<value>            	System property override")
+	fmt.Println("  androidboot.<prop>=<value>   	Boot argument passed through to redroid")
+	fmt.Println("\nAn empty value clears a key. Repeatable keys replace the stored list with")
+	fmt.Println("the values given. The container is recreated on its next start, /data is kept.")
+	fmt.Println("\nExamples:")
+	fmt.Println("  reddock config set android13 cpus=2 memory=4g")
+	fmt.Println("  reddock config set android13 device=/dev/kvm device=/dev/dri/renderD128")
+	fmt.Println("  reddock config set android13 env=")
+	fmt.Println("  reddock config set android13 width=1080 height=1920 dpi=480 gpu-mode=host")
+	fmt.Println("  reddock config set android13 network=macvlan macvlan-parent=eth0 subnet=192.168.1.0/24 ip=192.168.1.50")
+	fmt.Println("  reddock config set android13 ro.product.model=Pixel androidboot.hardware=redroid")
+	return nil
+}
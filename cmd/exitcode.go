@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+
+	"reddock/pkg/container"
+)
+
+// Exit codes returned by reddock for each error kind
+const (
+	ExitOK                 = 0
+	ExitFailure            = 1
+	ExitUsage              = 2
+	ExitNotFound           = 3
+	ExitNotInitialized     = 4
+	ExitNotRunning         = 5
+	ExitImageMissing       = 6
+	ExitRuntimeUnavailable = 7
+	ExitBinderMissing      = 8
+	ExitTimeout            = 9
+	ExitContainerDied      = 10
+	ExitPortInUse          = 11
+	ExitBusy               = 12
+	ExitCanceled           = 130
+)
+
+var exitCodes = []struct {
+	kind error
+	code int
+}{
+	{container.ErrContainerNotFound, ExitNotFound},
+	{container.ErrNotInitialized, ExitNotInitialized},
+	{container.ErrNotRunning, ExitNotRunning},
+	{container.ErrImageMissing, ExitImageMissing},
+	{container.ErrRuntimeUnavailable, ExitRuntimeUnavailable},
+	{container.ErrBinderMissing, ExitBinderMissing},
+	{container.ErrTimeout, ExitTimeout},
+	{container.ErrCanceled, ExitCanceled},
+	{container.ErrContainerDied, ExitContainerDied},
+	{container.ErrPortInUse, ExitPortInUse},
+	{container.ErrBusy, ExitBusy},
+}
+
+// ExitCode maps an error returned by Execute onto the process exit status
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	for _, entry := range exitCodes {
+		if errors.Is(err, entry.kind) {
+			return entry.code
+		}
+	}
+	return ExitFailure
+}
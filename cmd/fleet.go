@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"reddock/pkg/addons"
+	"reddock/pkg/config"
+	"reddock/pkg/container"
+)
+
+type fleetArgs struct {
+	file  string
+	prune bool
+	yes   bool
+}
+
+func parseFleetArgs(args []string, usage string) (*fleetArgs, error) {
+	parsed := &fleetArgs{file: config.DefaultFleetFile}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		flag, value, inline := strings.Cut(arg, "=")
+		switch flag {
+		case "-f", "--file":
+			if !inline {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("%s requires a path. %s", flag, usage)
+				}
+				i++
+				value = args[i]
+			}
+			parsed.file = value
+		case "--prune":
+			parsed.prune = true
+		case "-y", "--yes":
+			parsed.yes = true
+		default:
+			return nil, fmt.Errorf("Unknown argument %s. %s", arg, usage)
+		}
+	}
+	return parsed, nil
+}
+
+// planFleet loads the fleet spec and diffs it against the containers
+func planFleet(ctx context.Context, args *fleetArgs) (*container.Fleet, *container.FleetPlan, error) {
+	spec, err := config.LoadFleetSpec(args.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	fleet := container.NewFleet(buildFleetImage)
+	plan, err := fleet.Plan(ctx, spec, args.prune)
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Printf("Fleet %s:\n", args.file)
+	plan.Print(os.Stdout)
+	return fleet, plan, nil
+}
+
+func (c *Command) executePlan(ctx context.Context) error {
+	args, err := parseFleetArgs(c.Args, "Usage: reddock plan [-f reddock.yaml] [--prune]")
+	if err != nil {
+		return err
+	}
+	_, _, err = planFleet(ctx, args)
+	return err
+}
+
+func (c *Command) executeApply(ctx context.Context) error {
+	args, err := parseFleetArgs(c.Args, "Usage: reddock apply [-f reddock.yaml] [--prune] [-y]")
+	if err != nil {
+		return err
+	}
+	fleet, plan, err := planFleet(ctx, args)
+	if err != nil || plan.Pending() == 0 {
+		return err
+	}
+
+	if !args.yes {
+		fmt.Print("\nApply these changes? [y/N]: ")
+		var response string
+		fmt.Scanln(&response)
+		if response != "y" && response != "Y" && response != "yes" {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+	return fleet.Apply(ctx, plan)
+}
+
+// buildFleetImage builds the image of a fleet container with addons
+func buildFleetImage(ctx context.Context, build *config.BuildSpec, target string) error {
+	manager := addons.NewAddonManager()
+	defer manager.Cleanup()
+	for _, name := range build.Addons {
+		if _, err := manager.GetAddon(name); err != nil {
+			return fmt.Errorf("Invalid addon: %s", name)
+		}
+	}
+	return manager.BuildCustomImage(ctx, build.BaseImage(), target, build.Android, getHostArch(), build.Addons)
+}
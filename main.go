@@ -1,30 +1,50 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"reddock/cmd"
 )
 
 func main() {
+	// Global flags may appear anywhere on the command line
+	cliArgs, err := cmd.ParseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(cmd.ExitUsage)
+	}
+
 	// Ensure the program is run as root for all operations
 	if err := cmd.CheckRoot(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if len(os.Args) < 2 {
+	if len(cliArgs) < 1 {
 		cmd.PrintUsage()
-		os.Exit(1)
+		os.Exit(cmd.ExitUsage)
 	}
 
-	command := os.Args[1]
-	args := os.Args[2:]
+	// SIGINT and SIGTERM cancel in-flight work so commands can clean up
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// Restore the default handlers so a second signal exits at once
+		stop()
+	}()
+
+	command := cliArgs[0]
+	args := cliArgs[1:]
 
 	c := cmd.NewCommand(command, args)
-	if err := c.Execute(); err != nil {
+	err = c.Execute(ctx)
+	stop()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -1,9 +1,11 @@
 package addons
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reddock/pkg/config"
 	"reddock/pkg/container"
 	"reddock/pkg/ui"
 	"strings"
@@ -13,6 +15,7 @@ type AddonManager struct {
 	availableAddons map[string]Addon
 	workDir         string
 	cacheDir        string
+	config          *config.Config
 	runtime         container.Runtime
 }
 
@@ -25,10 +28,12 @@ func NewAddonManager() *AddonManager {
 		"opengapps":    NewOpenGappsAddon(),
 	}
 
+	cfg := config.LoadOrDefault(config.NewFileStore())
 	return &AddonManager{
 		availableAddons: addons,
 		workDir:         "/tmp/reddock-addons",
-		runtime:         container.NewRuntime(),
+		config:          cfg,
+		runtime:         container.NewRuntimeFromConfig(cfg),
 	}
 }
 
@@ -124,10 +129,16 @@ func (am *AddonManager) BuildDockerfile(baseImage string, addons []string) (stri
 	return dockerfile.String(), nil
 }
 
-func (am *AddonManager) BuildCustomImage(baseImage, targetImage, version, arch string, addonNames []string) error {
+// BuildCustomImage removes its work directory if ctx is cancelled
+func (am *AddonManager) BuildCustomImage(ctx context.Context, baseImage, targetImage, version, arch string, addonNames []string) error {
 	if err := ensureDir(am.workDir); err != nil {
 		return err
 	}
+	defer func() {
+		if ctx.Err() != nil {
+			am.Cleanup()
+		}
+	}()
 
 	fmt.Println("\n=== Building custom Redroid Image ===")
 	fmt.Printf("Base Image: %s\n", baseImage)
@@ -137,19 +148,25 @@ func (am *AddonManager) BuildCustomImage(baseImage, targetImage, version, arch s
 	// Pull base image if it's official redroid image
 	if strings.HasPrefix(baseImage, "redroid/redroid:") {
 		fmt.Printf("Pulling official Redroid image %s...\n", baseImage)
-		if err := am.runtime.PullImage(baseImage); err != nil {
-			return fmt.Errorf("Failed to pull official image: %v", err)
+		if err := am.pullImage(ctx, baseImage); err != nil {
+			return fmt.Errorf("Failed to pull official image: %w", err)
 		}
 	} else if !strings.HasPrefix(baseImage, "reddock-custom:") && !strings.HasPrefix(baseImage, "reddock/") {
 		// For other images, try to pull if not local
 		fmt.Printf("Pulling base image %s...\n", baseImage)
-		if err := am.runtime.PullImage(baseImage); err != nil {
+		if err := am.pullImage(ctx, baseImage); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
 			// If pull fails, might be a local image, just warn
 			fmt.Printf("Warning: Could not pull image %s, hoping it exists locally: %v\n", baseImage, err)
 		}
 	}
 
 	for _, addonName := range addonNames {
+		if ctx.Err() != nil {
+			return container.ContextError(ctx, ctx.Err())
+		}
 		if err := am.PrepareAddon(addonName, version, arch); err != nil {
 			return fmt.Errorf("Failed to prepare %s: %v", addonName, err)
 		}
@@ -171,23 +188,23 @@ func (am *AddonManager) BuildCustomImage(baseImage, targetImage, version, arch s
 	spinner := ui.NewSpinner("Building Docker image...")
 	spinner.Start()
 
-	buildArgs := []string{"build", "-t", targetImage, am.workDir}
-	if am.runtime.Name() == "docker" {
-		buildArgs = []string{"buildx", "build", "--load", "-t", targetImage, am.workDir}
-	}
-	cmd := am.runtime.Command(buildArgs...)
-	output, err := cmd.CombinedOutput()
-
-	if err != nil {
+	buildCtx, cancel := container.WithTimeout(ctx, am.config, config.OpBuild)
+	defer cancel()
+	if err := am.runtime.Build(buildCtx, am.workDir, targetImage); err != nil {
 		spinner.Finish("Failed to build Docker image")
-		fmt.Println(string(output))
-		return fmt.Errorf("Failed to build Docker image: %v", err)
+		return fmt.Errorf("Failed to build Docker image: %w", err)
 	}
 	spinner.Finish(fmt.Sprintf("Successfully built %s", targetImage))
 
 	return nil
 }
 
+func (am *AddonManager) pullImage(ctx context.Context, image string) error {
+	ctx, cancel := container.WithTimeout(ctx, am.config, config.OpPull)
+	defer cancel()
+	return am.runtime.PullImage(ctx, image)
+}
+
 func (am *AddonManager) GetSupportedVersions(addonName string) ([]string, error) {
 	addon, err := am.GetAddon(addonName)
 	if err != nil {
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Boot property keys, raw ro.* and androidboot.* keys are passed through
+const (
+	KeyWidth   = "width"
+	KeyHeight  = "height"
+	KeyDPI     = "dpi"
+	KeyFPS     = "fps"
+	KeyGPUMode = "gpu-mode"
+	KeyGPUNode = "gpu-node"
+)
+
+// GPUModes lists the values redroid accepts for androidboot.redroid_gpu_mode
+var GPUModes = []string{"auto", "host", "guest"}
+
+// redroidProps maps the first-class keys onto redroid boot properties
+var redroidProps = map[string]string{
+	KeyWidth:   "androidboot.redroid_width",
+	KeyHeight:  "androidboot.redroid_height",
+	KeyDPI:     "androidboot.redroid_dpi",
+	KeyFPS:     "androidboot.redroid_fps",
+	KeyGPUMode: "androidboot.redroid_gpu_mode",
+	KeyGPUNode: "androidboot.redroid_gpu_node",
+}
+
+func isPassthroughProp(key string) bool {
+	return strings.HasPrefix(key, "ro.") || strings.HasPrefix(key, "androidboot.")
+}
+
+// setBootProp reports false for keys that are not boot properties
+func (c *Container) setBootProp(key, value string) (bool, error) {
+	switch key {
+	case KeyWidth, KeyHeight, KeyDPI, KeyFPS:
+		n := 0
+		if value != "" {
+			var err error
+			n, err = strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return true, fmt.Errorf("Invalid %s '%s', expected a positive number", key, value)
+			}
+		}
+		switch key {
+		case KeyWidth:
+			c.Width = n
+		case KeyHeight:
+			c.Height = n
+		case KeyDPI:
+			c.DPI = n
+		case KeyFPS:
+			c.FPS = n
+		}
+	case KeyGPUMode:
+		if value == "" {
+			value = DefaultGPUMode
+		}
+		if !contains(GPUModes, value) {
+			return true, fmt.Errorf("Invalid gpu-mode '%s' (use %s)", value, strings.Join(GPUModes, ", "))
+		}
+		c.GPUMode = value
+	case KeyGPUNode:
+		if value != "" && !filepath.IsAbs(value) {
+			return true, fmt.Errorf("Invalid gpu-node '%s', expected a device path such as /dev/dri/renderD128", value)
+		}
+		c.GPUNode = value
+	default:
+		if !isPassthroughProp(key) {
+			return false, nil
+		}
+		for short, prop := range redroidProps {
+			if key == prop {
+				return true, fmt.Errorf("Use %s=... instead of %s", short, prop)
+			}
+		}
+		if strings.ContainsAny(key, " =") {
+			return true, fmt.Errorf("Invalid boot property '%s'", key)
+		}
+		if value == "" {
+			delete(c.BootProps, key)
+			return true, nil
+		}
+		if c.BootProps == nil {
+			c.BootProps = make(map[string]string)
+		}
+		c.BootProps[key] = value
+	}
+	return true, nil
+}
+
+func (c *Container) bootSettings() []string {
+	var pairs []string
+	for _, entry := range []struct {
+		key   string
+		value int
+	}{{KeyWidth, c.Width}, {KeyHeight, c.Height}, {KeyDPI, c.DPI}, {KeyFPS, c.FPS}} {
+		if entry.value != 0 {
+			pairs = append(pairs, fmt.Sprintf("%s=%d", entry.key, entry.value))
+		}
+	}
+	if c.GPUMode != "" && c.GPUMode != DefaultGPUMode {
+		pairs = append(pairs, KeyGPUMode+"="+c.GPUMode)
+	}
+	if c.GPUNode != "" {
+		pairs = append(pairs, KeyGPUNode+"="+c.GPUNode)
+	}
+	for _, key := range sortedKeys(c.BootProps) {
+		pairs = append(pairs, key+"="+c.BootProps[key])
+	}
+	return pairs
+}
+
+// BootArgs returns the redroid init arguments in a stable order
+func (c *Container) BootArgs() []string {
+	gpuMode := c.GPUMode
+	if gpuMode == "" {
+		gpuMode = DefaultGPUMode
+	}
+	args := []string{redroidProps[KeyGPUMode] + "=" + gpuMode}
+	if c.GPUNode != "" {
+		args = append(args, redroidProps[KeyGPUNode]+"="+c.GPUNode)
+	}
+	for _, entry := range []struct {
+		key   string
+		value int
+	}{{KeyWidth, c.Width}, {KeyHeight, c.Height}, {KeyDPI, c.DPI}, {KeyFPS, c.FPS}} {
+		if entry.value != 0 {
+			args = append(args, fmt.Sprintf("%s=%d", redroidProps[entry.key], entry.value))
+		}
+	}
+	for _, key := range sortedKeys(c.BootProps) {
+		args = append(args, key+"="+c.BootProps[key])
+	}
+	return args
+}
+
+// BootArgSettings turns init arguments back into settings, returning the rest apart
+func BootArgSettings(args []string) (pairs, unknown []string) {
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || !isPassthroughProp(key) {
+			unknown = append(unknown, arg)
+			continue
+		}
+		for short, prop := range redroidProps {
+			if key == prop {
+				key = short
+				break
+			}
+		}
+		pairs = append(pairs, key+"="+value)
+	}
+	return pairs, unknown
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -5,13 +5,45 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
 	DefaultGPUMode = "auto"
+	// DefaultADBPort is the port adbd listens on inside redroid
+	DefaultADBPort = 5555
+	// DefaultADBPorts is overridden by "adb_ports" in the config
+	DefaultADBPorts = "5555-5654"
 )
 
+// Operations with a configurable timeout
+const (
+	OpPull   = "pull"
+	OpPush   = "push"
+	OpBuild  = "build"
+	OpStart  = "start"
+	OpStop   = "stop"
+	OpRemove = "remove"
+	OpBoot   = "boot"
+	OpClone  = "clone"
+)
+
+// DefaultTimeouts can be overridden in the "timeouts" section of the config
+var DefaultTimeouts = map[string]time.Duration{
+	OpPull:   30 * time.Minute,
+	OpPush:   30 * time.Minute,
+	OpBuild:  60 * time.Minute,
+	OpStart:  2 * time.Minute,
+	OpStop:   2 * time.Minute,
+	OpRemove: 2 * time.Minute,
+	OpBoot:   5 * time.Minute,
+	OpClone:  60 * time.Minute,
+}
+
 type RedroidImage struct {
 	Name      string
 	URL       string
@@ -45,16 +77,65 @@ var AvailableImages = []RedroidImage{
 }
 
 type Container struct {
-	Name        string `json:"name"`
-	ImageURL    string `json:"image_url"`
-	DataPath    string `json:"data_path"`
-	LogFile     string `json:"log_file"`
-	Port        int    `json:"port"`
-	GPUMode     string `json:"gpu_mode"`
+	Name     string `json:"name"`
+	ImageURL string `json:"image_url"`
+	DataPath string `json:"data_path"`
+	LogFile  string `json:"log_file"`
+	Port     int    `json:"port"`
+	GPUMode  string `json:"gpu_mode"`
+	Runtime  string `json:"runtime,omitempty"`
+	// Host is the engine endpoint, empty for the local engine
+	Host        string `json:"host,omitempty"`
 	Initialized bool   `json:"initialized"`
+
+	// Resource limits and extra run options, see ApplySettings
+	CPUs      string   `json:"cpus,omitempty"`
+	Memory    string   `json:"memory,omitempty"`
+	CPUSet    string   `json:"cpuset,omitempty"`
+	PidsLimit int64    `json:"pids_limit,omitempty"`
+	Devices   []string `json:"devices,omitempty"`
+	Env       []string `json:"env,omitempty"`
+	Mounts    []string `json:"mounts,omitempty"`
+	Binder    string   `json:"binder,omitempty"`
+
+	// Redroid display and boot properties, see BootArgs
+	Width     int               `json:"width,omitempty"`
+	Height    int               `json:"height,omitempty"`
+	DPI       int               `json:"dpi,omitempty"`
+	FPS       int               `json:"fps,omitempty"`
+	GPUNode   string            `json:"gpu_node,omitempty"`
+	BootProps map[string]string `json:"boot_props,omitempty"`
+
+	// Network the container joins and extra published ports
+	Network       string   `json:"network,omitempty"`
+	IP            string   `json:"ip,omitempty"`
+	Subnet        string   `json:"subnet,omitempty"`
+	Gateway       string   `json:"gateway,omitempty"`
+	MacvlanParent string   `json:"macvlan_parent,omitempty"`
+	Publish       []string `json:"publish,omitempty"`
+
+	// Labels group containers for selectors such as "start -l tier=lab"
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Build records what "reddock apply" built the image with
+	Build string `json:"build,omitempty"`
+
+	// RunSpec fingerprints the run options the container was created with
+	RunSpec string `json:"run_spec,omitempty"`
+
+	// Restart policy applied by "reddock supervise", see RestartPolicy
+	Restart      string `json:"restart,omitempty"`
+	RestartMax   int    `json:"restart_max,omitempty"`
+	RestartDelay string `json:"restart_delay,omitempty"`
+	// Stopped keeps the supervisor away until the next start
+	Stopped bool `json:"stopped,omitempty"`
 }
 
 type Config struct {
+	Runtime    string                `json:"runtime,omitempty"`
+	Host       string                `json:"host,omitempty"`
+	Timeouts   map[string]string     `json:"timeouts,omitempty"`
+	ADBPorts   string                `json:"adb_ports,omitempty"`
 	Containers map[string]*Container `json:"containers"`
 }
 
@@ -63,7 +144,13 @@ func GetConfigDir() string {
 	return filepath.Join(home, ".config", "reddock")
 }
 
+// ConfigEnvVar overrides the location of the config file
+const ConfigEnvVar = "REDDOCK_CONFIG"
+
 func GetConfigPath() string {
+	if path := os.Getenv(ConfigEnvVar); path != "" {
+		return path
+	}
 	return filepath.Join(GetConfigDir(), "config.json")
 }
 
@@ -78,14 +165,28 @@ func GetDefault() *Config {
 	}
 }
 
-func Load() (*Config, error) {
-	configPath := GetConfigPath()
+// Store loads and persists the reddock configuration
+type Store interface {
+	Load() (*Config, error)
+	Save(cfg *Config) error
+}
+
+// FileStore keeps the configuration in a JSON file
+type FileStore struct {
+	Path string
+}
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+// NewFileStore returns a store backed by the default config file
+func NewFileStore() *FileStore {
+	return &FileStore{Path: GetConfigPath()}
+}
+
+func (s *FileStore) Load() (*Config, error) {
+	if _, err := os.Stat(s.Path); os.IsNotExist(err) {
 		return GetDefault(), nil
 	}
 
-	data, err := os.ReadFile(configPath)
+	data, err := os.ReadFile(s.Path)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to read config: %v", err)
 	}
@@ -102,10 +203,8 @@ func Load() (*Config, error) {
 	return &cfg, nil
 }
 
-func Save(cfg *Config) error {
-	configDir := GetConfigDir()
-
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+func (s *FileStore) Save(cfg *Config) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
 		return fmt.Errorf("Failed to create config directory: %v", err)
 	}
 
@@ -114,14 +213,73 @@ func Save(cfg *Config) error {
 		return fmt.Errorf("Failed to marshal config: %v", err)
 	}
 
-	configPath := GetConfigPath()
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	if err := os.WriteFile(s.Path, data, 0644); err != nil {
 		return fmt.Errorf("Failed to write config: %v", err)
 	}
 
 	return nil
 }
 
+func Load() (*Config, error) {
+	return NewFileStore().Load()
+}
+
+func Save(cfg *Config) error {
+	return NewFileStore().Save(cfg)
+}
+
+// LoadOrDefault warns and falls back to an empty configuration on read errors
+func LoadOrDefault(store Store) *Config {
+	cfg, err := store.Load()
+	if err != nil {
+		fmt.Printf("Warning: Failed to load config: %v\n", err)
+		return GetDefault()
+	}
+	return cfg
+}
+
+// Timeout returns the limit for an operation, "0" disables it
+func (cfg *Config) Timeout(op string) time.Duration {
+	if value, ok := cfg.Timeouts[op]; ok {
+		d, err := time.ParseDuration(value)
+		if err == nil && d >= 0 {
+			return d
+		}
+		fmt.Printf("Warning: Invalid %s timeout '%s', using %s\n", op, value, DefaultTimeouts[op])
+	}
+	return DefaultTimeouts[op]
+}
+
+func (cfg *Config) ADBPortRange() (int, int) {
+	if cfg.ADBPorts != "" {
+		if first, last, err := ParsePortRange(cfg.ADBPorts); err == nil {
+			return first, last
+		}
+		fmt.Printf("Warning: Invalid adb_ports '%s', using %s\n", cfg.ADBPorts, DefaultADBPorts)
+	}
+	first, last, _ := ParsePortRange(DefaultADBPorts)
+	return first, last
+}
+
+// ParsePortRange parses a range such as 5555-5654, or a single port
+func ParsePortRange(value string) (int, int, error) {
+	from, to, isRange := strings.Cut(value, "-")
+	if !isRange {
+		to = from
+	}
+	first, err1 := strconv.Atoi(strings.TrimSpace(from))
+	last, err2 := strconv.Atoi(strings.TrimSpace(to))
+	if err1 != nil || err2 != nil || first < 1 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("Invalid port range '%s', expected first-last such as %s", value, DefaultADBPorts)
+	}
+	return first, last, nil
+}
+
+// IsRemote reports whether the container runs on another machine
+func (c *Container) IsRemote() bool {
+	return strings.HasPrefix(c.Host, "tcp://") || strings.HasPrefix(c.Host, "ssh://")
+}
+
 func (c *Container) GetDataPath() string {
 	if c.DataPath != "" {
 		return c.DataPath
@@ -147,11 +305,13 @@ func (cfg *Config) RemoveContainer(name string) {
 	delete(cfg.Containers, name)
 }
 
+// ListContainers returns the containers sorted by name
 func (cfg *Config) ListContainers() []*Container {
 	var containers []*Container
 	for _, container := range cfg.Containers {
 		containers = append(containers, container)
 	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
 	return containers
 }
 
@@ -225,3 +385,16 @@ func ValidateImageName(name string) error {
 	}
 	return nil
 }
+
+var containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ValidateContainerName checks a name the engines accept for their container
+func ValidateContainerName(name string) error {
+	if name == "" {
+		return fmt.Errorf("Container name cannot be empty")
+	}
+	if !containerNamePattern.MatchString(name) {
+		return fmt.Errorf("Invalid container name '%s'. Use letters, digits, '_', '.' and '-', starting with a letter or digit", name)
+	}
+	return nil
+}
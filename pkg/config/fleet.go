@@ -0,0 +1,231 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFleetFile is read by plan and apply unless -f names another
+const DefaultFleetFile = "reddock.yaml"
+
+// FleetSpec declares a fleet of containers, see "reddock apply"
+type FleetSpec struct {
+	// Defaults apply to every container, whose own lists and labels replace them
+	Defaults   ContainerSpec            `yaml:"defaults"`
+	Containers map[string]ContainerSpec `yaml:"containers"`
+}
+
+type ContainerSpec struct {
+	Image string     `yaml:"image"`
+	Build *BuildSpec `yaml:"build"`
+	// Port is the host port of ADB, allocated from the range when unset
+	Port      int               `yaml:"port"`
+	Resources ResourcesSpec     `yaml:"resources"`
+	Devices   []string          `yaml:"devices"`
+	Env       []string          `yaml:"env"`
+	Mounts    []string          `yaml:"mounts"`
+	Binder    string            `yaml:"binder"`
+	Display   DisplaySpec       `yaml:"display"`
+	Props     map[string]string `yaml:"props"`
+	Network   NetworkSpec       `yaml:"network"`
+	Labels    map[string]string `yaml:"labels"`
+	Restart   RestartSpec       `yaml:"restart"`
+}
+
+// BuildSpec builds the image from an official redroid image with addons
+type BuildSpec struct {
+	Android string   `yaml:"android"`
+	Addons  []string `yaml:"addons"`
+}
+
+// String identifies the build, it is recorded to notice a changed build
+func (b *BuildSpec) String() string {
+	if b == nil {
+		return ""
+	}
+	return b.Android + ":" + strings.Join(b.Addons, ",")
+}
+
+func (b *BuildSpec) BaseImage() string {
+	return fmt.Sprintf("redroid/redroid:%s-latest", b.Android)
+}
+
+type ResourcesSpec struct {
+	CPUs      string `yaml:"cpus"`
+	Memory    string `yaml:"memory"`
+	CPUSet    string `yaml:"cpuset"`
+	PidsLimit int64  `yaml:"pids-limit"`
+}
+
+type DisplaySpec struct {
+	Width   int    `yaml:"width"`
+	Height  int    `yaml:"height"`
+	DPI     int    `yaml:"dpi"`
+	FPS     int    `yaml:"fps"`
+	GPUMode string `yaml:"gpu-mode"`
+	GPUNode string `yaml:"gpu-node"`
+}
+
+type NetworkSpec struct {
+	// Mode is bridge, host, macvlan or the name of a network
+	Mode          string   `yaml:"mode"`
+	IP            string   `yaml:"ip"`
+	Subnet        string   `yaml:"subnet"`
+	Gateway       string   `yaml:"gateway"`
+	MacvlanParent string   `yaml:"macvlan-parent"`
+	Publish       []string `yaml:"publish"`
+}
+
+type RestartSpec struct {
+	Policy string `yaml:"policy"`
+	Max    int    `yaml:"max"`
+	Delay  string `yaml:"delay"`
+}
+
+// LoadFleetSpec reads a fleet spec, unknown fields are errors
+func LoadFleetSpec(path string) (*FleetSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read fleet spec: %v", err)
+	}
+	return ParseFleetSpec(data)
+}
+
+func ParseFleetSpec(data []byte) (*FleetSpec, error) {
+	var spec FleetSpec
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("Invalid fleet spec: %v", err)
+	}
+	if spec.Defaults.Port != 0 {
+		return nil, fmt.Errorf("Invalid fleet spec: port cannot be shared in defaults")
+	}
+	if len(spec.Containers) == 0 {
+		return nil, fmt.Errorf("Invalid fleet spec: no containers declared")
+	}
+	for _, name := range spec.Names() {
+		if err := ValidateContainerName(name); err != nil {
+			return nil, fmt.Errorf("Invalid fleet spec: %v", err)
+		}
+		if port := spec.Port(name); port < 0 || port > 65535 {
+			return nil, fmt.Errorf("Invalid fleet spec: container '%s': invalid port %d", name, port)
+		}
+		if _, err := spec.Desired(name); err != nil {
+			return nil, fmt.Errorf("Invalid fleet spec: container '%s': %v", name, err)
+		}
+	}
+	return &spec, nil
+}
+
+func (s *FleetSpec) Names() []string {
+	names := make([]string, 0, len(s.Containers))
+	for name := range s.Containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Image returns the image of a container and its build, nil when pulled
+func (s *FleetSpec) Image(name string) (string, *BuildSpec) {
+	c := s.Containers[name]
+	image, build := c.Image, c.Build
+	if image == "" {
+		image = s.Defaults.Image
+	}
+	if build == nil {
+		build = s.Defaults.Build
+	}
+	return image, build
+}
+
+func (s *FleetSpec) Port(name string) int {
+	return s.Containers[name].Port
+}
+
+// Desired leaves the name, port, data path and host to the caller
+func (s *FleetSpec) Desired(name string) (*Container, error) {
+	image, build := s.Image(name)
+	if image == "" {
+		return nil, fmt.Errorf("no image, set image here or in defaults")
+	}
+	if err := ValidateImageName(image); err != nil {
+		return nil, err
+	}
+	if build != nil && (build.Android == "" || len(build.Addons) == 0) {
+		return nil, fmt.Errorf("build needs the android version and at least one addon")
+	}
+	c := &Container{Name: name, ImageURL: image, GPUMode: DefaultGPUMode, Build: build.String()}
+	// Two calls, so the container's lists replace those of the defaults
+	if err := c.ApplySettings(s.Defaults.Settings()); err != nil {
+		return nil, err
+	}
+	if err := c.ApplySettings(s.Containers[name].Settings()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c ContainerSpec) Settings() []string {
+	var pairs []string
+	add := func(key, value string) {
+		if value != "" {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+	addInt := func(key string, value int64) {
+		if value != 0 {
+			add(key, strconv.FormatInt(value, 10))
+		}
+	}
+
+	add(KeyCPUs, c.Resources.CPUs)
+	add(KeyMemory, c.Resources.Memory)
+	add(KeyCPUSet, c.Resources.CPUSet)
+	addInt(KeyPidsLimit, c.Resources.PidsLimit)
+	for _, d := range c.Devices {
+		add(KeyDevice, d)
+	}
+	for _, e := range c.Env {
+		add(KeyEnv, e)
+	}
+	for _, m := range c.Mounts {
+		add(KeyMount, m)
+	}
+	add(KeyBinder, c.Binder)
+
+	addInt(KeyWidth, int64(c.Display.Width))
+	addInt(KeyHeight, int64(c.Display.Height))
+	addInt(KeyDPI, int64(c.Display.DPI))
+	addInt(KeyFPS, int64(c.Display.FPS))
+	add(KeyGPUMode, c.Display.GPUMode)
+	add(KeyGPUNode, c.Display.GPUNode)
+	for _, key := range sortedKeys(c.Props) {
+		pairs = append(pairs, key+"="+c.Props[key])
+	}
+
+	add(KeyNetwork, c.Network.Mode)
+	add(KeyIP, c.Network.IP)
+	add(KeySubnet, c.Network.Subnet)
+	add(KeyGateway, c.Network.Gateway)
+	add(KeyMacvlanParent, c.Network.MacvlanParent)
+	for _, p := range c.Network.Publish {
+		add(KeyPublish, p)
+	}
+
+	for _, name := range sortedKeys(c.Labels) {
+		pairs = append(pairs, KeyLabel+"="+name+"="+c.Labels[name])
+	}
+
+	add(KeyRestart, c.Restart.Policy)
+	addInt(KeyRestartMax, int64(c.Restart.Max))
+	add(KeyRestartDelay, c.Restart.Delay)
+	return pairs
+}
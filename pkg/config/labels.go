@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// KeyLabel tags a container with name=value for bulk commands
+const KeyLabel = "label"
+
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_./-]*$`)
+
+func (c *Container) setLabel(value string) error {
+	if value == "" {
+		return nil
+	}
+	name, labelValue, _ := strings.Cut(value, "=")
+	if !labelNamePattern.MatchString(name) {
+		return fmt.Errorf("Invalid label '%s', expected name=value such as tier=lab", value)
+	}
+	if c.Labels == nil {
+		c.Labels = make(map[string]string)
+	}
+	c.Labels[name] = labelValue
+	return nil
+}
+
+func (c *Container) labelSettings() []string {
+	names := make([]string, 0, len(c.Labels))
+	for name := range c.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, KeyLabel+"="+name+"="+c.Labels[name])
+	}
+	return pairs
+}
+
+// MatchesLabel reports whether the container matches name=value or a bare name
+func (c *Container) MatchesLabel(selector string) bool {
+	name, value, hasValue := strings.Cut(selector, "=")
+	actual, ok := c.Labels[name]
+	if !ok {
+		return false
+	}
+	return !hasValue || actual == value
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Network keys accepted by "reddock config set"
+const (
+	KeyNetwork       = "network"
+	KeyIP            = "ip"
+	KeySubnet        = "subnet"
+	KeyGateway       = "gateway"
+	KeyMacvlanParent = "macvlan-parent"
+	KeyPublish       = "publish"
+)
+
+// Network modes besides a named user-defined network
+const (
+	NetworkBridge  = "bridge"
+	NetworkHost    = "host"
+	NetworkMacvlan = "macvlan"
+)
+
+var networkNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// setNetwork reports false for keys that are not network settings
+func (c *Container) setNetwork(key, value string) (bool, error) {
+	switch key {
+	case KeyNetwork:
+		if value != "" && !networkNamePattern.MatchString(value) {
+			return true, fmt.Errorf("Invalid network '%s' (use %s, %s, %s or a network name)", value, NetworkBridge, NetworkHost, NetworkMacvlan)
+		}
+		c.Network = value
+	case KeyIP:
+		if value != "" {
+			if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+				return true, fmt.Errorf("Invalid ip '%s', expected an IPv4 address such as 192.168.1.50", value)
+			}
+		}
+		c.IP = value
+	case KeySubnet:
+		if value != "" {
+			if _, _, err := net.ParseCIDR(value); err != nil {
+				return true, fmt.Errorf("Invalid subnet '%s', expected a CIDR such as 192.168.1.0/24", value)
+			}
+		}
+		c.Subnet = value
+	case KeyGateway:
+		if value != "" && net.ParseIP(value) == nil {
+			return true, fmt.Errorf("Invalid gateway '%s', expected an IP address", value)
+		}
+		c.Gateway = value
+	case KeyMacvlanParent:
+		c.MacvlanParent = value
+	case KeyPublish:
+		if value == "" {
+			return true, nil
+		}
+		if _, err := ParsePublish(value); err != nil {
+			return true, err
+		}
+		c.Publish = append(c.Publish, value)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// validateNetwork checks the network settings once all of them are applied
+func (c *Container) validateNetwork() error {
+	mode := c.NetworkMode()
+	switch mode {
+	case NetworkBridge:
+		if c.IP != "" {
+			return fmt.Errorf("A static ip needs a named network or macvlan, the default bridge assigns addresses itself")
+		}
+	case NetworkHost:
+		if c.IP != "" || len(c.Publish) > 0 {
+			return fmt.Errorf("Host networking uses the host's addresses and ports, drop ip and publish")
+		}
+	case NetworkMacvlan:
+		if c.MacvlanParent == "" || c.Subnet == "" {
+			return fmt.Errorf("macvlan needs the host interface and the LAN subnet, set macvlan-parent and subnet")
+		}
+	}
+	if c.IP != "" && c.Subnet != "" {
+		_, subnet, _ := net.ParseCIDR(c.Subnet)
+		if subnet != nil && !subnet.Contains(net.ParseIP(c.IP)) {
+			return fmt.Errorf("ip %s is outside subnet %s", c.IP, c.Subnet)
+		}
+	}
+	return nil
+}
+
+func (c *Container) networkSettings() []string {
+	var pairs []string
+	add := func(key, value string) {
+		if value != "" {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+	add(KeyNetwork, c.Network)
+	add(KeyIP, c.IP)
+	add(KeySubnet, c.Subnet)
+	add(KeyGateway, c.Gateway)
+	add(KeyMacvlanParent, c.MacvlanParent)
+	for _, p := range c.Publish {
+		add(KeyPublish, p)
+	}
+	return pairs
+}
+
+// NetworkMode returns the network the container joins, "bridge" when unset
+func (c *Container) NetworkMode() string {
+	if c.Network == "" {
+		return NetworkBridge
+	}
+	return c.Network
+}
+
+// NetworkName returns the engine network, one per host interface for macvlan
+func (c *Container) NetworkName() string {
+	if c.NetworkMode() == NetworkMacvlan {
+		return "reddock-macvlan-" + c.MacvlanParent
+	}
+	return c.NetworkMode()
+}
+
+// PublishesPorts reports whether the container is reached through published ports
+func (c *Container) PublishesPorts() bool {
+	mode := c.NetworkMode()
+	return mode != NetworkHost && mode != NetworkMacvlan
+}
+
+// ADBHostPort returns zero when ADB is reachable on an address of its own
+func (c *Container) ADBHostPort() int {
+	switch c.NetworkMode() {
+	case NetworkHost:
+		return DefaultADBPort
+	case NetworkMacvlan:
+		return 0
+	}
+	if c.Port == 0 {
+		return DefaultADBPort
+	}
+	return c.Port
+}
+
+// PublishedPort is an extra port published next to ADB
+type PublishedPort struct {
+	HostPort      int
+	ContainerPort int
+	Protocol      string
+}
+
+// ParsePublish parses host:container[/protocol], or a single port
+func ParsePublish(value string) (PublishedPort, error) {
+	invalid := fmt.Errorf("Invalid publish '%s', expected host-port:container-port[/tcp|udp] such as 27042:27042", value)
+	spec, proto, hasProto := strings.Cut(value, "/")
+	if hasProto && proto != "tcp" && proto != "udp" {
+		return PublishedPort{}, invalid
+	}
+	hostPart, containerPart, ok := strings.Cut(spec, ":")
+	if !ok {
+		containerPart = hostPart
+	}
+	hostPort, err1 := strconv.Atoi(hostPart)
+	containerPort, err2 := strconv.Atoi(containerPart)
+	if err1 != nil || err2 != nil || hostPort < 1 || hostPort > 65535 || containerPort < 1 || containerPort > 65535 {
+		return PublishedPort{}, invalid
+	}
+	return PublishedPort{HostPort: hostPort, ContainerPort: containerPort, Protocol: proto}, nil
+}
+
+// PublishedPorts returns the extra published ports, skipping invalid ones
+func (c *Container) PublishedPorts() []PublishedPort {
+	var ports []PublishedPort
+	for _, value := range c.Publish {
+		if p, err := ParsePublish(value); err == nil {
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
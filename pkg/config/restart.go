@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Restart policy keys accepted by "reddock config set"
+const (
+	KeyRestart      = "restart"
+	KeyRestartMax   = "restart-max"
+	KeyRestartDelay = "restart-delay"
+)
+
+// Restart policies applied by "reddock supervise"
+const (
+	RestartNo        = "no"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+var RestartPolicies = []string{RestartNo, RestartOnFailure, RestartAlways}
+
+const (
+	// DefaultRestartDelay doubles after every further attempt
+	DefaultRestartDelay = 10 * time.Second
+	// MaxRestartDelay caps the backoff between restarts
+	MaxRestartDelay = 5 * time.Minute
+)
+
+// setRestart reports false for keys that are not restart settings
+func (c *Container) setRestart(key, value string) (bool, error) {
+	switch key {
+	case KeyRestart:
+		if value != "" && !contains(RestartPolicies, value) {
+			return true, fmt.Errorf("Invalid restart policy '%s' (use %s)", value, strings.Join(RestartPolicies, ", "))
+		}
+		c.Restart = value
+	case KeyRestartMax:
+		c.RestartMax = 0
+		if value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return true, fmt.Errorf("Invalid restart-max '%s', expected a number, 0 for unlimited", value)
+			}
+			c.RestartMax = n
+		}
+	case KeyRestartDelay:
+		if value != "" {
+			if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+				return true, fmt.Errorf("Invalid restart-delay '%s', expected a duration such as 10s or 1m", value)
+			}
+		}
+		c.RestartDelay = value
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func (c *Container) restartSettings() []string {
+	var pairs []string
+	if c.Restart != "" {
+		pairs = append(pairs, KeyRestart+"="+c.Restart)
+	}
+	if c.RestartMax != 0 {
+		pairs = append(pairs, KeyRestartMax+"="+strconv.Itoa(c.RestartMax))
+	}
+	if c.RestartDelay != "" {
+		pairs = append(pairs, KeyRestartDelay+"="+c.RestartDelay)
+	}
+	return pairs
+}
+
+// RestartPolicy returns the container's restart policy, "no" when unset
+func (c *Container) RestartPolicy() string {
+	if c.Restart == "" {
+		return RestartNo
+	}
+	return c.Restart
+}
+
+// RestartBackoff doubles the restart delay per attempt up to MaxRestartDelay
+func (c *Container) RestartBackoff(attempt int) time.Duration {
+	delay := DefaultRestartDelay
+	if d, err := time.ParseDuration(c.RestartDelay); err == nil && d > 0 {
+		delay = d
+	}
+	for i := 1; i < attempt && delay < MaxRestartDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxRestartDelay {
+		delay = MaxRestartDelay
+	}
+	return delay
+}
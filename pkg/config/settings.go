@@ -0,0 +1,249 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Setting keys accepted by "reddock config set" and the matching init flags
+const (
+	KeyCPUs      = "cpus"
+	KeyMemory    = "memory"
+	KeyCPUSet    = "cpuset"
+	KeyPidsLimit = "pids-limit"
+	KeyDevice    = "device"
+	KeyEnv       = "env"
+	KeyMount     = "mount"
+	KeyBinder    = "binder"
+)
+
+// Binder modes: an own binderfs instance, the host's devices, or binderfs when supported
+const (
+	BinderAuto     = "auto"
+	BinderBinderfs = "binderfs"
+	BinderHost     = "host"
+)
+
+var BinderModes = []string{BinderAuto, BinderBinderfs, BinderHost}
+
+// listKeys hold several values, the first one given in a call replaces the list
+var listKeys = map[string]bool{
+	KeyDevice:  true,
+	KeyEnv:     true,
+	KeyMount:   true,
+	KeyPublish: true,
+	KeyLabel:   true,
+}
+
+var (
+	memoryPattern = regexp.MustCompile(`^[0-9]+[bkmgBKMG]?$`)
+	cpusetPattern = regexp.MustCompile(`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`)
+)
+
+// SettingKeys lists the keys ApplySettings understands besides raw properties
+func SettingKeys() []string {
+	keys := []string{KeyCPUs, KeyMemory, KeyCPUSet, KeyPidsLimit, KeyDevice, KeyEnv, KeyMount, KeyBinder,
+		KeyWidth, KeyHeight, KeyDPI, KeyFPS, KeyGPUMode, KeyGPUNode, KeyRestart, KeyRestartMax, KeyRestartDelay,
+		KeyNetwork, KeyIP, KeySubnet, KeyGateway, KeyMacvlanParent, KeyPublish, KeyLabel}
+	sort.Strings(keys)
+	return keys
+}
+
+// ApplySettings sets key=value pairs on a container, an empty value clears one
+func (c *Container) ApplySettings(pairs []string) error {
+	updated := *c
+	// Copy the maps so a failed call leaves the container untouched
+	updated.BootProps = nil
+	for key, value := range c.BootProps {
+		if updated.BootProps == nil {
+			updated.BootProps = make(map[string]string)
+		}
+		updated.BootProps[key] = value
+	}
+	updated.Labels = nil
+	for key, value := range c.Labels {
+		if updated.Labels == nil {
+			updated.Labels = make(map[string]string)
+		}
+		updated.Labels[key] = value
+	}
+	replaced := make(map[string]bool)
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("Invalid setting '%s', expected key=value", pair)
+		}
+		key = strings.TrimSpace(key)
+		if listKeys[key] && !replaced[key] {
+			updated.clearList(key)
+			replaced[key] = true
+		}
+		if err := updated.setOne(key, value); err != nil {
+			return err
+		}
+	}
+	if err := updated.validateNetwork(); err != nil {
+		return err
+	}
+	*c = updated
+	return nil
+}
+
+func (c *Container) clearList(key string) {
+	switch key {
+	case KeyDevice:
+		c.Devices = nil
+	case KeyEnv:
+		c.Env = nil
+	case KeyMount:
+		c.Mounts = nil
+	case KeyPublish:
+		c.Publish = nil
+	case KeyLabel:
+		c.Labels = nil
+	}
+}
+
+func (c *Container) setOne(key, value string) error {
+	switch key {
+	case KeyCPUs:
+		if value != "" {
+			if n, err := strconv.ParseFloat(value, 64); err != nil || n <= 0 {
+				return fmt.Errorf("Invalid cpus '%s', expected a positive number such as 1.5", value)
+			}
+		}
+		c.CPUs = value
+	case KeyMemory:
+		if value != "" {
+			if _, err := ParseMemorySize(value); err != nil {
+				return err
+			}
+		}
+		c.Memory = value
+	case KeyCPUSet:
+		if value != "" && !cpusetPattern.MatchString(value) {
+			return fmt.Errorf("Invalid cpuset '%s', expected a list such as 0-3,6", value)
+		}
+		c.CPUSet = value
+	case KeyPidsLimit:
+		c.PidsLimit = 0
+		if value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n == 0 || n < -1 {
+				return fmt.Errorf("Invalid pids-limit '%s', expected a positive number or -1 for unlimited", value)
+			}
+			c.PidsLimit = n
+		}
+	case KeyDevice:
+		if value == "" {
+			return nil
+		}
+		if host, _, _ := strings.Cut(value, ":"); !filepath.IsAbs(host) {
+			return fmt.Errorf("Invalid device '%s', expected /dev/path[:container-path[:permissions]]", value)
+		}
+		c.Devices = append(c.Devices, value)
+	case KeyEnv:
+		if value == "" {
+			return nil
+		}
+		if name, _, ok := strings.Cut(value, "="); !ok || name == "" {
+			return fmt.Errorf("Invalid env '%s', expected NAME=value", value)
+		}
+		c.Env = append(c.Env, value)
+	case KeyMount:
+		if value == "" {
+			return nil
+		}
+		parts := strings.SplitN(value, ":", 3)
+		if len(parts) < 2 || !filepath.IsAbs(parts[0]) || !filepath.IsAbs(parts[1]) {
+			return fmt.Errorf("Invalid mount '%s', expected /host/path:/container/path[:options]", value)
+		}
+		if parts[1] == "/data" {
+			return fmt.Errorf("Invalid mount '%s', /data is the container data directory", value)
+		}
+		c.Mounts = append(c.Mounts, value)
+	case KeyLabel:
+		return c.setLabel(value)
+	case KeyBinder:
+		if value != "" && !contains(BinderModes, value) {
+			return fmt.Errorf("Invalid binder '%s' (use %s)", value, strings.Join(BinderModes, ", "))
+		}
+		c.Binder = value
+	default:
+		if handled, err := c.setBootProp(key, value); handled {
+			return err
+		}
+		if handled, err := c.setRestart(key, value); handled {
+			return err
+		}
+		if handled, err := c.setNetwork(key, value); handled {
+			return err
+		}
+		return fmt.Errorf("Unknown setting '%s' (known: %s, ro.*, androidboot.*)", key, strings.Join(SettingKeys(), ", "))
+	}
+	return nil
+}
+
+// Settings returns the container's settings in the form ApplySettings accepts
+func (c *Container) Settings() []string {
+	var pairs []string
+	add := func(key, value string) {
+		if value != "" {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+	add(KeyCPUs, c.CPUs)
+	add(KeyMemory, c.Memory)
+	add(KeyCPUSet, c.CPUSet)
+	if c.PidsLimit != 0 {
+		add(KeyPidsLimit, strconv.FormatInt(c.PidsLimit, 10))
+	}
+	for _, d := range c.Devices {
+		add(KeyDevice, d)
+	}
+	for _, e := range c.Env {
+		add(KeyEnv, e)
+	}
+	for _, m := range c.Mounts {
+		add(KeyMount, m)
+	}
+	add(KeyBinder, c.Binder)
+	pairs = append(pairs, c.bootSettings()...)
+	pairs = append(pairs, c.networkSettings()...)
+	pairs = append(pairs, c.labelSettings()...)
+	return append(pairs, c.restartSettings()...)
+}
+
+// BinderMode returns how the container gets binder, "auto" when unset
+func (c *Container) BinderMode() string {
+	if c.Binder == "" {
+		return BinderAuto
+	}
+	return c.Binder
+}
+
+// ParseMemorySize converts a docker style size such as 512m or 4g to bytes
+func ParseMemorySize(value string) (int64, error) {
+	if !memoryPattern.MatchString(value) {
+		return 0, fmt.Errorf("Invalid memory '%s', expected a size such as 512m or 4g", value)
+	}
+	unit := int64(1)
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "k":
+		unit = 1 << 10
+	case "m":
+		unit = 1 << 20
+	case "g":
+		unit = 1 << 30
+	}
+	digits := strings.TrimRight(value, "bkmgBKMG")
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("Invalid memory '%s', expected a size such as 512m or 4g", value)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,135 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"reddock/pkg/config"
+)
+
+type Adopter struct {
+	store   config.Store
+	runtime Runtime
+}
+
+func NewAdopter() *Adopter {
+	return NewAdopterWith(config.NewFileStore(), nil)
+}
+
+func NewAdopterWith(store config.Store, runtime Runtime) *Adopter {
+	return &Adopter{store: store, runtime: runtime}
+}
+
+// Adopt imports a redroid container reddock did not create under its own name
+func (a *Adopter) Adopt(ctx context.Context, name string) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	if err := config.ValidateContainerName(name); err != nil {
+		return err
+	}
+	lock, err := lockContainer(name, "adopt")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	cfg := config.LoadOrDefault(a.store)
+	if cfg.GetContainer(name) != nil {
+		return fmt.Errorf("Container '%s' is already managed by reddock", name)
+	}
+	runtime := a.runtime
+	if runtime == nil {
+		runtime = NewRuntimeFromConfig(cfg)
+	}
+	info, err := runtime.InspectContainer(ctx, name)
+	if errors.Is(err, ErrContainerNotFound) {
+		return NewError(ErrContainerNotFound, name, "No %s container named '%s'", runtime.Name(), name).Wrap(err)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to inspect container '%s': %w", name, err)
+	}
+
+	container, err := adoptedConfig(cfg, info)
+	if err != nil {
+		return err
+	}
+	container.Runtime = runtime.Name()
+	cfg.AddContainer(container)
+	if err := a.store.Save(cfg); err != nil {
+		return fmt.Errorf("Failed to save config: %v", err)
+	}
+
+	fmt.Printf("Container '%s' adopted\n", name)
+	fmt.Printf("  Image: %s\n", container.ImageURL)
+	fmt.Printf("  Data:  %s\n", container.GetDataPath())
+	fmt.Printf("  ADB:   %s\n", ADBAddress(container))
+	if settings := container.Settings(); len(settings) > 0 {
+		fmt.Printf("  Settings: %s\n", strings.Join(settings, " "))
+	}
+	return nil
+}
+
+// adoptedConfig builds a config entry from inspect data, warning about what is lost
+func adoptedConfig(cfg *config.Config, info *ContainerInfo) (*config.Container, error) {
+	if !looksLikeRedroid(info) {
+		return nil, fmt.Errorf("Container '%s' runs %s, which does not look like a redroid image", info.Name, info.Image)
+	}
+	c := &config.Container{
+		Name:        info.Name,
+		ImageURL:    info.Image,
+		DataPath:    info.Mount("/data"),
+		LogFile:     info.Name + ".log",
+		GPUMode:     config.DefaultGPUMode,
+		Host:        ResolveHost(cfg),
+		Initialized: true,
+	}
+	if c.DataPath == "" {
+		c.DataPath = config.GetDefaultDataPath(info.Name)
+		fmt.Printf("Warning: '%s' has no /data volume, its data is lost when reddock recreates it\n", info.Name)
+	}
+
+	var publish []string
+	for _, p := range info.Bindings {
+		if p.ContainerPort == config.DefaultADBPort && p.proto() == "tcp" && c.Port == 0 {
+			c.Port = p.HostPort
+			continue
+		}
+		publish = append(publish, config.KeyPublish+"="+p.String())
+	}
+	if owner := portOwner(cfg, c.Host, c.Port, c.Name); c.Port != 0 && owner != "" {
+		fmt.Printf("Warning: ADB port %d of '%s' is also used by '%s', only one of them can run at a time\n", c.Port, info.Name, owner)
+	}
+	if c.Port == 0 {
+		port, err := AllocatePort(cfg, c.Host)
+		if err != nil {
+			return nil, err
+		}
+		c.Port = port
+		fmt.Printf("Warning: '%s' does not publish ADB, it is published on port %d once reddock recreates it\n", info.Name, port)
+	}
+
+	pairs, unknown := config.BootArgSettings(info.Args)
+	for _, arg := range unknown {
+		fmt.Printf("Warning: Not importing the argument '%s' of '%s'\n", arg, info.Name)
+	}
+	if err := c.ApplySettings(append(pairs, publish...)); err != nil {
+		return nil, fmt.Errorf("Failed to import the settings of '%s': %w", info.Name, err)
+	}
+	return c, nil
+}
+
+// looksLikeRedroid guards adopt against importing unrelated containers
+func looksLikeRedroid(info *ContainerInfo) bool {
+	if info.Managed() || strings.Contains(info.Image, "redroid") {
+		return true
+	}
+	for _, arg := range info.Args {
+		if strings.HasPrefix(arg, "androidboot.") {
+			return true
+		}
+	}
+	return false
+}
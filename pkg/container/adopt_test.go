@@ -0,0 +1,71 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"reddock/pkg/config"
+)
+
+func TestAdoptImportsContainer(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["handmade"] = &fakeContainer{
+		image:   "redroid/redroid:12.0.0-latest",
+		running: true,
+		ports:   []PortMapping{{HostPort: 5601, ContainerPort: 5555}, {HostPort: 27042, ContainerPort: 27042}},
+		mounts:  []VolumeMount{{Source: "/srv/handmade", Target: "/data"}},
+		args: []string{"androidboot.redroid_width=720", "androidboot.redroid_gpu_mode=host",
+			"ro.product.model=Pixel", "--debug"},
+	}
+	store := newMemStore()
+
+	if err := NewAdopterWith(store, rt).Adopt(context.Background(), "handmade"); err != nil {
+		t.Fatalf("Adopt: %v", err)
+	}
+	c := store.cfg.GetContainer("handmade")
+	if c == nil || !c.Initialized || c.ImageURL != "redroid/redroid:12.0.0-latest" || c.DataPath != "/srv/handmade" {
+		t.Fatalf("adopted entry = %+v", c)
+	}
+	if c.Port != 5601 || len(c.Publish) != 1 || c.Publish[0] != "27042:27042/tcp" {
+		t.Errorf("ports = %d %v", c.Port, c.Publish)
+	}
+	if c.Width != 720 || c.GPUMode != "host" || c.BootProps["ro.product.model"] != "Pixel" {
+		t.Errorf("boot args not imported: %+v", c)
+	}
+	if c.RunSpec != "" {
+		t.Error("an adopted container was not created with reddock's options")
+	}
+}
+
+func TestAdoptRefusals(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["nginx"] = &fakeContainer{image: "nginx:latest"}
+	rt.containers["android"] = &fakeContainer{image: "redroid/redroid:13.0.0-latest"}
+	store := newMemStore(testContainer(t, "android"))
+	adopter := NewAdopterWith(store, rt)
+
+	if err := adopter.Adopt(context.Background(), "missing"); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("missing container: %v", err)
+	}
+	for _, name := range []string{"nginx", "android"} {
+		if err := adopter.Adopt(context.Background(), name); err == nil {
+			t.Errorf("%s adopted", name)
+		}
+	}
+	if len(store.cfg.Containers) != 1 {
+		t.Fatal("a refused adopt changed the config")
+	}
+}
+
+func TestBootArgSettings(t *testing.T) {
+	pairs, unknown := config.BootArgSettings([]string{"androidboot.redroid_dpi=320", "androidboot.hardware=redroid", "-x"})
+	if len(pairs) != 2 || pairs[0] != "dpi=320" || pairs[1] != "androidboot.hardware=redroid" {
+		t.Errorf("pairs = %v", pairs)
+	}
+	if len(unknown) != 1 || unknown[0] != "-x" {
+		t.Errorf("unknown = %v", unknown)
+	}
+}
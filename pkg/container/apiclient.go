@@ -0,0 +1,216 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// apiClient is a minimal HTTP client for container engine REST APIs
+type apiClient struct {
+	endpoint *Endpoint
+	baseURL  string
+	http     *http.Client
+	// setupErr records a TLS configuration failure, reported on first use
+	setupErr error
+}
+
+func newAPIClient(ep *Endpoint, prefix string) *apiClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return ep.dial(ctx)
+		},
+	}
+	c := &apiClient{
+		endpoint: ep,
+		baseURL:  "http://localhost" + prefix,
+		http:     &http.Client{Transport: transport},
+	}
+	if ep.Scheme == "tcp" && tlsEnabled() {
+		transport.TLSClientConfig, c.setupErr = tlsConfig(ep.Host)
+		c.baseURL = "https://" + ep.Host + prefix
+	}
+	return c
+}
+
+func unixEndpoint(socketPath string) *Endpoint {
+	return &Endpoint{Scheme: "unix", Path: socketPath}
+}
+
+// APIError is returned when the engine answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("engine API returned status %d", e.StatusCode)
+	}
+	return e.Message
+}
+
+func isStatus(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// classify maps a 404 answer onto the matching sentinel error kind
+func classify(err error, kind error, name string) error {
+	if isStatus(err, http.StatusNotFound) {
+		return &Error{Kind: kind, Container: name, Err: err}
+	}
+	return err
+}
+
+// do returns the response of 2xx and 304 answers, the caller closes its body
+func (c *apiClient) do(ctx context.Context, method, path string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	if c.setupErr != nil {
+		return nil, NewError(ErrRuntimeUnavailable, "", "Cannot connect to the engine at %s", c.endpoint).Wrap(c.setupErr)
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ContextError(ctx, err)
+		}
+		return nil, NewError(ErrRuntimeUnavailable, "", "Cannot connect to the engine at %s", c.endpoint).Wrap(err)
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var payload struct {
+		Message string `json:"message"`
+		Cause   string `json:"cause"`
+	}
+	if json.Unmarshal(data, &payload) == nil && payload.Message != "" {
+		apiErr.Message = payload.Message
+	} else {
+		apiErr.Message = string(bytes.TrimSpace(data))
+	}
+	return nil, apiErr
+}
+
+func (c *apiClient) doJSON(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	header := http.Header{}
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.do(ctx, method, path, query, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return ContextError(ctx, json.NewDecoder(resp.Body).Decode(out))
+}
+
+func (c *apiClient) ping(ctx context.Context, path string) bool {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+type streamMessage struct {
+	Status      string `json:"status"`
+	ID          string `json:"id"`
+	Progress    string `json:"progress"`
+	Stream      string `json:"stream"`
+	Error       string `json:"error"`
+	ErrorDetail struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+// readStream echoes a progress stream to out and returns its first error
+func readStream(r io.Reader, out io.Writer) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var msg streamMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("%s", msg.Error)
+		}
+		if msg.ErrorDetail.Message != "" {
+			return fmt.Errorf("%s", msg.ErrorDetail.Message)
+		}
+		if out == nil {
+			continue
+		}
+		switch {
+		case msg.Stream != "":
+			fmt.Fprint(out, msg.Stream)
+		case msg.Status != "" && msg.Progress == "":
+			if msg.ID != "" {
+				fmt.Fprintf(out, "%s: %s\n", msg.ID, msg.Status)
+			} else {
+				fmt.Fprintln(out, msg.Status)
+			}
+		}
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,86 @@
+package container
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+type authFile struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+}
+
+// DockerConfigPath returns the docker CLI credentials file
+func DockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".docker", "config.json")
+}
+
+func registryHost(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return dockerHubRegistry
+}
+
+func lookupCredentials(authPath, registry string) (string, string, bool) {
+	data, err := os.ReadFile(authPath)
+	if err != nil {
+		return "", "", false
+	}
+	var file authFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", "", false
+	}
+
+	candidates := []string{registry}
+	if registry == dockerHubRegistry {
+		candidates = append(candidates, "docker.io", "index.docker.io", "registry-1.docker.io")
+	} else {
+		candidates = append(candidates, "https://"+registry, "http://"+registry)
+	}
+
+	for _, key := range candidates {
+		entry, ok := file.Auths[key]
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return "", "", true
+		}
+		user, pass, _ := strings.Cut(string(decoded), ":")
+		return user, pass, true
+	}
+	return "", "", false
+}
+
+func registryAuthHeader(authPath, image string) string {
+	registry := registryHost(image)
+	payload := map[string]string{}
+	if user, pass, ok := lookupCredentials(authPath, registry); ok && user != "" {
+		payload["username"] = user
+		payload["password"] = pass
+		payload["serveraddress"] = registry
+	}
+	data, _ := json.Marshal(payload)
+	return base64.URLEncoding.EncodeToString(data)
+}
+
+func splitImageTag(image string) (string, string) {
+	slash := strings.LastIndex(image, "/")
+	colon := strings.LastIndex(image, ":")
+	if colon > slash {
+		return image[:colon], image[colon+1:]
+	}
+	return image, "latest"
+}
@@ -0,0 +1,109 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"reddock/pkg/config"
+)
+
+// BinderfsRoot holds the binderfs instance of each container
+const BinderfsRoot = "/run/reddock/binderfs"
+
+var binderDevices = []string{"binder", "hwbinder", "vndbinder"}
+
+func BinderfsPath(containerName string) string {
+	return filepath.Join(BinderfsRoot, containerName)
+}
+
+// binderfsDir returns the binderfs mount of a container, empty for host devices
+func binderfsDir(c *config.Container) string {
+	if c.IsRemote() {
+		return ""
+	}
+	switch c.BinderMode() {
+	case config.BinderHost:
+		return ""
+	case config.BinderAuto:
+		// A regular user cannot mount binderfs
+		if !binderfsSupported() || os.Getuid() != 0 {
+			return ""
+		}
+	}
+	return BinderfsPath(c.Name)
+}
+
+// checkBinderDevices makes sure rootless podman can open the devices in dir
+func checkBinderDevices(dir string) error {
+	for _, name := range binderDevices {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			return NewError(ErrBinderMissing, "", "%s is missing, as root run 'modprobe binder_linux devices=binder,hwbinder,vndbinder' first", path)
+		}
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			return NewError(ErrBinderMissing, "", "%s is not read-writable by this user, so rootless podman cannot pass it in. As root run 'chmod 0666 %s'", path, path)
+		}
+		f.Close()
+	}
+	return nil
+}
+
+var binderfsSupported = func() bool {
+	data, err := os.ReadFile("/proc/filesystems")
+	if err != nil {
+		return false
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) > 0 && fields[len(fields)-1] == "binder" {
+			return true
+		}
+	}
+	return false
+}
+
+// setupBinderfs mounts binderfs on dir and creates the devices, it is idempotent
+var setupBinderfs = func(dir string) error {
+	if os.Getuid() != 0 {
+		return NewError(ErrBinderMissing, "", "Mounting binderfs needs root, rootless podman can only use the host binder devices (binder=host)")
+	}
+	if !binderfsSupported() {
+		// binderfs is part of the binder driver, loading it may add it
+		exec.Command("modprobe", "binder_linux").Run()
+		if !binderfsSupported() {
+			return NewError(ErrBinderMissing, "", "The kernel has no binderfs support, use binder=host")
+		}
+	}
+	if err := mountBinderfs(dir); err != nil {
+		return NewError(ErrBinderMissing, "", "Failed to mount binderfs on %s", dir).Wrap(err)
+	}
+	for _, name := range binderDevices {
+		if err := addBinderDevice(dir, name); err != nil {
+			return NewError(ErrBinderMissing, "", "Failed to create %s in %s", name, dir).Wrap(err)
+		}
+	}
+	return nil
+}
+
+var removeBinderfs = func(dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	if err := unmountBinderfs(dir); err != nil {
+		return fmt.Errorf("Failed to unmount %s: %v", dir, err)
+	}
+	return os.Remove(dir)
+}
+
+func binderDeviceMappings(dir string) []string {
+	var devices []string
+	for _, name := range binderDevices {
+		devices = append(devices, filepath.Join(dir, name)+":/dev/"+name)
+	}
+	return devices
+}
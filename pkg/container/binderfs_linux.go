@@ -0,0 +1,64 @@
+//go:build linux
+
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// binderfsMagic is BINDERFS_SUPER_MAGIC from linux/magic.h
+	binderfsMagic = 0x6c6f6f70
+	// binderCtlAdd is BINDER_CTL_ADD, _IOWR('b', 1, struct binderfs_device)
+	binderCtlAdd = 0xc1086201
+)
+
+// binderfsDevice mirrors struct binderfs_device from linux/android/binderfs.h
+type binderfsDevice struct {
+	Name  [256]byte
+	Major uint32
+	Minor uint32
+}
+
+func mountBinderfs(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err == nil && int64(st.Type) == binderfsMagic {
+		return nil
+	}
+	return syscall.Mount("binder", dir, "binder", 0, "")
+}
+
+// addBinderDevice asks binder-control for a new device
+func addBinderDevice(dir, name string) error {
+	if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+		return nil
+	}
+	control, err := os.OpenFile(filepath.Join(dir, "binder-control"), os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer control.Close()
+
+	var device binderfsDevice
+	copy(device.Name[:len(device.Name)-1], name)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, control.Fd(), binderCtlAdd, uintptr(unsafe.Pointer(&device)))
+	if errno != 0 && !errors.Is(errno, syscall.EEXIST) {
+		return errno
+	}
+	return nil
+}
+
+func unmountBinderfs(dir string) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil || int64(st.Type) != binderfsMagic {
+		return nil
+	}
+	return syscall.Unmount(dir, syscall.MNT_DETACH)
+}
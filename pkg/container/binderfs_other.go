@@ -0,0 +1,19 @@
+//go:build !linux
+
+package container
+
+import "errors"
+
+var errNoBinderfs = errors.New("binderfs is only available on Linux")
+
+func mountBinderfs(dir string) error {
+	return errNoBinderfs
+}
+
+func addBinderDevice(dir, name string) error {
+	return errNoBinderfs
+}
+
+func unmountBinderfs(dir string) error {
+	return nil
+}
@@ -0,0 +1,152 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"reddock/pkg/config"
+	"reddock/pkg/ui"
+)
+
+var bootPollInterval = 2 * time.Second
+
+var errNoBootProbe = errors.New("no way to query the boot state")
+
+// WaitForBoot blocks until Android has booted and returns the boot duration
+func (m *Manager) WaitForBoot(ctx context.Context, timeout time.Duration) (time.Duration, error) {
+	container, info, err := m.bootTarget(ctx)
+	if err != nil {
+		return 0, err
+	}
+	startedAt := info.StartedAt
+	if startedAt.IsZero() {
+		startedAt = time.Now()
+	}
+
+	var waitCtx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		timeout = m.config.Timeout(config.OpBoot)
+		waitCtx, cancel = WithTimeout(ctx, m.config, config.OpBoot)
+	}
+	defer cancel()
+
+	events, errs := m.runtime.Events(waitCtx, []string{m.containerName})
+	ticker := time.NewTicker(bootPollInterval)
+	defer ticker.Stop()
+
+	spinner := ui.NewSpinner(fmt.Sprintf("Waiting for '%s' to finish booting...", m.containerName))
+	spinner.Start()
+
+	for {
+		done, err := m.bootCompleted(waitCtx, container)
+		if errors.Is(err, errNoBootProbe) {
+			spinner.Finish("Cannot check the boot state")
+			return 0, NewError(ErrRuntimeUnavailable, m.containerName,
+				"Cannot check whether '%s' booted: %s exec is unavailable and adb is not installed", m.containerName, m.runtime.Name())
+		}
+		if done {
+			elapsed := time.Since(startedAt).Round(time.Second)
+			spinner.Finish(fmt.Sprintf("Container '%s' booted in %s", m.containerName, elapsed))
+			return elapsed, nil
+		}
+
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if err := diedError(m.containerName, ev, "booting"); err != nil {
+				spinner.Finish(fmt.Sprintf("Container '%s' died while booting", m.containerName))
+				return 0, err
+			}
+		case err, ok := <-errs:
+			// The ticker below keeps checking the container state
+			errs = nil
+			if ok && err != nil && waitCtx.Err() == nil {
+				fmt.Printf("\nWarning: %v, polling the container state instead\n", err)
+			}
+		case <-ticker.C:
+			// Covers runtimes without an event stream
+			if !m.runtime.IsRunning(waitCtx, m.containerName) && waitCtx.Err() == nil {
+				spinner.Finish(fmt.Sprintf("Container '%s' died while booting", m.containerName))
+				return 0, NewError(ErrContainerDied, m.containerName,
+					"Container '%s' stopped while booting. See 'reddock log %s'", m.containerName, m.containerName)
+			}
+		case <-waitCtx.Done():
+			spinner.Finish(fmt.Sprintf("Container '%s' did not finish booting", m.containerName))
+			if ctx.Err() != nil {
+				return 0, ContextError(ctx, ctx.Err())
+			}
+			return 0, NewError(ErrTimeout, m.containerName,
+				"Container '%s' did not finish booting within %s", m.containerName, timeout)
+		}
+	}
+}
+
+// bootTarget holds the lock only for the lookup so stop works during a boot
+func (m *Manager) bootTarget(ctx context.Context) (*config.Container, *ContainerInfo, error) {
+	lock, err := m.lock("wait")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer lock.Unlock()
+	container := m.config.GetContainer(m.containerName)
+	if container == nil {
+		return nil, nil, notFoundError(m.containerName)
+	}
+	info, err := m.runtime.InspectContainer(ctx, m.containerName)
+	if err != nil || !info.Running {
+		return nil, nil, notRunningError(m.containerName)
+	}
+	return container, info, nil
+}
+
+func (m *Manager) bootCompleted(ctx context.Context, container *config.Container) (bool, error) {
+	output, err := m.runtime.Command(ctx, "exec", m.containerName, "getprop", "sys.boot_completed").Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		output, err = adbGetprop(ctx, ADBAddress(container), "sys.boot_completed")
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return false, errNoBootProbe
+	}
+	if err != nil {
+		return false, nil
+	}
+	return strings.TrimSpace(string(output)) == "1", nil
+}
+
+func adbGetprop(ctx context.Context, address, prop string) ([]byte, error) {
+	if err := exec.CommandContext(ctx, "adb", "connect", address).Run(); err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(ctx, "adb", "-s", address, "shell", "getprop", prop).Output()
+}
+
+func diedError(containerName string, ev Event, phase string) error {
+	switch ev.Action {
+	case "oom":
+		return NewError(ErrContainerDied, containerName,
+			"Container '%s' was killed by the OOM killer while %s", containerName, phase)
+	case "die":
+		code := "unknown"
+		if ev.ExitCode != nil {
+			code = fmt.Sprint(*ev.ExitCode)
+		}
+		return NewError(ErrContainerDied, containerName,
+			"Container '%s' exited with code %s while %s. See 'reddock log %s'", containerName, code, phase, containerName)
+	}
+	return nil
+}
+
+func (m *Manager) FollowLogs(ctx context.Context) error {
+	fmt.Println("\nShowing container logs (Ctrl+C to detach)...")
+	return m.showLogs(ctx)
+}
@@ -0,0 +1,99 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitForBootCompleted(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	rt.execOutput = "1\n"
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if _, err := mgr.WaitForBoot(context.Background(), time.Second); err != nil {
+		t.Fatalf("WaitForBoot: %v", err)
+	}
+	if !rt.called("Command exec android getprop sys.boot_completed") {
+		t.Errorf("boot state was not queried through exec, calls: %v", rt.calls)
+	}
+}
+
+func TestWaitForBootTimeout(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	_, err := mgr.WaitForBoot(context.Background(), 50*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) || errors.Is(err, ErrContainerDied) {
+		t.Fatalf("err = %v, want ErrTimeout", err)
+	}
+}
+
+func TestWaitForBootContainerDies(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	code := 1
+	rt.events = make(chan Event, 1)
+	rt.events <- Event{Container: "android", Action: "die", ExitCode: &code}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	_, err := mgr.WaitForBoot(context.Background(), time.Second)
+	if !errors.Is(err, ErrContainerDied) {
+		t.Fatalf("err = %v, want ErrContainerDied", err)
+	}
+}
+
+func TestWaitForBootNoticesStopWithoutEvents(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		rt.Stop(context.Background(), "android")
+	}()
+	_, err := mgr.WaitForBoot(context.Background(), time.Second)
+	if !errors.Is(err, ErrContainerDied) {
+		t.Fatalf("err = %v, want ErrContainerDied", err)
+	}
+}
+
+func TestWaitForBootNotRunning(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if _, err := mgr.WaitForBoot(context.Background(), time.Second); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("err = %v, want ErrNotRunning", err)
+	}
+}
+
+func TestStopWhileWaitingForBoot(t *testing.T) {
+	stubHost(t)
+	store := newMemStore(testContainer(t, "android"))
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := NewManagerWith(store, rt, "android").WaitForBoot(context.Background(), time.Second)
+		waited <- err
+	}()
+	for !rt.called("Command exec android") {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := NewManagerWith(store, rt, "android").Stop(context.Background(), false); err != nil {
+		t.Fatalf("Stop during a boot wait: %v", err)
+	}
+	if err := <-waited; !errors.Is(err, ErrContainerDied) {
+		t.Errorf("WaitForBoot after the stop = %v, want ErrContainerDied", err)
+	}
+}
@@ -0,0 +1,278 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"reddock/pkg/config"
+	"reddock/pkg/ui"
+)
+
+// DefaultParallel is how many containers bulk commands handle at once
+const DefaultParallel = 4
+
+// Selector picks containers by name, glob pattern, label or all of them
+type Selector struct {
+	Names []string
+	All   bool
+	// Labels are name=value or bare name selectors that must all match
+	Labels []string
+}
+
+func (s Selector) Empty() bool {
+	return len(s.Names) == 0 && !s.All && len(s.Labels) == 0
+}
+
+func isPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// Resolve returns the selected names sorted, plain names must exist and
+// patterns must match
+func (s Selector) Resolve(cfg *config.Config) ([]string, error) {
+	selected := make(map[string]bool)
+	if s.All || (len(s.Names) == 0 && len(s.Labels) > 0) {
+		for name := range cfg.Containers {
+			selected[name] = true
+		}
+	}
+	for _, name := range s.Names {
+		if !isPattern(name) {
+			if cfg.GetContainer(name) == nil {
+				return nil, notFoundError(name)
+			}
+			selected[name] = true
+			continue
+		}
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern '%s': %v", name, err)
+		}
+		matched := false
+		for candidate := range cfg.Containers {
+			if ok, _ := path.Match(name, candidate); ok {
+				selected[candidate] = true
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, NewError(ErrContainerNotFound, "", "No containers match '%s'", name)
+		}
+	}
+
+	var names []string
+	for name := range selected {
+		if matchesLabels(cfg.GetContainer(name), s.Labels) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 && len(s.Labels) > 0 {
+		return nil, NewError(ErrContainerNotFound, "", "No containers match the labels %s", strings.Join(s.Labels, ", "))
+	}
+	if len(names) == 0 {
+		return nil, NewError(ErrContainerNotFound, "", "No Reddock containers found")
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func matchesLabels(c *config.Container, labels []string) bool {
+	for _, label := range labels {
+		if !c.MatchesLabel(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// BulkFunc runs an operation on one container through store
+type BulkFunc func(ctx context.Context, store config.Store, name string) error
+
+type BulkResult struct {
+	Name    string
+	Err     error
+	Elapsed time.Duration
+}
+
+// BulkError unwraps to every failure, so errors.Is finds any of their kinds
+type BulkError struct {
+	Verb   string
+	Total  int
+	Failed []BulkResult
+}
+
+func (e *BulkError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d containers failed to %s:", len(e.Failed), e.Total, e.Verb)
+	for _, r := range e.Failed {
+		fmt.Fprintf(&b, "\n  %s: %v", r.Name, r.Err)
+	}
+	return b.String()
+}
+
+func (e *BulkError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, r := range e.Failed {
+		errs = append(errs, r.Err)
+	}
+	return errs
+}
+
+// NewBulkError returns nil when every result succeeded
+func NewBulkError(verb string, results []BulkResult) error {
+	var failed []BulkResult
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &BulkError{Verb: verb, Total: len(results), Failed: failed}
+}
+
+// Bulk runs one operation on many containers with bounded parallelism
+type Bulk struct {
+	store    config.Store
+	parallel int
+	out      io.Writer
+	// saveMu serializes the config saves of concurrent operations
+	saveMu sync.Mutex
+}
+
+func NewBulk(parallel int) *Bulk {
+	return NewBulkWith(config.NewFileStore(), parallel, os.Stdout)
+}
+
+func NewBulkWith(store config.Store, parallel int, out io.Writer) *Bulk {
+	if parallel < 1 {
+		parallel = DefaultParallel
+	}
+	return &Bulk{store: store, parallel: parallel, out: out}
+}
+
+func (b *Bulk) Select(sel Selector) ([]string, error) {
+	return sel.Resolve(config.LoadOrDefault(b.store))
+}
+
+// Run applies op to every named container, printing progress and a summary
+func (b *Bulk) Run(ctx context.Context, names []string, verb string, op BulkFunc) error {
+	if len(names) == 1 {
+		return op(ctx, b.store, names[0])
+	}
+
+	fmt.Fprintf(b.out, "Running '%s' on %d containers, %d at a time\n", verb, len(names), b.parallel)
+	var printMu sync.Mutex
+	finished := 0
+	results := b.each(ctx, names, op, func(r BulkResult) {
+		printMu.Lock()
+		defer printMu.Unlock()
+		finished++
+		if r.Err != nil {
+			fmt.Fprintf(b.out, "[%d/%d] ✘ %s: %v\n", finished, len(names), r.Name, r.Err)
+		} else {
+			fmt.Fprintf(b.out, "[%d/%d] ✔ %s (%s)\n", finished, len(names), r.Name, r.Elapsed.Round(100*time.Millisecond))
+		}
+	})
+
+	err := NewBulkError(verb, results)
+	if err == nil {
+		fmt.Fprintf(b.out, "'%s' succeeded on all %d containers\n", verb, len(names))
+	}
+	return err
+}
+
+// Each applies op quietly and returns the results in the order of names
+func (b *Bulk) Each(ctx context.Context, names []string, op BulkFunc) []BulkResult {
+	return b.each(ctx, names, op, nil)
+}
+
+func (b *Bulk) each(ctx context.Context, names []string, op BulkFunc, done func(BulkResult)) []BulkResult {
+	// Concurrent spinners would overwrite each other's lines
+	if len(names) > 1 {
+		ui.SetQuiet(true)
+		defer ui.SetQuiet(false)
+	}
+
+	results := make([]BulkResult, len(names))
+	slots := make(chan struct{}, b.parallel)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		results[i].Name = name
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ContextError(ctx, ctx.Err())
+			if done != nil {
+				done(results[i])
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(r *BulkResult) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			started := time.Now()
+			r.Err = op(ctx, &containerStore{bulk: b, name: r.Name}, r.Name)
+			r.Elapsed = time.Since(started)
+			if done != nil {
+				done(*r)
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// containerStore scopes the bulk store to one container, a save merges only
+// that container into the latest config
+type containerStore struct {
+	bulk *Bulk
+	name string
+}
+
+func (s *containerStore) Load() (*config.Config, error) {
+	s.bulk.saveMu.Lock()
+	defer s.bulk.saveMu.Unlock()
+	cfg, err := s.bulk.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	// A private deep copy, stores may hand out a shared config
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to copy config: %v", err)
+	}
+	var copied config.Config
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("Failed to copy config: %v", err)
+	}
+	if copied.Containers == nil {
+		copied.Containers = make(map[string]*config.Container)
+	}
+	return &copied, nil
+}
+
+func (s *containerStore) Save(cfg *config.Config) error {
+	s.bulk.saveMu.Lock()
+	defer s.bulk.saveMu.Unlock()
+	latest, err := s.bulk.store.Load()
+	if err != nil {
+		return err
+	}
+	if c := cfg.GetContainer(s.name); c != nil {
+		saved := *c
+		latest.AddContainer(&saved)
+	} else {
+		latest.RemoveContainer(s.name)
+	}
+	return s.bulk.store.Save(latest)
+}
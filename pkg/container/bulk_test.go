@@ -0,0 +1,155 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"reddock/pkg/config"
+)
+
+func labelled(t *testing.T, name string, labels ...string) *config.Container {
+	t.Helper()
+	c := testContainer(t, name)
+	var pairs []string
+	for _, label := range labels {
+		pairs = append(pairs, "label="+label)
+	}
+	if err := c.ApplySettings(pairs); err != nil {
+		t.Fatalf("labels %v: %v", labels, err)
+	}
+	return c
+}
+
+func TestSelectorResolve(t *testing.T) {
+	cfg := newMemStore(
+		labelled(t, "farm-1", "tier=lab"),
+		labelled(t, "farm-2", "tier=ci"),
+		labelled(t, "pixel", "tier=lab", "gpu"),
+	).cfg
+
+	tests := []struct {
+		sel  Selector
+		want string
+	}{
+		{Selector{Names: []string{"pixel", "farm-1"}}, "farm-1 pixel"},
+		{Selector{Names: []string{"farm-*"}}, "farm-1 farm-2"},
+		{Selector{All: true}, "farm-1 farm-2 pixel"},
+		{Selector{Labels: []string{"tier=lab"}}, "farm-1 pixel"},
+		{Selector{Labels: []string{"tier=lab", "gpu"}}, "pixel"},
+		{Selector{Names: []string{"farm-*"}, Labels: []string{"tier=ci"}}, "farm-2"},
+		{Selector{Names: []string{"farm-1", "farm-?"}}, "farm-1 farm-2"},
+	}
+	for _, tt := range tests {
+		names, err := tt.sel.Resolve(cfg)
+		if err != nil {
+			t.Errorf("Resolve(%+v): %v", tt.sel, err)
+			continue
+		}
+		if got := strings.Join(names, " "); got != tt.want {
+			t.Errorf("Resolve(%+v) = %q, want %q", tt.sel, got, tt.want)
+		}
+	}
+
+	for _, sel := range []Selector{
+		{Names: []string{"missing"}},
+		{Names: []string{"emu-*"}},
+		{Labels: []string{"tier=prod"}},
+	} {
+		if _, err := sel.Resolve(cfg); !errors.Is(err, ErrContainerNotFound) {
+			t.Errorf("Resolve(%+v) error = %v, want not found", sel, err)
+		}
+	}
+}
+
+func TestBulkRunBoundsParallelism(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e", "f"}
+	var out bytes.Buffer
+	bulk := NewBulkWith(newMemStore(), 2, &out)
+
+	var mu sync.Mutex
+	running, peak, ran := 0, 0, 0
+	release := make(chan struct{})
+	go func() {
+		for range names {
+			release <- struct{}{}
+		}
+	}()
+	err := bulk.Run(context.Background(), names, "start", func(ctx context.Context, store config.Store, name string) error {
+		mu.Lock()
+		running++
+		ran++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if ran != len(names) || peak > 2 {
+		t.Fatalf("ran %d with a peak of %d at once, want %d with at most 2", ran, peak, len(names))
+	}
+	if !strings.Contains(out.String(), "[6/6] ✔") {
+		t.Fatalf("progress not printed:\n%s", out.String())
+	}
+}
+
+func TestBulkRunAggregatesErrors(t *testing.T) {
+	var out bytes.Buffer
+	bulk := NewBulkWith(newMemStore(), 0, &out)
+
+	err := bulk.Run(context.Background(), []string{"a", "b", "c"}, "stop", func(ctx context.Context, store config.Store, name string) error {
+		if name == "b" {
+			return notRunningError(name)
+		}
+		return nil
+	})
+
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) || len(bulkErr.Failed) != 1 || bulkErr.Total != 3 {
+		t.Fatalf("Run error = %v, want one of three failed", err)
+	}
+	if !errors.Is(err, ErrNotRunning) {
+		t.Fatal("the aggregated error should keep the kind of its failures")
+	}
+	if !strings.HasPrefix(err.Error(), "1 of 3 containers failed to stop:\n  b: ") {
+		t.Fatalf("summary = %q", err.Error())
+	}
+	if !strings.Contains(out.String(), "✘ b:") {
+		t.Fatalf("failure not reported:\n%s", out.String())
+	}
+}
+
+func TestBulkKeepsConcurrentSaves(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	names := []string{"a", "b", "c", "d"}
+	var containers []*config.Container
+	for _, name := range names {
+		rt.containers[name] = &fakeContainer{running: true}
+		containers = append(containers, testContainer(t, name))
+	}
+	store := newMemStore(containers...)
+
+	err := NewBulkWith(store, 4, &bytes.Buffer{}).Run(context.Background(), names, "stop",
+		func(ctx context.Context, store config.Store, name string) error {
+			return NewManagerWith(store, rt, name).Stop(ctx, false)
+		})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, name := range names {
+		if !store.cfg.GetContainer(name).Stopped {
+			t.Errorf("stop mark of %s lost", name)
+		}
+	}
+}
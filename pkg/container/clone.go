@@ -0,0 +1,217 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"reddock/pkg/config"
+	"reddock/pkg/ui"
+)
+
+var selinuxEnabled = func() bool {
+	_, err := os.Stat("/sys/fs/selinux/enforce")
+	return err == nil
+}
+
+// copyData copies src to dst keeping ownership, links, xattrs and SELinux labels
+var copyData = func(ctx context.Context, src, dst string) error {
+	preserve := "--preserve=xattr"
+	if selinuxEnabled() {
+		preserve += ",context"
+	}
+	cmd := exec.CommandContext(ctx, "cp", "-a", preserve, "--reflink=auto", src, dst)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// CloneOptions tune how a container is cloned
+type CloneOptions struct {
+	// StopSource stops a running source for the copy and starts it again
+	StopSource bool
+	DataPath   string
+}
+
+type Cloner struct {
+	store   config.Store
+	config  *config.Config
+	runtime Runtime
+}
+
+func NewCloner() *Cloner {
+	return NewClonerWith(config.NewFileStore(), nil)
+}
+
+func NewClonerWith(store config.Store, runtime Runtime) *Cloner {
+	return &Cloner{store: store, config: config.LoadOrDefault(store), runtime: runtime}
+}
+
+// Clone copies src into a new, stopped container dst
+func (c *Cloner) Clone(ctx context.Context, src, dst string, opts CloneOptions) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	if err := config.ValidateContainerName(dst); err != nil {
+		return err
+	}
+
+	source := c.config.GetContainer(src)
+	if source == nil {
+		return notFoundError(src)
+	}
+	if !source.Initialized {
+		return NewError(ErrNotInitialized, src,
+			"Container '%s' is not initialized. Run 'reddock init %s' first", src, src)
+	}
+	if source.IsRemote() {
+		return fmt.Errorf("Container '%s' runs on %s, its data cannot be copied from here", src, source.Host)
+	}
+	if c.config.GetContainer(dst) != nil {
+		return fmt.Errorf("Container '%s' already exists", dst)
+	}
+	runtime := c.runtime
+	if runtime == nil {
+		runtime = NewRuntimeForContainer(c.config, source)
+	}
+	if runtime.Exists(ctx, dst) {
+		return fmt.Errorf("A %s container named '%s' already exists, remove it or pick another name", runtime.Name(), dst)
+	}
+
+	lock, err := lockContainer(dst, "clone")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	clone, err := c.cloneConfig(source, dst, opts.DataPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(clone.DataPath); err == nil {
+		return fmt.Errorf("Data directory %s already exists", clone.DataPath)
+	}
+
+	if runtime.IsRunning(ctx, src) {
+		if !opts.StopSource {
+			fmt.Printf("Warning: '%s' is running, the copy may be inconsistent. Use --stop to stop it while copying\n", src)
+		} else {
+			if err := NewManagerWith(c.store, runtime, src).Stop(ctx, false); err != nil {
+				return err
+			}
+			defer func() {
+				// Bring the source back even when the clone was canceled
+				if err := NewManagerWith(c.store, runtime, src).Start(context.WithoutCancel(ctx), false); err != nil {
+					fmt.Printf("Warning: Failed to start '%s' again: %v\n", src, err)
+				}
+			}()
+		}
+	}
+
+	// Stopping and starting the source take the lock themselves
+	srcLock, err := lockContainer(src, "clone")
+	if err != nil {
+		return err
+	}
+	err = c.copyDataDir(ctx, source.GetDataPath(), clone.DataPath)
+	srcLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Reload, a restarted source may have saved the config meanwhile
+	cfg := config.LoadOrDefault(c.store)
+	if cfg.GetContainer(dst) != nil {
+		os.RemoveAll(clone.DataPath)
+		return fmt.Errorf("Container '%s' already exists", dst)
+	}
+	cfg.AddContainer(clone)
+	if err := c.store.Save(cfg); err != nil {
+		os.RemoveAll(clone.DataPath)
+		return fmt.Errorf("Failed to save config: %v", err)
+	}
+	c.config = cfg
+
+	fmt.Printf("Container '%s' cloned from '%s'\n", dst, src)
+	fmt.Printf("  Data: %s\n", clone.DataPath)
+	fmt.Printf("  ADB:  %s\n", ADBAddress(clone))
+	fmt.Printf("Start it with 'sudo reddock start %s'\n", dst)
+	return nil
+}
+
+// cloneConfig copies source, dropping the ports and ip two containers cannot share
+func (c *Cloner) cloneConfig(source *config.Container, dst, dataPath string) (*config.Container, error) {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to copy the configuration: %v", err)
+	}
+	var clone config.Container
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, fmt.Errorf("Failed to copy the configuration: %v", err)
+	}
+
+	clone.Name = dst
+	clone.LogFile = dst + ".log"
+	clone.RunSpec = ""
+	clone.Stopped = false
+	clone.Initialized = true
+	if dataPath == "" {
+		dataPath = filepath.Join(filepath.Dir(source.GetDataPath()), "data-"+dst)
+	}
+	if clone.DataPath, err = filepath.Abs(dataPath); err != nil {
+		return nil, fmt.Errorf("Invalid data path '%s': %v", dataPath, err)
+	}
+
+	switch {
+	case clone.PublishesPorts():
+		port, err := AllocatePort(c.config, clone.Host)
+		if err != nil {
+			return nil, err
+		}
+		clone.Port = port
+	case clone.NetworkMode() == config.NetworkHost:
+		fmt.Printf("Warning: '%s' and '%s' share the host's network, only one of them can run at a time\n", source.Name, dst)
+	}
+	if clone.IP != "" {
+		fmt.Printf("Warning: Not copying the static ip %s of '%s', set one with 'reddock config set %s ip=<address>'\n", clone.IP, source.Name, dst)
+		clone.IP = ""
+	}
+	if len(clone.Publish) > 0 {
+		fmt.Printf("Warning: Not copying the published ports %s of '%s', they would clash\n", strings.Join(clone.Publish, ", "), source.Name)
+		clone.Publish = nil
+	}
+	return &clone, nil
+}
+
+func (c *Cloner) copyDataDir(ctx context.Context, src, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return fmt.Errorf("Failed to create data directory: %v", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("Failed to create data directory: %v", err)
+	}
+
+	ctx, cancel := WithTimeout(ctx, c.config, config.OpClone)
+	defer cancel()
+
+	spinner := ui.NewSpinner(fmt.Sprintf("Copying %s to %s...", src, dst))
+	spinner.Start()
+	if err := copyData(ctx, src, dst); err != nil {
+		spinner.Finish("Failed to copy the data directory")
+		os.RemoveAll(dst)
+		if ctx.Err() != nil {
+			return ContextError(ctx, ctx.Err())
+		}
+		return fmt.Errorf("Failed to copy data directory: %v", err)
+	}
+	spinner.Finish(fmt.Sprintf("Copied %s to %s", src, dst))
+	return nil
+}
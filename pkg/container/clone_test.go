@@ -0,0 +1,127 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubCopy replaces the data copy with a plain file copy recording its
+// calls
+func stubCopy(t *testing.T, fail error) *[]string {
+	t.Helper()
+	orig := copyData
+	var calls []string
+	copyData = func(ctx context.Context, src, dst string) error {
+		calls = append(calls, src+" -> "+dst)
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		if fail != nil {
+			return fail
+		}
+		data, err := os.ReadFile(filepath.Join(src, "marker"))
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, "marker"), data, 0644)
+	}
+	t.Cleanup(func() { copyData = orig })
+	return &calls
+}
+
+func TestCloneCopiesConfigAndData(t *testing.T) {
+	stubHost(t)
+	stubCopy(t, nil)
+	rt := newFakeRuntime()
+	src := labelled(t, "pixel", "tier=lab")
+	src.CPUs = "2"
+	src.RunSpec = "old-spec"
+	os.WriteFile(filepath.Join(src.DataPath, "marker"), []byte("data"), 0644)
+	store := newMemStore(src)
+
+	if err := NewClonerWith(store, rt).Clone(context.Background(), "pixel", "pixel-2", CloneOptions{}); err != nil {
+		t.Fatalf("Clone: %v", err)
+	}
+	clone := store.cfg.GetContainer("pixel-2")
+	if clone == nil {
+		t.Fatal("clone not saved")
+	}
+	wantPath := filepath.Join(filepath.Dir(src.DataPath), "data-pixel-2")
+	if clone.DataPath != wantPath || clone.LogFile != "pixel-2.log" {
+		t.Fatalf("data path = %s, log = %s, want %s", clone.DataPath, clone.LogFile, wantPath)
+	}
+	if clone.Port == src.Port || clone.RunSpec != "" || !clone.Initialized {
+		t.Fatalf("clone not ready to start: %+v", clone)
+	}
+	if clone.CPUs != "2" || clone.Labels["tier"] != "lab" {
+		t.Fatalf("settings not copied: %+v", clone)
+	}
+	clone.Labels["tier"] = "ci"
+	if src.Labels["tier"] != "lab" {
+		t.Fatal("the clone shares labels with its source")
+	}
+	if data, err := os.ReadFile(filepath.Join(wantPath, "marker")); err != nil || string(data) != "data" {
+		t.Fatalf("data not copied: %q, %v", data, err)
+	}
+}
+
+func TestCloneStopsAndRestartsSource(t *testing.T) {
+	stubHost(t)
+	calls := stubCopy(t, nil)
+	rt := newFakeRuntime()
+	rt.containers["pixel"] = &fakeContainer{running: true}
+	src := testContainer(t, "pixel")
+	os.WriteFile(filepath.Join(src.DataPath, "marker"), []byte("data"), 0644)
+	store := newMemStore(src)
+
+	if err := NewClonerWith(store, rt).Clone(context.Background(), "pixel", "pixel-2", CloneOptions{StopSource: true}); err != nil {
+		t.Fatalf("Clone: %v", err)
+	}
+	if len(*calls) != 1 || !rt.called("Stop pixel") {
+		t.Fatalf("copy calls = %v, runtime calls = %v", *calls, rt.calls)
+	}
+	if !rt.containers["pixel"].running || store.cfg.GetContainer("pixel").Stopped {
+		t.Fatal("source not started again after the copy")
+	}
+	if store.cfg.GetContainer("pixel-2") == nil {
+		t.Fatal("clone lost when the restarted source saved the config")
+	}
+}
+
+func TestCloneFailureLeavesNothingBehind(t *testing.T) {
+	stubHost(t)
+	stubCopy(t, errors.New("disk full"))
+	src := testContainer(t, "pixel")
+	store := newMemStore(src)
+
+	err := NewClonerWith(store, newFakeRuntime()).Clone(context.Background(), "pixel", "pixel-2", CloneOptions{})
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Clone error = %v", err)
+	}
+	if store.cfg.GetContainer("pixel-2") != nil {
+		t.Fatal("failed clone saved")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(src.DataPath), "data-pixel-2")); !os.IsNotExist(err) {
+		t.Fatal("partial copy kept")
+	}
+}
+
+func TestCloneRefusals(t *testing.T) {
+	stubHost(t)
+	stubCopy(t, nil)
+	store := newMemStore(testContainer(t, "pixel"), testContainer(t, "taken"))
+	cloner := NewClonerWith(store, newFakeRuntime())
+
+	if err := cloner.Clone(context.Background(), "missing", "copy", CloneOptions{}); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("missing source: %v", err)
+	}
+	for _, dst := range []string{"taken", "bad name", "-x"} {
+		if err := cloner.Clone(context.Background(), "pixel", dst, CloneOptions{}); err == nil {
+			t.Errorf("clone to %q accepted", dst)
+		}
+	}
+}
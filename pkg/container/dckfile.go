@@ -1,6 +1,10 @@
 package container
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -20,15 +24,18 @@ type DockerfileGenerator struct {
 }
 
 func NewDockerfileGenerator(containerName string) *DockerfileGenerator {
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Printf("Warning: Failed to load config: %v\n", err)
-		cfg = config.GetDefault()
+	return NewDockerfileGeneratorWith(config.NewFileStore(), nil, containerName)
+}
+
+func NewDockerfileGeneratorWith(store config.Store, runtime Runtime, containerName string) *DockerfileGenerator {
+	cfg := config.LoadOrDefault(store)
+	if runtime == nil {
+		runtime = NewRuntimeForContainer(cfg, cfg.GetContainer(containerName))
 	}
 	return &DockerfileGenerator{
 		config:        cfg,
 		containerName: containerName,
-		runtime:       NewRuntime(),
+		runtime:       runtime,
 		workDir:       "/tmp/reddock-build",
 		addons:        []string{},
 	}
@@ -53,12 +60,7 @@ func (g *DockerfileGenerator) SetAddons(addons []string) {
 func (g *DockerfileGenerator) Generate() (string, error) {
 	container := g.config.GetContainer(g.containerName)
 	if container == nil {
-		return "", fmt.Errorf("Container '%s' is not found", g.containerName)
-	}
-
-	gpuParam := "auto"
-	if container.GPUMode != "" {
-		gpuParam = container.GPUMode
+		return "", NewError(ErrContainerNotFound, g.containerName, "Container '%s' is not found", g.containerName)
 	}
 
 	var dockerfile strings.Builder
@@ -82,18 +84,25 @@ func (g *DockerfileGenerator) Generate() (string, error) {
 
 	// Boot arguments
 	dockerfile.WriteString("# Redroid boot arguments\n")
-	dockerfile.WriteString(fmt.Sprintf("CMD [\"androidboot.redroid_gpu_mode=%s\"]\n", gpuParam))
+	dockerfile.WriteString(cmdInstruction(container.BootArgs()))
 
 	return dockerfile.String(), nil
 }
 
+// cmdInstruction renders boot arguments as an exec form CMD
+func cmdInstruction(args []string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(args)
+	return "CMD " + buf.String()
+}
+
 // GenerateWithCustomBase creates a Dockerfile with custom base image
 func (g *DockerfileGenerator) GenerateWithCustomBase(baseImage string) (string, error) {
-	gpuParam := "auto"
-
 	container := g.config.GetContainer(g.containerName)
-	if container != nil && container.GPUMode != "" {
-		gpuParam = container.GPUMode
+	if container == nil {
+		container = &config.Container{}
 	}
 
 	var dockerfile strings.Builder
@@ -114,7 +123,7 @@ func (g *DockerfileGenerator) GenerateWithCustomBase(baseImage string) (string,
 
 	// Boot arguments
 	dockerfile.WriteString("# Redroid boot arguments\n")
-	dockerfile.WriteString(fmt.Sprintf("CMD [\"androidboot.redroid_gpu_mode=%s\"]\n", gpuParam))
+	dockerfile.WriteString(cmdInstruction(container.BootArgs()))
 
 	return dockerfile.String(), nil
 }
@@ -199,7 +208,7 @@ func (g *DockerfileGenerator) Edit() error {
 }
 
 // EditAndBuild opens editor and then builds the image
-func (g *DockerfileGenerator) EditAndBuild(targetImage string) error {
+func (g *DockerfileGenerator) EditAndBuild(ctx context.Context, targetImage string) error {
 	// First edit the Dockerfile
 	if err := g.Edit(); err != nil {
 		return err
@@ -215,15 +224,21 @@ func (g *DockerfileGenerator) EditAndBuild(targetImage string) error {
 		return nil
 	}
 
-	return g.Build(targetImage)
+	return g.Build(ctx, targetImage)
 }
 
 // Build builds a Docker image from the saved Dockerfile
-func (g *DockerfileGenerator) Build(targetImage string) error {
+func (g *DockerfileGenerator) Build(ctx context.Context, targetImage string) error {
 	container := g.config.GetContainer(g.containerName)
 	if container != nil && strings.HasPrefix(container.ImageURL, "redroid/redroid:") {
 		fmt.Printf("Pulling official Redroid image %s...\n", container.ImageURL)
-		if err := g.runtime.PullImage(container.ImageURL); err != nil {
+		pullCtx, cancel := WithTimeout(ctx, g.config, config.OpPull)
+		err := g.runtime.PullImage(pullCtx, container.ImageURL)
+		cancel()
+		if errors.Is(err, ErrCanceled) {
+			return err
+		}
+		if err != nil {
 			fmt.Printf("Warning: Failed to pull base image: %v\n", err)
 		}
 	}
@@ -238,17 +253,11 @@ func (g *DockerfileGenerator) Build(targetImage string) error {
 	spinner := ui.NewSpinner(fmt.Sprintf("Building image %s...", targetImage))
 	spinner.Start()
 
-	buildArgs := []string{"build", "-t", targetImage, g.workDir}
-	if g.runtime.Name() == "docker" {
-		buildArgs = []string{"buildx", "build", "--load", "-t", targetImage, g.workDir}
-	}
-	cmd := g.runtime.Command(buildArgs...)
-	output, err := cmd.CombinedOutput()
-
-	if err != nil {
+	buildCtx, cancel := WithTimeout(ctx, g.config, config.OpBuild)
+	defer cancel()
+	if err := g.runtime.Build(buildCtx, g.workDir, targetImage); err != nil {
 		spinner.Finish("Failed to build image")
-		fmt.Println(string(output))
-		return fmt.Errorf("Build failed: %v", err)
+		return fmt.Errorf("Build failed: %w", err)
 	}
 
 	spinner.Finish(fmt.Sprintf("Successfully built %s", targetImage))
@@ -257,9 +266,9 @@ func (g *DockerfileGenerator) Build(targetImage string) error {
 
 // CommitContainer commits a running container to a new image
 // This is useful for saving changes made while the container is running
-func (g *DockerfileGenerator) CommitContainer(newImageName, message string) error {
-	if !g.runtime.IsRunning(g.containerName) {
-		return fmt.Errorf("Container '%s' is not running", g.containerName)
+func (g *DockerfileGenerator) CommitContainer(ctx context.Context, newImageName, message string) error {
+	if !g.runtime.IsRunning(ctx, g.containerName) {
+		return NewError(ErrNotRunning, g.containerName, "Container '%s' is not running", g.containerName)
 	}
 
 	spinner := ui.NewSpinner(fmt.Sprintf("Committing container %s to %s...", g.containerName, newImageName))
@@ -271,13 +280,13 @@ func (g *DockerfileGenerator) CommitContainer(newImageName, message string) erro
 	}
 	args = append(args, g.containerName, newImageName)
 
-	cmd := g.runtime.Command(args...)
+	cmd := g.runtime.Command(ctx, args...)
 	output, err := cmd.CombinedOutput()
 
 	if err != nil {
 		spinner.Finish("Failed to commit container")
 		fmt.Println(string(output))
-		return fmt.Errorf("Commit failed: %v", err)
+		return fmt.Errorf("Commit failed: %w", ContextError(ctx, err))
 	}
 
 	spinner.Finish(fmt.Sprintf("Successfully committed to %s", newImageName))
@@ -286,9 +295,9 @@ func (g *DockerfileGenerator) CommitContainer(newImageName, message string) erro
 
 // CopyToContainer copies files from host to a running container
 // This is the core function for installing addons to a running container
-func (g *DockerfileGenerator) CopyToContainer(srcPath, destPath string) error {
-	if !g.runtime.IsRunning(g.containerName) {
-		return fmt.Errorf("Container '%s' is not running", g.containerName)
+func (g *DockerfileGenerator) CopyToContainer(ctx context.Context, srcPath, destPath string) error {
+	if !g.runtime.IsRunning(ctx, g.containerName) {
+		return NewError(ErrNotRunning, g.containerName, "Container '%s' is not running", g.containerName)
 	}
 
 	spinner := ui.NewSpinner(fmt.Sprintf("Copying to container %s...", g.containerName))
@@ -296,13 +305,13 @@ func (g *DockerfileGenerator) CopyToContainer(srcPath, destPath string) error {
 
 	// docker cp <src> <container>:<dest>
 	target := fmt.Sprintf("%s:%s", g.containerName, destPath)
-	cmd := g.runtime.Command("cp", srcPath, target)
+	cmd := g.runtime.Command(ctx, "cp", srcPath, target)
 	output, err := cmd.CombinedOutput()
 
 	if err != nil {
 		spinner.Finish("Failed to copy files")
 		fmt.Println(string(output))
-		return fmt.Errorf("Copy failed: %v", err)
+		return fmt.Errorf("Copy failed: %w", ContextError(ctx, err))
 	}
 
 	spinner.Finish(fmt.Sprintf("Successfully copied to %s", destPath))
@@ -310,12 +319,12 @@ func (g *DockerfileGenerator) CopyToContainer(srcPath, destPath string) error {
 }
 
 // ExecInContainer executes a command inside the running container
-func (g *DockerfileGenerator) ExecInContainer(command string) error {
-	if !g.runtime.IsRunning(g.containerName) {
-		return fmt.Errorf("Container '%s' is not running", g.containerName)
+func (g *DockerfileGenerator) ExecInContainer(ctx context.Context, command string) error {
+	if !g.runtime.IsRunning(ctx, g.containerName) {
+		return NewError(ErrNotRunning, g.containerName, "Container '%s' is not running", g.containerName)
 	}
 
-	cmd := g.runtime.Command("exec", g.containerName, "sh", "-c", command)
+	cmd := g.runtime.Command(ctx, "exec", g.containerName, "sh", "-c", command)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
@@ -323,10 +332,9 @@ func (g *DockerfileGenerator) ExecInContainer(command string) error {
 
 // InstallAddonToRunningContainer installs addon files to a running container
 // This follows the redroid-script approach of copying files directly
-func (g *DockerfileGenerator) InstallAddonToRunningContainer(addonDir, addonName string) error {
-	if !g.runtime.IsRunning(g.containerName) {
-		return fmt.Errorf("Container '%s' is not running. Start it first with 'reddock start %s'",
-			g.containerName, g.containerName)
+func (g *DockerfileGenerator) InstallAddonToRunningContainer(ctx context.Context, addonDir, addonName string) error {
+	if !g.runtime.IsRunning(ctx, g.containerName) {
+		return notRunningError(g.containerName)
 	}
 
 	// The addon directory should contain the extracted files
@@ -353,11 +361,11 @@ func (g *DockerfileGenerator) InstallAddonToRunningContainer(addonDir, addonName
 
 		// docker cp <src> <container>:<dest>
 		target := fmt.Sprintf("%s:%s", g.containerName, destPath)
-		cmd := g.runtime.Command("cp", itemPath, target)
+		cmd := g.runtime.Command(ctx, "cp", itemPath, target)
 		if output, err := cmd.CombinedOutput(); err != nil {
 			spinner.Finish(fmt.Sprintf("Failed to copy %s", entry.Name()))
 			fmt.Println(string(output))
-			return fmt.Errorf("Failed to copy %s: %v", entry.Name(), err)
+			return fmt.Errorf("Failed to copy %s: %w", entry.Name(), ContextError(ctx, err))
 		}
 	}
 
@@ -396,7 +404,7 @@ func (g *DockerfileGenerator) Cleanup() error {
 }
 
 // Interactive provides an interactive workflow for creating/editing Dockerfile
-func (g *DockerfileGenerator) Interactive() error {
+func (g *DockerfileGenerator) Interactive(ctx context.Context) error {
 	fmt.Println("\n╔════════════════════════════════════════════════════╗")
 	fmt.Println("║       Reddock Dockerfile Creator & Manager         ║")
 	fmt.Println("╚════════════════════════════════════════════════════╝")
@@ -436,7 +444,7 @@ func (g *DockerfileGenerator) Interactive() error {
 				return err
 			}
 		}
-		return g.Build(imageName)
+		return g.Build(ctx, imageName)
 
 	case "3":
 		fmt.Print("Enter target image name (e.g., myredroid:latest): ")
@@ -445,11 +453,11 @@ func (g *DockerfileGenerator) Interactive() error {
 		if imageName == "" {
 			imageName = fmt.Sprintf("reddock/%s:custom", g.containerName)
 		}
-		return g.EditAndBuild(imageName)
+		return g.EditAndBuild(ctx, imageName)
 
 	case "4":
-		if !g.runtime.IsRunning(g.containerName) {
-			return fmt.Errorf("container '%s' is not running", g.containerName)
+		if !g.runtime.IsRunning(ctx, g.containerName) {
+			return NewError(ErrNotRunning, g.containerName, "container '%s' is not running", g.containerName)
 		}
 		fmt.Print("Enter new image name: ")
 		var imageName string
@@ -460,7 +468,7 @@ func (g *DockerfileGenerator) Interactive() error {
 		fmt.Print("Enter commit messages (optional): ")
 		var message string
 		fmt.Scanln(&message)
-		return g.CommitContainer(imageName, message)
+		return g.CommitContainer(ctx, imageName, message)
 
 	case "5":
 		fmt.Print("Enter addon name (e.g., houdini, ndk, gapps): ")
@@ -471,7 +479,7 @@ func (g *DockerfileGenerator) Interactive() error {
 		}
 		// Use default addon work directory
 		addonDir := "/tmp/reddock-addons"
-		return g.InstallAddonToRunningContainer(addonDir, addonName)
+		return g.InstallAddonToRunningContainer(ctx, addonDir, addonName)
 
 	case "6":
 		fmt.Println("You can open this again by running 'reddock dockerfile interactive'.")
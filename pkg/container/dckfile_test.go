@@ -0,0 +1,63 @@
+package container
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDockerfile(t *testing.T) {
+	c := testContainer(t, "android")
+	c.GPUMode = "host"
+	gen := NewDockerfileGeneratorWith(newMemStore(c), newFakeRuntime(), "android")
+	gen.SetAddons([]string{"houdini", "litegapps"})
+
+	dockerfile, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for _, want := range []string{
+		"FROM redroid/redroid:13.0.0-latest",
+		"COPY houdini /",
+		"COPY litegapps /",
+		`CMD ["androidboot.redroid_gpu_mode=host"]`,
+	} {
+		if !strings.Contains(dockerfile, want) {
+			t.Errorf("Dockerfile missing %q:\n%s", want, dockerfile)
+		}
+	}
+}
+
+func TestBuildUsesRuntime(t *testing.T) {
+	c := testContainer(t, "android")
+	c.ImageURL = "reddock-custom:android-13.0.0"
+	rt := newFakeRuntime()
+	gen := NewDockerfileGeneratorWith(newMemStore(c), rt, "android")
+	gen.SetWorkDir(t.TempDir())
+
+	if err := gen.SaveToFile(gen.GetDockerfilePath()); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+	if err := gen.Build(context.Background(), "reddock/android:custom"); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !rt.called("Build") || !rt.ImageExists(context.Background(), "reddock/android:custom") {
+		t.Fatalf("expected runtime build, calls: %v", rt.calls)
+	}
+}
+
+func TestGenerateDockerfileBootProperties(t *testing.T) {
+	c := testContainer(t, "android")
+	c.DPI = 320
+	c.BootProps = map[string]string{"ro.product.model": "Pixel <7>"}
+	gen := NewDockerfileGeneratorWith(newMemStore(c), newFakeRuntime(), "android")
+
+	dockerfile, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	want := `CMD ["androidboot.redroid_gpu_mode=auto","androidboot.redroid_dpi=320","ro.product.model=Pixel <7>"]`
+	if !strings.Contains(dockerfile, want) {
+		t.Errorf("Dockerfile missing %q:\n%s", want, dockerfile)
+	}
+}
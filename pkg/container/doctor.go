@@ -0,0 +1,486 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"reddock/pkg/config"
+)
+
+// CheckStatus is the outcome of a doctor check
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+)
+
+// CheckResult is one line of the doctor report
+type CheckResult struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail"`
+	Hint   string      `json:"hint,omitempty"`
+	Fixed  bool        `json:"fixed,omitempty"`
+}
+
+const (
+	// ModulesLoadDir lists kernel modules systemd loads at boot
+	ModulesLoadDir = "/etc/modules-load.d"
+	// ModprobeDir holds kernel module options
+	ModprobeDir = "/etc/modprobe.d"
+
+	binderModuleOptions = "devices=binder,hwbinder,vndbinder"
+	lowDiskWarn         = 10 << 30
+	lowDiskFail         = 2 << 30
+)
+
+type doctorCheck struct {
+	run func(ctx context.Context) CheckResult
+	fix func(ctx context.Context) error
+}
+
+// Doctor checks that the host can run redroid containers
+type Doctor struct {
+	config  *config.Config
+	runtime Runtime
+	// pinned means runtime was passed in and stands for every container
+	pinned bool
+
+	readFile    func(path string) ([]byte, error)
+	exists      func(path string) bool
+	lookPath    func(file string) (string, error)
+	freeSpace   func(path string) (uint64, error)
+	portFree    func(port int) bool
+	modprobe    func(ctx context.Context, args ...string) error
+	modulesDir  string
+	modprobeDir string
+}
+
+func NewDoctor() *Doctor {
+	return NewDoctorWith(config.NewFileStore(), nil)
+}
+
+func NewDoctorWith(store config.Store, runtime Runtime) *Doctor {
+	cfg := config.LoadOrDefault(store)
+	pinned := runtime != nil
+	if runtime == nil {
+		runtime = NewRuntimeFromConfig(cfg)
+	}
+	return &Doctor{
+		config:   cfg,
+		runtime:  runtime,
+		pinned:   pinned,
+		readFile: os.ReadFile,
+		exists: func(path string) bool {
+			_, err := os.Stat(path)
+			return err == nil
+		},
+		lookPath:  exec.LookPath,
+		freeSpace: freeSpace,
+		portFree:  portAvailable,
+		modprobe: func(ctx context.Context, args ...string) error {
+			output, err := exec.CommandContext(ctx, "modprobe", args...).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("modprobe %s: %v %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+			}
+			return nil
+		},
+		modulesDir:  ModulesLoadDir,
+		modprobeDir: ModprobeDir,
+	}
+}
+
+// Run performs every check, applying safe remediations with fix
+func (d *Doctor) Run(ctx context.Context, fix bool) []CheckResult {
+	checks := []doctorCheck{
+		{run: d.checkBinder, fix: d.fixBinder},
+		{run: d.checkSharedMemory, fix: d.fixAshmem},
+		{run: d.checkCgroups},
+		{run: d.checkKernel},
+		{run: d.checkRuntime},
+		{run: d.checkBuilder},
+		{run: d.toolCheck("adb", "needed by adb-connect and to check the boot state without exec", "Install the Android platform tools (adb)")},
+		{run: d.toolCheck("tar", "needed to unpack addons", "Install tar")},
+		{run: d.toolCheck("lzip", "needed by the OpenGApps addon", "Install lzip")},
+		{run: d.toolCheck("xz", "needed by the LiteGApps addon", "Install xz-utils")},
+	}
+
+	var results []CheckResult
+	for _, check := range checks {
+		result := check.run(ctx)
+		if fix && check.fix != nil && result.Status != CheckPass {
+			if err := check.fix(ctx); err != nil {
+				result.Detail += fmt.Sprintf(" (fix failed: %v)", err)
+			} else {
+				result = check.run(ctx)
+				result.Fixed = true
+			}
+		}
+		results = append(results, result)
+	}
+	results = append(results, d.checkDisk()...)
+	return append(results, d.checkPorts(ctx))
+}
+
+// Report prints the checks as a table or JSON, failing when any check failed
+func (d *Doctor) Report(ctx context.Context, out io.Writer, asJSON, fix bool) error {
+	if fix {
+		if err := requireRoot(); err != nil {
+			return err
+		}
+	}
+	results := d.Run(ctx, fix)
+
+	counts := make(map[CheckStatus]int)
+	for _, r := range results {
+		counts[r.Status]++
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(struct {
+			Checks []CheckResult `json:"checks"`
+		}{results}); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range results {
+			fixed := ""
+			if r.Fixed {
+				fixed = " (fixed)"
+			}
+			fmt.Fprintf(out, "[%s] %-14s %s%s\n", strings.ToUpper(string(r.Status)), r.Name, r.Detail, fixed)
+			if r.Hint != "" && r.Status != CheckPass {
+				fmt.Fprintf(out, "       %-14s %s\n", "", r.Hint)
+			}
+		}
+		fmt.Fprintf(out, "\n%d passed, %d warnings, %d failed\n", counts[CheckPass], counts[CheckWarn], counts[CheckFail])
+	}
+
+	if counts[CheckFail] > 0 {
+		return fmt.Errorf("%d host check(s) failed", counts[CheckFail])
+	}
+	return nil
+}
+
+func (d *Doctor) hasFilesystem(name string) bool {
+	data, err := d.readFile("/proc/filesystems")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[len(fields)-1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Doctor) checkBinder(ctx context.Context) CheckResult {
+	r := CheckResult{Name: "binder"}
+	switch {
+	case d.hasFilesystem("binder"):
+		r.Status = CheckPass
+		r.Detail = "binderfs is available, each container gets its own binder devices"
+	case d.exists("/dev/binder") || d.exists("/sys/module/binder_linux"):
+		r.Status = CheckWarn
+		r.Detail = "only the shared /dev/binder devices, containers share binder state"
+		r.Hint = "Use a kernel with CONFIG_ANDROID_BINDERFS to run many containers at once"
+	default:
+		r.Status = CheckFail
+		r.Detail = "neither binderfs nor binder devices are available"
+		r.Hint = "Run 'reddock doctor --fix' or 'modprobe binder_linux " + binderModuleOptions + "'"
+	}
+	return r
+}
+
+func (d *Doctor) fixBinder(ctx context.Context) error {
+	if err := d.modprobe(ctx, "binder_linux", binderModuleOptions); err != nil {
+		return err
+	}
+	return d.persistModule("binder_linux", binderModuleOptions)
+}
+
+func (d *Doctor) checkSharedMemory(ctx context.Context) CheckResult {
+	r := CheckResult{Name: "ashmem/memfd"}
+	if d.exists("/dev/ashmem") {
+		r.Status = CheckPass
+		r.Detail = "ashmem is available"
+		return r
+	}
+	r.Status = CheckWarn
+	r.Detail = "ashmem is missing, only memfd is available; images up to Android 11 need ashmem"
+	r.Hint = "Run 'reddock doctor --fix' or 'modprobe ashmem_linux' if the kernel has it"
+	return r
+}
+
+func (d *Doctor) fixAshmem(ctx context.Context) error {
+	if err := d.modprobe(ctx, "ashmem_linux"); err != nil {
+		return err
+	}
+	return d.persistModule("ashmem_linux", "")
+}
+
+func (d *Doctor) persistModule(module, options string) error {
+	if err := appendLine(filepath.Join(d.modulesDir, "reddock.conf"), module); err != nil {
+		return err
+	}
+	if options == "" {
+		return nil
+	}
+	return appendLine(filepath.Join(d.modprobeDir, "reddock.conf"), "options "+module+" "+options)
+}
+
+func appendLine(path, line string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, existing := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(existing) == line {
+			return nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		data = append(data, '\n')
+	}
+	return os.WriteFile(path, append(data, []byte(line+"\n")...), 0644)
+}
+
+func (d *Doctor) checkCgroups(ctx context.Context) CheckResult {
+	r := CheckResult{Name: "cgroups"}
+	switch {
+	case d.exists("/sys/fs/cgroup/cgroup.controllers"):
+		r.Status = CheckPass
+		r.Detail = "cgroups v2"
+	case d.exists("/sys/fs/cgroup"):
+		r.Status = CheckWarn
+		r.Detail = "cgroups v1, rootless podman cannot pause containers or apply limits"
+		r.Hint = "Boot with systemd.unified_cgroup_hierarchy=1 to switch to cgroups v2"
+	default:
+		r.Status = CheckFail
+		r.Detail = "no cgroup filesystem mounted"
+	}
+	return r
+}
+
+func (d *Doctor) checkKernel(ctx context.Context) CheckResult {
+	r := CheckResult{Name: "kernel"}
+	data, err := d.readFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		r.Status = CheckWarn
+		r.Detail = fmt.Sprintf("cannot read the kernel version: %v", err)
+		return r
+	}
+	release := strings.TrimSpace(string(data))
+	major, minor := parseKernelVersion(release)
+	switch {
+	case major < 4 || (major == 4 && minor < 14):
+		r.Status = CheckFail
+		r.Detail = release + ", redroid needs 4.14 or newer"
+	case major < 5:
+		r.Status = CheckWarn
+		r.Detail = release + ", binderfs needs 5.0 or newer"
+	default:
+		r.Status = CheckPass
+		r.Detail = release
+	}
+	return r
+}
+
+// parseKernelVersion reads major and minor from a release like 6.8.0-45-generic
+func parseKernelVersion(release string) (int, int) {
+	parts := strings.SplitN(release, ".", 3)
+	major, _ := strconv.Atoi(leadingDigits(parts[0]))
+	minor := 0
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(leadingDigits(parts[1]))
+	}
+	return major, minor
+}
+
+func leadingDigits(s string) string {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	return s[:end]
+}
+
+func (d *Doctor) checkRuntime(ctx context.Context) CheckResult {
+	r := CheckResult{Name: "runtime"}
+	if !d.runtime.IsInstalled(ctx) {
+		r.Status = CheckFail
+		r.Detail = fmt.Sprintf("%s is not available", d.runtime.Name())
+		r.Hint = "Install docker or podman, or pick another runtime with --runtime"
+		return r
+	}
+	r.Status = CheckPass
+	r.Detail = d.runtime.Name()
+	if output, err := d.runtime.Command(ctx, "--version").Output(); err == nil && len(bytes.TrimSpace(output)) > 0 {
+		r.Detail = string(bytes.TrimSpace(output))
+	}
+	return r
+}
+
+// checkBuilder checks for buildx with docker and BuildKit with nerdctl
+func (d *Doctor) checkBuilder(ctx context.Context) CheckResult {
+	r := CheckResult{Name: "builder", Status: CheckPass}
+	switch rt := d.runtime.(type) {
+	case *NerdctlRuntime:
+		if _, err := d.lookPath("buildctl"); err != nil {
+			r.Status = CheckWarn
+			r.Detail = "BuildKit is missing, image builds will fail"
+			r.Hint = "Install buildkitd and buildctl"
+			return r
+		}
+		r.Detail = "BuildKit"
+	case *GenericRuntime:
+		if rt.binary != "docker" {
+			r.Detail = rt.binary + " builds natively"
+			return r
+		}
+		output, err := rt.Command(ctx, "buildx", "version").Output()
+		if err != nil {
+			r.Status = CheckWarn
+			r.Detail = "docker buildx is missing, image builds will fail"
+			r.Hint = "Install the docker-buildx plugin"
+			return r
+		}
+		r.Detail = strings.TrimSpace(string(output))
+	default:
+		r.Detail = d.runtime.Name() + " builds through its API"
+	}
+	return r
+}
+
+func (d *Doctor) toolCheck(tool, purpose, hint string) func(context.Context) CheckResult {
+	return func(ctx context.Context) CheckResult {
+		r := CheckResult{Name: tool}
+		if path, err := d.lookPath(tool); err == nil {
+			r.Status = CheckPass
+			r.Detail = path
+			return r
+		}
+		r.Status = CheckWarn
+		r.Detail = fmt.Sprintf("not installed, %s", purpose)
+		r.Hint = hint
+		return r
+	}
+}
+
+func (d *Doctor) checkDisk() []CheckResult {
+	roots := map[string]bool{filepath.Dir(config.GetDefaultDataPath("reddock")): true}
+	for _, c := range d.config.Containers {
+		if !c.IsRemote() {
+			roots[filepath.Dir(c.GetDataPath())] = true
+		}
+	}
+	var paths []string
+	for path := range roots {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var results []CheckResult
+	for _, path := range paths {
+		r := CheckResult{Name: "disk " + path}
+		free, err := d.freeSpace(existingAncestor(path, d.exists))
+		switch {
+		case err != nil:
+			r.Status = CheckWarn
+			r.Detail = fmt.Sprintf("cannot read the free space: %v", err)
+		case free < lowDiskFail:
+			r.Status = CheckFail
+			r.Detail = fmt.Sprintf("%s free, redroid needs a few GB for /data", formatBytes(int64(free)))
+		case free < lowDiskWarn:
+			r.Status = CheckWarn
+			r.Detail = fmt.Sprintf("%s free", formatBytes(int64(free)))
+		default:
+			r.Status = CheckPass
+			r.Detail = fmt.Sprintf("%s free", formatBytes(int64(free)))
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func existingAncestor(path string, exists func(string) bool) string {
+	for !exists(path) && path != filepath.Dir(path) {
+		path = filepath.Dir(path)
+	}
+	return path
+}
+
+func (d *Doctor) checkPorts(ctx context.Context) CheckResult {
+	r := CheckResult{Name: "adb ports", Status: CheckPass}
+	owners := make(map[int][]string)
+	for name, c := range d.config.Containers {
+		if port := c.ADBHostPort(); port != 0 && !c.IsRemote() {
+			owners[port] = append(owners[port], name)
+		}
+	}
+	if len(owners) == 0 {
+		first, last := d.config.ADBPortRange()
+		for port := first; port <= last; port++ {
+			if d.portFree(port) {
+				r.Detail = fmt.Sprintf("port %d is free for the next container", port)
+				return r
+			}
+		}
+		r.Status = CheckWarn
+		r.Detail = fmt.Sprintf("every port in %d-%d is in use, new containers cannot publish ADB", first, last)
+		r.Hint = "Widen \"adb_ports\" in " + config.GetConfigPath()
+		return r
+	}
+
+	ports := make([]int, 0, len(owners))
+	for port := range owners {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+
+	var problems []string
+	for _, port := range ports {
+		names := owners[port]
+		sort.Strings(names)
+		if len(names) > 1 {
+			problems = append(problems, fmt.Sprintf("port %d is shared by %s", port, strings.Join(names, ", ")))
+			continue
+		}
+		if !d.portFree(port) && !d.containerRunning(ctx, names[0]) {
+			problems = append(problems, fmt.Sprintf("port %d of '%s' is taken by another process", port, names[0]))
+		}
+	}
+	if len(problems) > 0 {
+		r.Status = CheckFail
+		r.Detail = strings.Join(problems, "; ")
+		return r
+	}
+	r.Detail = fmt.Sprintf("%d port(s) in use by reddock, no conflicts", len(ports))
+	return r
+}
+
+func (d *Doctor) containerRunning(ctx context.Context, name string) bool {
+	runtime := d.runtime
+	if !d.pinned {
+		runtime = NewRuntimeForContainer(d.config, d.config.GetContainer(name))
+	}
+	return runtime.IsRunning(ctx, name)
+}
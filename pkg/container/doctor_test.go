@@ -0,0 +1,170 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestDoctor builds a doctor on a fake host where only the given paths
+// exist and only the given tools are installed
+func newTestDoctor(t *testing.T, store *memStore, paths map[string]string, tools ...string) *Doctor {
+	t.Helper()
+	d := NewDoctorWith(store, newFakeRuntime())
+	d.readFile = func(path string) ([]byte, error) {
+		if content, ok := paths[path]; ok {
+			return []byte(content), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	d.exists = func(path string) bool {
+		_, ok := paths[path]
+		return ok || path == "/"
+	}
+	d.lookPath = func(file string) (string, error) {
+		for _, tool := range tools {
+			if tool == file {
+				return "/usr/bin/" + file, nil
+			}
+		}
+		return "", errors.New("not found")
+	}
+	d.freeSpace = func(path string) (uint64, error) { return 50 << 30, nil }
+	d.portFree = func(port int) bool { return true }
+	d.modprobe = func(ctx context.Context, args ...string) error {
+		return errors.New("modprobe is stubbed")
+	}
+	d.modulesDir = filepath.Join(t.TempDir(), "modules-load.d")
+	d.modprobeDir = filepath.Join(t.TempDir(), "modprobe.d")
+	return d
+}
+
+func findCheck(t *testing.T, results []CheckResult, name string) CheckResult {
+	t.Helper()
+	for _, r := range results {
+		if r.Name == name {
+			return r
+		}
+	}
+	t.Fatalf("no %q check in %+v", name, results)
+	return CheckResult{}
+}
+
+func TestDoctorHealthyHost(t *testing.T) {
+	d := newTestDoctor(t, newMemStore(), map[string]string{
+		"/proc/filesystems":                 "nodev\tbinder\n",
+		"/proc/sys/kernel/osrelease":        "6.8.0-45-generic\n",
+		"/dev/ashmem":                       "",
+		"/sys/fs/cgroup/cgroup.controllers": "",
+	}, "adb", "tar", "lzip", "xz")
+
+	for _, r := range d.Run(context.Background(), false) {
+		if r.Status != CheckPass {
+			t.Errorf("%s = %s: %s", r.Name, r.Status, r.Detail)
+		}
+	}
+}
+
+func TestDoctorFixesBinder(t *testing.T) {
+	paths := map[string]string{"/proc/sys/kernel/osrelease": "6.1.0"}
+	d := newTestDoctor(t, newMemStore(), paths)
+	var loaded []string
+	d.modprobe = func(ctx context.Context, args ...string) error {
+		loaded = append(loaded, strings.Join(args, " "))
+		if args[0] == "binder_linux" {
+			paths["/dev/binder"] = ""
+			return nil
+		}
+		return errors.New("module ashmem_linux not found")
+	}
+
+	before := findCheck(t, d.Run(context.Background(), false), "binder")
+	if before.Status != CheckFail {
+		t.Fatalf("binder = %s before the fix, want fail", before.Status)
+	}
+
+	results := d.Run(context.Background(), true)
+	binder := findCheck(t, results, "binder")
+	if !binder.Fixed || binder.Status == CheckFail {
+		t.Fatalf("binder not fixed: %+v", binder)
+	}
+	if ashmem := findCheck(t, results, "ashmem/memfd"); ashmem.Fixed || !strings.Contains(ashmem.Detail, "fix failed") {
+		t.Fatalf("failed ashmem fix not reported: %+v", ashmem)
+	}
+	if loaded[0] != "binder_linux "+binderModuleOptions {
+		t.Fatalf("modprobe calls = %v", loaded)
+	}
+
+	modules, _ := os.ReadFile(filepath.Join(d.modulesDir, "reddock.conf"))
+	if string(modules) != "binder_linux\n" {
+		t.Fatalf("modules-load.d = %q", modules)
+	}
+	options, _ := os.ReadFile(filepath.Join(d.modprobeDir, "reddock.conf"))
+	if string(options) != "options binder_linux "+binderModuleOptions+"\n" {
+		t.Fatalf("modprobe.d = %q", options)
+	}
+
+	// A second fix does not duplicate the lines
+	d.fixBinder(context.Background())
+	if modules, _ := os.ReadFile(filepath.Join(d.modulesDir, "reddock.conf")); string(modules) != "binder_linux\n" {
+		t.Fatalf("modules-load.d after a second fix = %q", modules)
+	}
+}
+
+func TestDoctorPortConflicts(t *testing.T) {
+	a := testContainer(t, "a")
+	b := testContainer(t, "b")
+	c := testContainer(t, "c")
+	c.Port = 5560
+	d := newTestDoctor(t, newMemStore(a, b, c), nil)
+	d.portFree = func(port int) bool { return port != 5560 }
+
+	ports := findCheck(t, d.Run(context.Background(), false), "adb ports")
+	if ports.Status != CheckFail {
+		t.Fatalf("adb ports = %s, want fail", ports.Status)
+	}
+	for _, want := range []string{"port 5555 is shared by a, b", "port 5560 of 'c' is taken by another process"} {
+		if !strings.Contains(ports.Detail, want) {
+			t.Errorf("detail %q lacks %q", ports.Detail, want)
+		}
+	}
+}
+
+func TestDoctorReportJSON(t *testing.T) {
+	d := newTestDoctor(t, newMemStore(), map[string]string{"/proc/sys/kernel/osrelease": "4.9.0"})
+	var out bytes.Buffer
+
+	err := d.Report(context.Background(), &out, true, false)
+	if err == nil {
+		t.Fatal("Report should fail on failed checks")
+	}
+	var report struct {
+		Checks []CheckResult `json:"checks"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if kernel := findCheck(t, report.Checks, "kernel"); kernel.Status != CheckFail {
+		t.Fatalf("kernel = %+v, want fail", kernel)
+	}
+}
+
+func TestParseKernelVersion(t *testing.T) {
+	tests := map[string][2]int{
+		"6.8.0-45-generic":                   {6, 8},
+		"5.15.153.1-microsoft-standard-WSL2": {5, 15},
+		"4.14rc1":                            {4, 14},
+		"6":                                  {6, 0},
+	}
+	for release, want := range tests {
+		major, minor := parseKernelVersion(release)
+		if major != want[0] || minor != want[1] {
+			t.Errorf("parseKernelVersion(%q) = %d.%d, want %d.%d", release, major, minor, want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package container
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"reddock/pkg/config"
+)
+
+// Endpoint is a container engine address
+type Endpoint struct {
+	Scheme string
+	// Path is the socket path, optional for ssh endpoints
+	Path string
+	Host string
+	Port string
+	User string
+}
+
+// ParseEndpoint parses unix://, tcp:// and ssh:// addresses
+func ParseEndpoint(raw string) (*Endpoint, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid host '%s': %v", raw, err)
+	}
+
+	ep := &Endpoint{Scheme: u.Scheme, Host: u.Hostname(), Port: u.Port()}
+	switch u.Scheme {
+	case "unix":
+		ep.Path = u.Path
+		if ep.Path == "" {
+			return nil, fmt.Errorf("Invalid host '%s': unix endpoints need a socket path", raw)
+		}
+	case "tcp":
+		if ep.Host == "" {
+			return nil, fmt.Errorf("Invalid host '%s': tcp endpoints need a host name", raw)
+		}
+		if ep.Port == "" {
+			ep.Port = "2375"
+			if tlsEnabled() {
+				ep.Port = "2376"
+			}
+		}
+	case "ssh":
+		if ep.Host == "" {
+			return nil, fmt.Errorf("Invalid host '%s': ssh endpoints need a host name", raw)
+		}
+		ep.User = u.User.Username()
+		ep.Path = u.Path
+	default:
+		return nil, fmt.Errorf("Invalid host '%s': use unix://, tcp:// or ssh://", raw)
+	}
+	return ep, nil
+}
+
+func (e *Endpoint) String() string {
+	switch e.Scheme {
+	case "unix":
+		return "unix://" + e.Path
+	case "tcp":
+		return "tcp://" + net.JoinHostPort(e.Host, e.Port)
+	}
+	host := e.Host
+	if e.Port != "" {
+		host = net.JoinHostPort(e.Host, e.Port)
+	}
+	if e.User != "" {
+		host = e.User + "@" + host
+	}
+	return "ssh://" + host + e.Path
+}
+
+func (e *Endpoint) IsRemote() bool {
+	return e.Scheme != "unix"
+}
+
+// Hostname returns the machine published container ports are reachable on
+func (e *Endpoint) Hostname() string {
+	if !e.IsRemote() {
+		return "localhost"
+	}
+	return e.Host
+}
+
+// ContainerHost returns the machine a container's published ports are reachable on
+func ContainerHost(host string) string {
+	if host == "" {
+		return "localhost"
+	}
+	ep, err := ParseEndpoint(host)
+	if err != nil {
+		return "localhost"
+	}
+	return ep.Hostname()
+}
+
+// ADBAddress reaches a macvlan container on its own LAN address
+func ADBAddress(c *config.Container) string {
+	port := c.ADBHostPort()
+	if port == 0 {
+		host := c.IP
+		if host == "" {
+			host = ContainerHost(c.Host)
+		}
+		return net.JoinHostPort(host, strconv.Itoa(config.DefaultADBPort))
+	}
+	return net.JoinHostPort(ContainerHost(c.Host), strconv.Itoa(port))
+}
+
+func (e *Endpoint) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	switch e.Scheme {
+	case "unix":
+		return dialer.DialContext(ctx, "unix", e.Path)
+	case "tcp":
+		return dialer.DialContext(ctx, "tcp", net.JoinHostPort(e.Host, e.Port))
+	default:
+		return dialSSH(e)
+	}
+}
+
+// tlsEnabled follows the docker CLI convention for TCP daemons
+func tlsEnabled() bool {
+	return os.Getenv("DOCKER_TLS_VERIFY") != ""
+}
+
+func tlsConfig(serverName string) (*tls.Config, error) {
+	dir := os.Getenv("DOCKER_CERT_PATH")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".docker")
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load TLS client certificate: %v", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read TLS CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// dialSSH tunnels through "docker system dial-stdio" like the docker CLI
+func dialSSH(e *Endpoint) (net.Conn, error) {
+	args := []string{"-o", "BatchMode=yes"}
+	if e.Port != "" {
+		args = append(args, "-p", e.Port)
+	}
+	target := e.Host
+	if e.User != "" {
+		target = e.User + "@" + e.Host
+	}
+	args = append(args, "--", target, "docker", "system", "dial-stdio")
+
+	// The tunnel outlives the dial context, it is torn down by Close
+	cmd := exec.Command("ssh", args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = io.Discard
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, remote: e.String()}, nil
+}
+
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	remote string
+}
+
+func (c *commandConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *commandConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+func (c *commandConn) Close() error {
+	c.stdin.Close()
+	c.stdout.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr                { return commandAddr("local") }
+func (c *commandConn) RemoteAddr() net.Addr               { return commandAddr(c.remote) }
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type commandAddr string
+
+func (a commandAddr) Network() string { return "cmd" }
+func (a commandAddr) String() string  { return string(a) }
@@ -0,0 +1,127 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"reddock/pkg/config"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	t.Setenv("DOCKER_TLS_VERIFY", "")
+
+	cases := []struct {
+		raw      string
+		want     string
+		hostname string
+	}{
+		{"unix:///var/run/docker.sock", "unix:///var/run/docker.sock", "localhost"},
+		{"tcp://10.0.0.5", "tcp://10.0.0.5:2375", "10.0.0.5"},
+		{"tcp://lab:2376", "tcp://lab:2376", "lab"},
+		{"ssh://root@build-box", "ssh://root@build-box", "build-box"},
+		{"ssh://me@build-box:2222/run/podman/podman.sock", "ssh://me@build-box:2222/run/podman/podman.sock", "build-box"},
+	}
+	for _, tc := range cases {
+		ep, err := ParseEndpoint(tc.raw)
+		if err != nil {
+			t.Fatalf("ParseEndpoint(%q): %v", tc.raw, err)
+		}
+		if got := ep.String(); got != tc.want {
+			t.Errorf("ParseEndpoint(%q).String() = %q, want %q", tc.raw, got, tc.want)
+		}
+		if got := ep.Hostname(); got != tc.hostname {
+			t.Errorf("ParseEndpoint(%q).Hostname() = %q, want %q", tc.raw, got, tc.hostname)
+		}
+	}
+
+	for _, raw := range []string{"http://host", "tcp://", "unix://", "ssh://"} {
+		if _, err := ParseEndpoint(raw); err == nil {
+			t.Errorf("ParseEndpoint(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestParseEndpointTLSDefaultPort(t *testing.T) {
+	t.Setenv("DOCKER_TLS_VERIFY", "1")
+
+	ep, err := ParseEndpoint("tcp://lab")
+	if err != nil {
+		t.Fatalf("ParseEndpoint: %v", err)
+	}
+	if ep.Port != "2376" {
+		t.Errorf("port = %q, want 2376", ep.Port)
+	}
+}
+
+func TestADBAddress(t *testing.T) {
+	c := &config.Container{Name: "a", Port: 5557}
+	if got := ADBAddress(c); got != "localhost:5557" {
+		t.Errorf("local ADBAddress = %q", got)
+	}
+	c.Host = "ssh://root@build-box"
+	if got := ADBAddress(c); got != "build-box:5557" {
+		t.Errorf("remote ADBAddress = %q", got)
+	}
+}
+
+func TestEngineRuntimeOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	engine := &standInEngine{containers: map[string]*standInContainer{
+		"remote": {name: "remote", image: "redroid/redroid:13.0.0-latest", running: true},
+	}}
+	server := &http.Server{Handler: engine}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	ep, err := ParseEndpoint("tcp://" + listener.Addr().String())
+	if err != nil {
+		t.Fatalf("ParseEndpoint: %v", err)
+	}
+	runtime := NewEngineRuntimeAt(ep)
+	if !runtime.IsRunning(context.Background(), "remote") {
+		t.Error("container on the tcp endpoint is not reported running")
+	}
+}
+
+func TestUnreachableHostIsRuntimeUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ep, _ := ParseEndpoint("tcp://" + addr)
+	_, err = NewEngineRuntimeAt(ep).InspectContainer(context.Background(), "remote")
+	if !errors.Is(err, ErrRuntimeUnavailable) {
+		t.Errorf("err = %v, want ErrRuntimeUnavailable", err)
+	}
+}
+
+func TestRemoteContainerKeepsItsHost(t *testing.T) {
+	c := &config.Container{Name: "remote", Runtime: RuntimeNerdctl, Host: "tcp://10.0.0.5:2375"}
+
+	// nerdctl cannot reach a remote host, the fallback must still target it
+	runtime := NewRuntimeForContainer(config.GetDefault(), c)
+	if _, local := runtime.(*NerdctlRuntime); local {
+		t.Fatal("remote container fell back to a local nerdctl runtime")
+	}
+	switch r := runtime.(type) {
+	case *GenericRuntime:
+		if len(r.globalArgs) != 2 || r.globalArgs[1] != "tcp://10.0.0.5:2375" {
+			t.Errorf("globalArgs = %v", r.globalArgs)
+		}
+	case *EngineRuntime:
+		if got := r.client.endpoint.String(); got != "tcp://10.0.0.5:2375" {
+			t.Errorf("endpoint = %s", got)
+		}
+	default:
+		t.Errorf("unexpected runtime %T", runtime)
+	}
+}
@@ -0,0 +1,393 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"reddock/pkg/config"
+)
+
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// EngineRuntime talks to the Docker Engine API instead of the docker CLI
+type EngineRuntime struct {
+	client *apiClient
+}
+
+// DockerSocketPath returns the daemon socket, honouring a unix:// DOCKER_HOST
+func DockerSocketPath() string {
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://")
+	}
+	return DefaultDockerSocket
+}
+
+func NewEngineRuntime(socketPath string) *EngineRuntime {
+	return NewEngineRuntimeAt(unixEndpoint(socketPath))
+}
+
+func NewEngineRuntimeAt(ep *Endpoint) *EngineRuntime {
+	return &EngineRuntime{client: newAPIClient(ep, "")}
+}
+
+type engineCreateRequest struct {
+	Image        string              `json:"Image"`
+	Hostname     string              `json:"Hostname,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	HostConfig   engineHostConfig    `json:"HostConfig"`
+	// NetworkingConfig carries the static address on the joined network
+	NetworkingConfig *engineNetworkingConfig `json:"NetworkingConfig,omitempty"`
+}
+
+type engineNetworkingConfig struct {
+	EndpointsConfig map[string]engineEndpoint `json:"EndpointsConfig"`
+}
+
+type engineEndpoint struct {
+	IPAMConfig *engineIPAMConfig `json:"IPAMConfig,omitempty"`
+}
+
+type engineIPAMConfig struct {
+	IPv4Address string `json:"IPv4Address,omitempty"`
+}
+
+type engineNetworkRequest struct {
+	Name    string            `json:"Name"`
+	Driver  string            `json:"Driver,omitempty"`
+	IPAM    *engineIPAM       `json:"IPAM,omitempty"`
+	Options map[string]string `json:"Options,omitempty"`
+}
+
+type engineIPAM struct {
+	Config []engineIPAMPool `json:"Config"`
+}
+
+type engineIPAMPool struct {
+	Subnet  string `json:"Subnet,omitempty"`
+	Gateway string `json:"Gateway,omitempty"`
+}
+
+type engineHostConfig struct {
+	Privileged   bool                           `json:"Privileged"`
+	Binds        []string                       `json:"Binds,omitempty"`
+	PortBindings map[string][]enginePortBinding `json:"PortBindings,omitempty"`
+	NanoCPUs     int64                          `json:"NanoCpus,omitempty"`
+	Memory       int64                          `json:"Memory,omitempty"`
+	CpusetCpus   string                         `json:"CpusetCpus,omitempty"`
+	PidsLimit    int64                          `json:"PidsLimit,omitempty"`
+	Devices      []engineDevice                 `json:"Devices,omitempty"`
+	NetworkMode  string                         `json:"NetworkMode,omitempty"`
+}
+
+type engineDevice struct {
+	PathOnHost        string `json:"PathOnHost"`
+	PathInContainer   string `json:"PathInContainer"`
+	CgroupPermissions string `json:"CgroupPermissions"`
+}
+
+type enginePortBinding struct {
+	HostIP   string `json:"HostIp,omitempty"`
+	HostPort string `json:"HostPort"`
+}
+
+func (r *EngineRuntime) Name() string {
+	return "docker-api"
+}
+
+// Command falls back to the docker CLI for exec, logs and cp
+func (r *EngineRuntime) Command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "docker", append([]string{"-H", r.client.endpoint.String()}, args...)...)
+	if cmd.Err != nil {
+		operation := "this command"
+		if len(args) > 0 {
+			operation = "'" + args[0] + "'"
+		}
+		cmd.Err = NewError(ErrRuntimeUnavailable, "",
+			"The %s runtime needs the docker CLI for %s, which is not installed", r.Name(), operation).Wrap(cmd.Err)
+	}
+	return cmd
+}
+
+func (r *EngineRuntime) IsInstalled(ctx context.Context) bool {
+	return r.client.ping(ctx, "/_ping")
+}
+
+func (r *EngineRuntime) PullImage(ctx context.Context, image string) error {
+	repo, tag := splitImageTag(image)
+	query := url.Values{"fromImage": {repo}, "tag": {tag}}
+	header := http.Header{"X-Registry-Auth": {registryAuthHeader(DockerConfigPath(), image)}}
+
+	resp, err := r.client.do(ctx, http.MethodPost, "/images/create", query, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return ContextError(ctx, readStream(resp.Body, os.Stdout))
+}
+
+func (r *EngineRuntime) PushImage(ctx context.Context, image string) error {
+	repo, tag := splitImageTag(image)
+	query := url.Values{"tag": {tag}}
+	header := http.Header{"X-Registry-Auth": {registryAuthHeader(DockerConfigPath(), image)}}
+
+	resp, err := r.client.do(ctx, http.MethodPost, "/images/"+repo+"/push", query, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return ContextError(ctx, readStream(resp.Body, os.Stdout))
+}
+
+func (r *EngineRuntime) Run(ctx context.Context, opts *RunOptions) error {
+	req := engineCreateRequest{
+		Image:    opts.Image,
+		Hostname: opts.Hostname,
+		Cmd:      opts.Args,
+		Env:      opts.Env,
+		Labels:   opts.Labels,
+		HostConfig: engineHostConfig{
+			Privileged: opts.Privileged,
+			CpusetCpus: opts.CPUSet,
+			PidsLimit:  opts.PidsLimit,
+		},
+	}
+	if opts.CPUs != "" {
+		cpus, err := strconv.ParseFloat(opts.CPUs, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid cpus '%s': %v", opts.CPUs, err)
+		}
+		req.HostConfig.NanoCPUs = int64(cpus * 1e9)
+	}
+	if opts.Memory != "" {
+		memory, err := config.ParseMemorySize(opts.Memory)
+		if err != nil {
+			return err
+		}
+		req.HostConfig.Memory = memory
+	}
+	for _, d := range opts.Devices {
+		host, target, perms := parseDevice(d)
+		req.HostConfig.Devices = append(req.HostConfig.Devices, engineDevice{host, target, perms})
+	}
+	for _, v := range opts.Volumes {
+		req.HostConfig.Binds = append(req.HostConfig.Binds, v.String())
+	}
+	req.HostConfig.NetworkMode = opts.Network
+	if opts.IPAddress != "" {
+		req.NetworkingConfig = &engineNetworkingConfig{EndpointsConfig: map[string]engineEndpoint{
+			opts.Network: {IPAMConfig: &engineIPAMConfig{IPv4Address: opts.IPAddress}},
+		}}
+	}
+	if len(opts.Ports) > 0 {
+		req.ExposedPorts = make(map[string]struct{})
+		req.HostConfig.PortBindings = make(map[string][]enginePortBinding)
+		for _, p := range opts.Ports {
+			key := fmt.Sprintf("%d/%s", p.ContainerPort, p.proto())
+			req.ExposedPorts[key] = struct{}{}
+			req.HostConfig.PortBindings[key] = append(req.HostConfig.PortBindings[key],
+				enginePortBinding{HostPort: strconv.Itoa(p.HostPort)})
+		}
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	query := url.Values{"name": {opts.Name}}
+	if err := r.client.doJSON(ctx, http.MethodPost, "/containers/create", query, req, &created); err != nil {
+		return classify(err, ErrImageMissing, opts.Name)
+	}
+	if err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+created.ID+"/start", nil, nil, nil); err != nil {
+		// Do not leave a created but never started container behind
+		r.Remove(ctx, created.ID, true)
+		return classify(err, ErrContainerNotFound, opts.Name)
+	}
+	return nil
+}
+
+func (r *EngineRuntime) Build(ctx context.Context, contextDir, tag string) error {
+	body, err := tarDirectory(contextDir)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	query := url.Values{"t": {tag}}
+	header := http.Header{"Content-Type": {"application/x-tar"}}
+	resp, err := r.client.do(ctx, http.MethodPost, "/build", query, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var output bytes.Buffer
+	if err := readStream(resp.Body, &output); err != nil {
+		if ctx.Err() != nil {
+			return ContextError(ctx, err)
+		}
+		return fmt.Errorf("%v\n%s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+func (r *EngineRuntime) Stop(ctx context.Context, containerName string) error {
+	err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+containerName+"/stop", nil, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *EngineRuntime) StartExisting(ctx context.Context, containerName string) error {
+	err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+containerName+"/start", nil, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *EngineRuntime) Pause(ctx context.Context, containerName string) error {
+	err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+containerName+"/pause", nil, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *EngineRuntime) Unpause(ctx context.Context, containerName string) error {
+	err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+containerName+"/unpause", nil, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *EngineRuntime) Rename(ctx context.Context, containerName, newName string) error {
+	query := url.Values{"name": {newName}}
+	err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+containerName+"/rename", query, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *EngineRuntime) Remove(ctx context.Context, containerName string, force bool) error {
+	query := url.Values{"force": {strconv.FormatBool(force)}}
+	err := r.client.doJSON(ctx, http.MethodDelete, "/containers/"+containerName, query, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *EngineRuntime) RemoveImage(ctx context.Context, image string) error {
+	err := r.client.doJSON(ctx, http.MethodDelete, "/images/"+image, nil, nil, nil)
+	return classify(err, ErrImageMissing, "")
+}
+
+func (r *EngineRuntime) ImageExists(ctx context.Context, image string) bool {
+	return r.client.doJSON(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil, nil) == nil
+}
+
+func (r *EngineRuntime) NetworkExists(ctx context.Context, name string) bool {
+	return r.client.doJSON(ctx, http.MethodGet, "/networks/"+name, nil, nil, nil) == nil
+}
+
+func (r *EngineRuntime) CreateNetwork(ctx context.Context, opts *NetworkOptions) error {
+	req := engineNetworkRequest{Name: opts.Name, Driver: opts.Driver}
+	if opts.Subnet != "" || opts.Gateway != "" {
+		req.IPAM = &engineIPAM{Config: []engineIPAMPool{{Subnet: opts.Subnet, Gateway: opts.Gateway}}}
+	}
+	if opts.Parent != "" {
+		req.Options = map[string]string{"parent": opts.Parent}
+	}
+	if err := r.client.doJSON(ctx, http.MethodPost, "/networks/create", nil, req, nil); err != nil {
+		return fmt.Errorf("Failed to create network '%s': %w", opts.Name, err)
+	}
+	return nil
+}
+
+func (r *EngineRuntime) InspectContainer(ctx context.Context, containerName string) (*ContainerInfo, error) {
+	var doc containerJSON
+	if err := r.client.doJSON(ctx, http.MethodGet, "/containers/"+containerName+"/json", nil, nil, &doc); err != nil {
+		return nil, classify(err, ErrContainerNotFound, containerName)
+	}
+	return doc.info(), nil
+}
+
+// Stats asks for one sample, the engine takes a second reading for the CPU usage
+func (r *EngineRuntime) Stats(ctx context.Context, containerName string) (*ContainerStats, error) {
+	var doc engineStatsJSON
+	query := url.Values{"stream": {"false"}}
+	if err := r.client.doJSON(ctx, http.MethodGet, "/containers/"+containerName+"/stats", query, nil, &doc); err != nil {
+		return nil, classify(err, ErrContainerNotFound, containerName)
+	}
+	return doc.stats(containerName), nil
+}
+
+func (r *EngineRuntime) ListContainers(ctx context.Context) ([]*ContainerInfo, error) {
+	var summaries []struct {
+		ID string `json:"Id"`
+	}
+	query := url.Values{"all": {"true"}}
+	if err := r.client.doJSON(ctx, http.MethodGet, "/containers/json", query, nil, &summaries); err != nil {
+		return nil, err
+	}
+	var infos []*ContainerInfo
+	for _, s := range summaries {
+		info, err := r.InspectContainer(ctx, s.ID)
+		if errors.Is(err, ErrContainerNotFound) {
+			// Removed since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (r *EngineRuntime) Exists(ctx context.Context, containerName string) bool {
+	_, err := r.InspectContainer(ctx, containerName)
+	return err == nil
+}
+
+func (r *EngineRuntime) IsRunning(ctx context.Context, containerName string) bool {
+	info, err := r.InspectContainer(ctx, containerName)
+	if err != nil {
+		return false
+	}
+	return info.Running
+}
+
+func (r *EngineRuntime) Events(ctx context.Context, containers []string) (<-chan Event, <-chan error) {
+	return r.client.events(ctx, containers)
+}
+
+func (r *EngineRuntime) PruneImages(ctx context.Context) (string, error) {
+	var report struct {
+		ImagesDeleted []struct {
+			Untagged string `json:"Untagged"`
+			Deleted  string `json:"Deleted"`
+		} `json:"ImagesDeleted"`
+		SpaceReclaimed int64 `json:"SpaceReclaimed"`
+	}
+	if err := r.client.doJSON(ctx, http.MethodPost, "/images/prune", nil, nil, &report); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if len(report.ImagesDeleted) > 0 {
+		out.WriteString("Deleted Images:\n")
+		for _, item := range report.ImagesDeleted {
+			if item.Untagged != "" {
+				out.WriteString(fmt.Sprintf("untagged: %s\n", item.Untagged))
+			}
+			if item.Deleted != "" {
+				out.WriteString(fmt.Sprintf("deleted: %s\n", item.Deleted))
+			}
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString(fmt.Sprintf("Total reclaimed space: %s\n", formatBytes(report.SpaceReclaimed)))
+	return out.String(), nil
+}
+
+// IsAuthenticated reads the CLI config, the Engine API does not expose the login
+func (r *EngineRuntime) IsAuthenticated(ctx context.Context) (bool, string, error) {
+	user, _, ok := lookupCredentials(DockerConfigPath(), dockerHubRegistry)
+	return ok, user, nil
+}
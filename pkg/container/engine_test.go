@@ -0,0 +1,317 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// standInEngine is a tiny in-process imitation of the Engine API
+type standInEngine struct {
+	mu         sync.Mutex
+	containers map[string]*standInContainer
+	lastCreate engineCreateRequest
+	startError string
+}
+
+type standInContainer struct {
+	name    string
+	image   string
+	labels  map[string]string
+	running bool
+}
+
+func startStandInEngine(t *testing.T) (*standInEngine, string) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	engine := &standInEngine{containers: make(map[string]*standInContainer)}
+	server := &http.Server{Handler: engine}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return engine, socket
+}
+
+func (e *standInEngine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	path := req.URL.Path
+	switch {
+	case path == "/_ping":
+		w.Write([]byte("OK"))
+
+	case path == "/events":
+		// A short finite stream: one unrelated event and two for the
+		// filtered container
+		for _, line := range []string{
+			`{"Type":"image","Action":"pull","Actor":{"ID":"img","Attributes":{"name":"redroid"}}}`,
+			`{"Type":"container","Action":"start","Actor":{"ID":"1","Attributes":{"name":"android"}},"timeNano":1}`,
+			`{"Type":"container","Action":"die","Actor":{"ID":"1","Attributes":{"name":"android","exitCode":"0"}},"timeNano":2}`,
+		} {
+			w.Write([]byte(line + "\n"))
+		}
+
+	case path == "/containers/create" && req.Method == http.MethodPost:
+		name := req.URL.Query().Get("name")
+		if _, exists := e.containers[name]; exists {
+			writeStandInError(w, http.StatusConflict, "Conflict. The container name \"/"+name+"\" is already in use")
+			return
+		}
+		json.NewDecoder(req.Body).Decode(&e.lastCreate)
+		e.containers[name] = &standInContainer{name: name, image: e.lastCreate.Image, labels: e.lastCreate.Labels}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"Id": name})
+
+	case path == "/containers/json":
+		var summaries []map[string]string
+		for name := range e.containers {
+			summaries = append(summaries, map[string]string{"Id": name})
+		}
+		json.NewEncoder(w).Encode(summaries)
+
+	case strings.HasPrefix(path, "/containers/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/containers/"), "/")
+		c, ok := e.containers[parts[0]]
+		if !ok {
+			writeStandInError(w, http.StatusNotFound, "No such container: "+parts[0])
+			return
+		}
+		action := ""
+		if len(parts) > 1 {
+			action = parts[1]
+		}
+		switch {
+		case action == "json":
+			status := "exited"
+			if c.running {
+				status = "running"
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"Id":     c.name,
+				"Name":   "/" + c.name,
+				"Config": map[string]interface{}{"Image": c.image, "Labels": c.labels},
+				"State":  map[string]interface{}{"Status": status, "Running": c.running},
+				"NetworkSettings": map[string]interface{}{
+					"Networks": map[string]interface{}{"bridge": map[string]string{"IPAddress": "172.17.0.2"}},
+				},
+			})
+		case action == "start":
+			if e.startError != "" {
+				writeStandInError(w, http.StatusInternalServerError, e.startError)
+				return
+			}
+			if c.running {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			c.running = true
+			w.WriteHeader(http.StatusNoContent)
+		case action == "stop":
+			if !c.running {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			c.running = false
+			w.WriteHeader(http.StatusNoContent)
+		case action == "" && req.Method == http.MethodDelete:
+			if c.running && req.URL.Query().Get("force") != "true" {
+				writeStandInError(w, http.StatusConflict, "You cannot remove a running container")
+				return
+			}
+			delete(e.containers, c.name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, req)
+		}
+
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func writeStandInError(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func TestEngineRuntimeLifecycle(t *testing.T) {
+	engine, socket := startStandInEngine(t)
+	rt := NewEngineRuntime(socket)
+
+	if !rt.IsInstalled(context.Background()) {
+		t.Fatal("expected stand-in engine to answer ping")
+	}
+	if rt.Exists(context.Background(), "android") {
+		t.Fatal("container should not exist yet")
+	}
+
+	opts := &RunOptions{
+		Name:       "android",
+		Hostname:   "android",
+		Image:      "redroid/redroid:13.0.0-latest",
+		Privileged: true,
+		Volumes:    []VolumeMount{{Source: "/srv/data-android", Target: "/data", Options: "z"}},
+		Ports:      []PortMapping{{HostPort: 5556, ContainerPort: 5555}},
+		Args:       []string{"androidboot.redroid_gpu_mode=auto"},
+		Labels:     map[string]string{LabelManaged: "true", LabelName: "android"},
+	}
+	if err := rt.Run(context.Background(), opts); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	req := engine.lastCreate
+	if !req.HostConfig.Privileged {
+		t.Error("expected privileged container")
+	}
+	if len(req.HostConfig.Binds) != 1 || req.HostConfig.Binds[0] != "/srv/data-android:/data:z" {
+		t.Errorf("unexpected binds: %v", req.HostConfig.Binds)
+	}
+	if got := req.HostConfig.PortBindings["5555/tcp"]; len(got) != 1 || got[0].HostPort != "5556" {
+		t.Errorf("unexpected port bindings: %v", req.HostConfig.PortBindings)
+	}
+
+	if !rt.IsRunning(context.Background(), "android") {
+		t.Fatal("container should be running after Run")
+	}
+	info, err := rt.InspectContainer(context.Background(), "android")
+	if err != nil {
+		t.Fatalf("InspectContainer: %v", err)
+	}
+	if info.Name != "android" || info.Status != "running" || info.IPAddress != "172.17.0.2" {
+		t.Errorf("unexpected inspect result: %+v", info)
+	}
+	infos, err := rt.ListContainers(context.Background())
+	if err != nil {
+		t.Fatalf("ListContainers: %v", err)
+	}
+	if len(infos) != 1 || !infos[0].Managed() || infos[0].Labels[LabelName] != "android" {
+		t.Errorf("unexpected container list: %+v", infos)
+	}
+
+	if err := rt.Stop(context.Background(), "android"); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := rt.Stop(context.Background(), "android"); err != nil {
+		t.Fatalf("Stop on stopped container should be a no-op: %v", err)
+	}
+	if rt.IsRunning(context.Background(), "android") {
+		t.Fatal("container should be stopped")
+	}
+
+	if err := rt.Remove(context.Background(), "android", false); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if rt.Exists(context.Background(), "android") {
+		t.Fatal("container should be gone after Remove")
+	}
+}
+
+func TestEngineRuntimeErrors(t *testing.T) {
+	_, socket := startStandInEngine(t)
+	rt := NewEngineRuntime(socket)
+
+	_, err := rt.InspectContainer(context.Background(), "missing")
+	if !isStatus(err, http.StatusNotFound) {
+		t.Fatalf("expected 404 APIError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "No such container") {
+		t.Errorf("expected engine message in error, got %q", err.Error())
+	}
+
+	opts := &RunOptions{Name: "dup", Image: "redroid/redroid:13.0.0-latest"}
+	if err := rt.Run(context.Background(), opts); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := rt.Run(context.Background(), opts); !isStatus(err, http.StatusConflict) {
+		t.Fatalf("expected 409 APIError for duplicate name, got %v", err)
+	}
+	if err := rt.Remove(context.Background(), "dup", false); !isStatus(err, http.StatusConflict) {
+		t.Fatalf("expected 409 APIError removing running container, got %v", err)
+	}
+}
+
+func TestEngineRuntimeRunRemovesUnstartedContainer(t *testing.T) {
+	engine, socket := startStandInEngine(t)
+	engine.startError = "driver failed programming external connectivity: Bind for 0.0.0.0:5555 failed: port is already allocated"
+	rt := NewEngineRuntime(socket)
+
+	err := rt.Run(context.Background(), &RunOptions{Name: "android", Image: "redroid/redroid:13.0.0-latest"})
+	if !isStatus(err, http.StatusInternalServerError) || !strings.Contains(err.Error(), "port is already allocated") {
+		t.Fatalf("Run = %v, want the start error", err)
+	}
+	if rt.Exists(context.Background(), "android") {
+		t.Error("the container that failed to start should be removed")
+	}
+}
+
+func TestEngineRuntimeUnavailable(t *testing.T) {
+	rt := NewEngineRuntime(filepath.Join(t.TempDir(), "absent.sock"))
+	if rt.IsInstalled(context.Background()) {
+		t.Fatal("expected missing socket to report not installed")
+	}
+	if err := rt.StartExisting(context.Background(), "android"); err == nil {
+		t.Fatal("expected connection error")
+	}
+}
+
+func TestEngineRuntimeCommandWithoutCLI(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	rt := NewEngineRuntime(filepath.Join(t.TempDir(), "docker.sock"))
+
+	err := rt.Command(context.Background(), "exec", "android", "sh").Run()
+	if !errors.Is(err, ErrRuntimeUnavailable) {
+		t.Fatalf("err = %v, want ErrRuntimeUnavailable", err)
+	}
+	// Callers with another way in, such as adb, still see the missing binary
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("err = %v does not wrap exec.ErrNotFound", err)
+	}
+	if !strings.Contains(err.Error(), "'exec'") {
+		t.Errorf("error does not name the operation: %v", err)
+	}
+}
+
+func TestEngineRuntimeResourceLimits(t *testing.T) {
+	engine, socket := startStandInEngine(t)
+	rt := NewEngineRuntime(socket)
+
+	err := rt.Run(context.Background(), &RunOptions{
+		Name:      "limited",
+		Image:     "redroid/redroid:13.0.0-latest",
+		CPUs:      "1.5",
+		Memory:    "512m",
+		CPUSet:    "0-1",
+		PidsLimit: 256,
+		Devices:   []string{"/dev/kvm", "/dev/dri/card0:/dev/dri/card0:rw"},
+		Env:       []string{"TZ=UTC"},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	host := engine.lastCreate.HostConfig
+	if host.NanoCPUs != 1500000000 || host.Memory != 512<<20 || host.CpusetCpus != "0-1" || host.PidsLimit != 256 {
+		t.Errorf("unexpected limits: %+v", host)
+	}
+	if len(host.Devices) != 2 || host.Devices[0].PathInContainer != "/dev/kvm" || host.Devices[0].CgroupPermissions != "rwm" ||
+		host.Devices[1].CgroupPermissions != "rw" {
+		t.Errorf("unexpected devices: %+v", host.Devices)
+	}
+	if len(engine.lastCreate.Env) != 1 || engine.lastCreate.Env[0] != "TZ=UTC" {
+		t.Errorf("unexpected env: %v", engine.lastCreate.Env)
+	}
+}
@@ -0,0 +1,84 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Sentinel error kinds, match them with errors.Is
+var (
+	ErrContainerNotFound  = errors.New("container not found")
+	ErrNotInitialized     = errors.New("container not initialized")
+	ErrNotRunning         = errors.New("container not running")
+	ErrImageMissing       = errors.New("image missing")
+	ErrRuntimeUnavailable = errors.New("container runtime unavailable")
+	ErrBinderMissing      = errors.New("binder devices missing")
+	ErrTimeout            = errors.New("operation timed out")
+	ErrCanceled           = errors.New("operation canceled")
+	ErrContainerDied      = errors.New("container died")
+	ErrPortInUse          = errors.New("port in use")
+	ErrBusy               = errors.New("container busy")
+)
+
+// Error is a lifecycle failure of a known kind
+type Error struct {
+	Kind      error
+	Container string
+	Message   string
+	Err       error
+}
+
+func NewError(kind error, containerName string, format string, args ...interface{}) *Error {
+	return &Error{
+		Kind:      kind,
+		Container: containerName,
+		Message:   fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+func notFoundError(containerName string) *Error {
+	return NewError(ErrContainerNotFound, containerName,
+		"Container '%s' not found. Run 'reddock init %s' first", containerName, containerName)
+}
+
+func notRunningError(containerName string) *Error {
+	return NewError(ErrNotRunning, containerName,
+		"Container '%s' is not running. Start it with 'reddock start %s'", containerName, containerName)
+}
+
+// ContextError maps ctx ending onto ErrTimeout or ErrCanceled
+func ContextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return NewError(ErrTimeout, "", "Operation timed out").Wrap(err)
+	case context.Canceled:
+		return NewError(ErrCanceled, "", "Operation canceled").Wrap(err)
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLifecycleErrorKinds(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+
+	err := NewManagerWith(newMemStore(), rt, "missing").Start(context.Background(), false)
+	if !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("Start on unknown container = %v, want ErrContainerNotFound", err)
+	}
+
+	c := testContainer(t, "android")
+	c.Initialized = false
+	err = NewManagerWith(newMemStore(c), rt, "android").Start(context.Background(), false)
+	if !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Start on uninitialized container = %v, want ErrNotInitialized", err)
+	}
+
+	err = NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android").Stop(context.Background(), false)
+	if !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Stop on missing container = %v, want ErrNotRunning", err)
+	}
+
+	err = NewRemoverWith(newMemStore(), rt, "missing").Remove(context.Background(), true)
+	if !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("Remove on unknown container = %v, want ErrContainerNotFound", err)
+	}
+}
+
+func TestStartSurfacesRuntimeUnavailable(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.failOn("Run", NewError(ErrRuntimeUnavailable, "", "Cannot connect to the engine"))
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if err := mgr.Start(context.Background(), false); !errors.Is(err, ErrRuntimeUnavailable) {
+		t.Fatalf("Start = %v, want ErrRuntimeUnavailable", err)
+	}
+}
+
+func TestErrorWrapKeepsCause(t *testing.T) {
+	cause := errors.New("dial unix: no such file")
+	err := NewError(ErrRuntimeUnavailable, "", "Cannot connect").Wrap(cause)
+	if !errors.Is(err, cause) || !errors.Is(err, ErrRuntimeUnavailable) {
+		t.Fatal("wrapped error must match both kind and cause")
+	}
+	if err.Error() != "Cannot connect: dial unix: no such file" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+// stubCLI writes a runtime binary that prints stderr and fails
+func stubCLI(t *testing.T, stderr string) *GenericRuntime {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "docker")
+	script := "#!/bin/sh\necho '" + stderr + "' >&2\nexit 1\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &GenericRuntime{binary: path}
+}
+
+func TestCLIErrorClassification(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   error
+	}{
+		{"Error: No such container: android", ErrContainerNotFound},
+		{"Error response from daemon: no such object: android", ErrContainerNotFound},
+		{"Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?", ErrRuntimeUnavailable},
+		{"permission denied while trying to connect to the Docker daemon socket", ErrRuntimeUnavailable},
+	}
+	for _, tt := range tests {
+		rt := stubCLI(t, tt.stderr)
+		_, err := rt.InspectContainer(context.Background(), "android")
+		if !errors.Is(err, tt.want) {
+			t.Errorf("InspectContainer with %q = %v, want %v", tt.stderr, err, tt.want)
+		}
+		_, err = rt.Stats(context.Background(), "android")
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Stats with %q = %v, want %v", tt.stderr, err, tt.want)
+		}
+	}
+
+	_, err := stubCLI(t, "unexpected failure").InspectContainer(context.Background(), "android")
+	if err == nil || errors.Is(err, ErrContainerNotFound) || errors.Is(err, ErrRuntimeUnavailable) {
+		t.Fatalf("err = %v, want a generic error", err)
+	}
+	if !strings.Contains(err.Error(), "unexpected failure") {
+		t.Errorf("error does not carry stderr: %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"reddock/pkg/config"
+)
+
+// Event is a container state transition, named the way docker names it
+type Event struct {
+	Time      time.Time `json:"time"`
+	Container string    `json:"container"`
+	Action    string    `json:"action"`
+	Image     string    `json:"image,omitempty"`
+	// ExitCode is set on die events
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Host     string `json:"host,omitempty"`
+}
+
+func (e Event) String() string {
+	line := fmt.Sprintf("%s %s %s", e.Time.Format(time.RFC3339), e.Container, e.Action)
+	if e.ExitCode != nil {
+		line += fmt.Sprintf(" (exit code %d)", *e.ExitCode)
+	}
+	if e.Host != "" {
+		line += " on " + e.Host
+	}
+	return line
+}
+
+// normalizeAction maps podman and containerd spellings onto docker's
+func normalizeAction(action string) string {
+	switch action {
+	case "died", "exited":
+		return "die"
+	case "remove":
+		return "destroy"
+	}
+	return action
+}
+
+// engineEventJSON is one message of the docker-compatible event stream
+type engineEventJSON struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+func (m *engineEventJSON) event() (Event, bool) {
+	if m.Type != "" && m.Type != "container" {
+		return Event{}, false
+	}
+	ev := Event{
+		Time:      time.Unix(0, m.TimeNano),
+		Container: m.Actor.Attributes["name"],
+		Action:    normalizeAction(m.Action),
+		Image:     m.Actor.Attributes["image"],
+	}
+	if code, err := strconv.Atoi(m.Actor.Attributes["exitCode"]); err == nil {
+		ev.ExitCode = &code
+	}
+	return ev, ev.Container != ""
+}
+
+// podmanEventJSON is one line of "podman events --format json"
+type podmanEventJSON struct {
+	Name              string `json:"Name"`
+	Image             string `json:"Image"`
+	Status            string `json:"Status"`
+	Type              string `json:"Type"`
+	Time              string `json:"Time"`
+	ContainerExitCode *int   `json:"ContainerExitCode"`
+}
+
+func parseCLIEvent(line []byte) (Event, bool) {
+	var docker engineEventJSON
+	// podman lines share some keys, trust the docker shape only with an actor
+	if json.Unmarshal(line, &docker) == nil && docker.Actor.ID != "" {
+		return docker.event()
+	}
+
+	var podman podmanEventJSON
+	if err := json.Unmarshal(line, &podman); err != nil || podman.Type != "container" || podman.Name == "" {
+		return Event{}, false
+	}
+	ev := Event{
+		Time:      time.Now(),
+		Container: podman.Name,
+		Action:    normalizeAction(podman.Status),
+		Image:     podman.Image,
+	}
+	if t, err := time.Parse(time.RFC3339Nano, podman.Time); err == nil {
+		ev.Time = t
+	}
+	if ev.Action == "die" {
+		ev.ExitCode = podman.ContainerExitCode
+	}
+	return ev, true
+}
+
+// streamCommandEvents parses the output of an events command line by line
+func streamCommandEvents(ctx context.Context, cmd *exec.Cmd, parse func([]byte) (Event, bool)) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errs := make(chan error, 1)
+
+	fail := func(err error) (<-chan Event, <-chan error) {
+		errs <- err
+		close(errs)
+		close(events)
+		return events, errs
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fail(err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fail(NewError(ErrRuntimeUnavailable, "", "Failed to watch events").Wrap(err))
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			ev, ok := parse(scanner.Bytes())
+			if !ok {
+				continue
+			}
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+			}
+		}
+		if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+			errs <- fmt.Errorf("Event stream ended: %v %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}()
+	return events, errs
+}
+
+func (c *apiClient) events(ctx context.Context, containers []string) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errs := make(chan error, 1)
+
+	filters := map[string][]string{"type": {"container"}}
+	if len(containers) > 0 {
+		filters["container"] = containers
+	}
+	data, _ := json.Marshal(filters)
+	query := url.Values{"filters": {string(data)}}
+
+	resp, err := c.do(ctx, http.MethodGet, "/events", query, nil, nil)
+	if err != nil {
+		errs <- err
+		close(errs)
+		close(events)
+		return events, errs
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+		defer resp.Body.Close()
+
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var msg engineEventJSON
+			if err := decoder.Decode(&msg); err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					errs <- fmt.Errorf("Event stream ended: %v", err)
+				}
+				return
+			}
+			ev, ok := msg.event()
+			if !ok {
+				continue
+			}
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, errs
+}
+
+// EventStreamer prints the events of reddock containers on every runtime and host
+type EventStreamer struct {
+	config  *config.Config
+	runtime Runtime
+}
+
+func NewEventStreamer() *EventStreamer {
+	return NewEventStreamerWith(config.NewFileStore(), nil)
+}
+
+func NewEventStreamerWith(store config.Store, runtime Runtime) *EventStreamer {
+	return &EventStreamer{config: config.LoadOrDefault(store), runtime: runtime}
+}
+
+// Stream prints events until ctx ends, for every container when names is empty
+func (s *EventStreamer) Stream(ctx context.Context, names []string, out io.Writer, asJSON bool) error {
+	containers := s.config.ListContainers()
+	if len(names) > 0 {
+		containers = nil
+		for _, name := range names {
+			c := s.config.GetContainer(name)
+			if c == nil {
+				return notFoundError(name)
+			}
+			containers = append(containers, c)
+		}
+	}
+	if len(containers) == 0 {
+		fmt.Fprintln(out, "No Reddock containers found.")
+		return nil
+	}
+
+	// One subscription per backend and host
+	type group struct {
+		runtime Runtime
+		host    string
+		names   []string
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, c := range containers {
+		key := c.Runtime + "|" + c.Host
+		g, ok := groups[key]
+		if !ok {
+			runtime := s.runtime
+			if runtime == nil {
+				runtime = NewRuntimeForContainer(s.config, c)
+			}
+			g = &group{runtime: runtime, host: c.Host}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.names = append(g.names, c.Name)
+	}
+
+	merged := make(chan Event)
+	failures := make(chan error, len(groups))
+	var wg sync.WaitGroup
+	for _, key := range order {
+		g := groups[key]
+		events, errs := g.runtime.Events(ctx, g.names)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ev := range events {
+				ev.Host = g.host
+				select {
+				case merged <- ev:
+				case <-ctx.Done():
+				}
+			}
+			if err := <-errs; err != nil {
+				failures <- fmt.Errorf("%s: %w", hostLabel(g.host), err)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	encoder := json.NewEncoder(out)
+	for ev := range merged {
+		if asJSON {
+			encoder.Encode(ev)
+		} else {
+			fmt.Fprintln(out, ev.String())
+		}
+	}
+	close(failures)
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return <-failures
+}
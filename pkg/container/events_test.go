@@ -0,0 +1,118 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCLIEventDocker(t *testing.T) {
+	line := `{"status":"die","id":"abc","from":"redroid/redroid:13.0.0-latest","Type":"container","Action":"die",` +
+		`"Actor":{"ID":"abc","Attributes":{"exitCode":"137","image":"redroid/redroid:13.0.0-latest","name":"android"}},` +
+		`"scope":"local","time":1700000000,"timeNano":1700000000000000000}`
+
+	ev, ok := parseCLIEvent([]byte(line))
+	if !ok {
+		t.Fatal("docker event was not parsed")
+	}
+	if ev.Container != "android" || ev.Action != "die" || ev.ExitCode == nil || *ev.ExitCode != 137 {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+	if !ev.Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("time = %v", ev.Time)
+	}
+}
+
+func TestParseCLIEventPodman(t *testing.T) {
+	line := `{"ID":"abc","Image":"docker.io/redroid/redroid:13.0.0-latest","Name":"android","Status":"died",` +
+		`"Time":"2024-01-02T03:04:05.000000006Z","Type":"container","Attributes":{},"ContainerExitCode":1}`
+
+	ev, ok := parseCLIEvent([]byte(line))
+	if !ok {
+		t.Fatal("podman event was not parsed")
+	}
+	if ev.Container != "android" || ev.Action != "die" || ev.ExitCode == nil || *ev.ExitCode != 1 {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+	if ev.Time.Year() != 2024 {
+		t.Errorf("time = %v", ev.Time)
+	}
+}
+
+func TestParseNerdctlEvent(t *testing.T) {
+	line := `{"Timestamp":"2024-01-02T03:04:05Z","Namespace":"default","Topic":"/tasks/exit",` +
+		`"Event":"{\"container_id\":\"abc123\",\"id\":\"abc123\",\"pid\":42,\"exit_status\":2}"}`
+
+	ev, ok := parseNerdctlEvent([]byte(line))
+	if !ok {
+		t.Fatal("nerdctl event was not parsed")
+	}
+	if ev.Container != "abc123" || ev.Action != "die" || ev.ExitCode == nil || *ev.ExitCode != 2 {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	if _, ok := parseNerdctlEvent([]byte(`{"Topic":"/images/update","Event":"{}"}`)); ok {
+		t.Error("image events must be skipped")
+	}
+}
+
+func TestEngineEvents(t *testing.T) {
+	_, socket := startStandInEngine(t)
+	runtime := NewEngineRuntime(socket)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, errs := runtime.Events(ctx, []string{"android"})
+
+	var got []string
+	for ev := range events {
+		got = append(got, ev.Container+" "+ev.Action)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream error: %v", err)
+	}
+	if strings.Join(got, ",") != "android start,android die" {
+		t.Errorf("events = %v", got)
+	}
+}
+
+func TestEventStreamerJSON(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.events = make(chan Event, 2)
+	code := 0
+	rt.events <- Event{Time: time.Unix(0, 0), Container: "a", Action: "start"}
+	rt.events <- Event{Time: time.Unix(0, 0), Container: "a", Action: "die", ExitCode: &code}
+	close(rt.events)
+
+	streamer := NewEventStreamerWith(newMemStore(testContainer(t, "a"), testContainer(t, "b")), rt)
+	var out bytes.Buffer
+	if err := streamer.Stream(context.Background(), nil, &out, true); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if !rt.called("Events a b") {
+		t.Errorf("expected one subscription for both containers, calls: %v", rt.calls)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("output = %q", out.String())
+	}
+	var ev Event
+	if err := json.Unmarshal([]byte(lines[1]), &ev); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", lines[1], err)
+	}
+	if ev.Action != "die" || ev.ExitCode == nil || *ev.ExitCode != 0 {
+		t.Errorf("decoded event = %+v", ev)
+	}
+}
+
+func TestEventStreamerUnknownContainer(t *testing.T) {
+	streamer := NewEventStreamerWith(newMemStore(), newFakeRuntime())
+	err := streamer.Stream(context.Background(), []string{"missing"}, &bytes.Buffer{}, false)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,426 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"reddock/pkg/config"
+)
+
+// fakeRuntime is an in-memory Runtime that records every call and keeps
+// just enough container state to drive the lifecycle code paths
+type fakeRuntime struct {
+	mu         sync.Mutex
+	calls      []string
+	containers map[string]*fakeContainer
+	images     map[string]bool
+	networks   map[string]*NetworkOptions
+	failures   map[string]error
+	lastRun    *RunOptions
+	// events feeds Events; nil means no event stream
+	events chan Event
+	// eventsErr makes the event stream fail right away
+	eventsErr error
+	// execOutput is printed by commands run through "exec"
+	execOutput string
+}
+
+type fakeContainer struct {
+	image    string
+	running  bool
+	paused   bool
+	exitCode int
+	ports    []PortMapping
+	labels   map[string]string
+	args     []string
+	mounts   []VolumeMount
+	stats    *ContainerStats
+}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{
+		containers: make(map[string]*fakeContainer),
+		images:     make(map[string]bool),
+		networks:   make(map[string]*NetworkOptions),
+		failures:   make(map[string]error),
+	}
+}
+
+// failOn makes the named method return err
+func (f *fakeRuntime) failOn(method string, err error) {
+	f.failures[method] = err
+}
+
+func (f *fakeRuntime) record(method string, args ...string) error {
+	f.calls = append(f.calls, strings.TrimSpace(method+" "+strings.Join(args, " ")))
+	return f.failures[method]
+}
+
+// called reports whether a call with the given prefix was recorded
+func (f *fakeRuntime) called(prefix string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, call := range f.calls {
+		if strings.HasPrefix(call, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeRuntime) Name() string { return "fake" }
+
+func (f *fakeRuntime) Command(ctx context.Context, args ...string) *exec.Cmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Command", args...)
+	if len(args) > 0 && args[0] == "exec" {
+		return exec.CommandContext(ctx, "printf", "%s", f.execOutput)
+	}
+	return exec.CommandContext(ctx, "true")
+}
+
+func (f *fakeRuntime) IsInstalled(ctx context.Context) bool { return true }
+
+func (f *fakeRuntime) PullImage(ctx context.Context, image string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("PullImage", image); err != nil {
+		return err
+	}
+	f.images[image] = true
+	return nil
+}
+
+func (f *fakeRuntime) PushImage(ctx context.Context, image string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.record("PushImage", image)
+}
+
+func (f *fakeRuntime) Run(ctx context.Context, opts *RunOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Run", opts.Name); err != nil {
+		return err
+	}
+	if _, exists := f.containers[opts.Name]; exists {
+		return fmt.Errorf("container name %q is already in use", opts.Name)
+	}
+	f.lastRun = opts
+	f.containers[opts.Name] = &fakeContainer{image: opts.Image, running: true, ports: opts.Ports,
+		labels: opts.Labels, args: opts.Args, mounts: opts.Volumes}
+	return nil
+}
+
+func (f *fakeRuntime) Build(ctx context.Context, contextDir, tag string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Build", contextDir, tag); err != nil {
+		return err
+	}
+	f.images[tag] = true
+	return nil
+}
+
+func (f *fakeRuntime) Stop(ctx context.Context, containerName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Stop", containerName); err != nil {
+		return err
+	}
+	c, ok := f.containers[containerName]
+	if !ok {
+		return NewError(ErrContainerNotFound, containerName, "no such container: %s", containerName)
+	}
+	c.running = false
+	c.paused = false
+	return nil
+}
+
+func (f *fakeRuntime) StartExisting(ctx context.Context, containerName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("StartExisting", containerName); err != nil {
+		return err
+	}
+	c, ok := f.containers[containerName]
+	if !ok {
+		return NewError(ErrContainerNotFound, containerName, "no such container: %s", containerName)
+	}
+	c.running = true
+	return nil
+}
+
+func (f *fakeRuntime) Pause(ctx context.Context, containerName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Pause", containerName); err != nil {
+		return err
+	}
+	c, ok := f.containers[containerName]
+	if !ok || !c.running {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	c.paused = true
+	return nil
+}
+
+func (f *fakeRuntime) Rename(ctx context.Context, containerName, newName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Rename", containerName, newName); err != nil {
+		return err
+	}
+	c, ok := f.containers[containerName]
+	if !ok {
+		return fmt.Errorf("no such container: %s", containerName)
+	}
+	if _, taken := f.containers[newName]; taken {
+		return fmt.Errorf("name %s is already in use", newName)
+	}
+	delete(f.containers, containerName)
+	f.containers[newName] = c
+	return nil
+}
+
+func (f *fakeRuntime) Unpause(ctx context.Context, containerName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Unpause", containerName); err != nil {
+		return err
+	}
+	c, ok := f.containers[containerName]
+	if !ok || !c.paused {
+		return fmt.Errorf("container %s is not paused", containerName)
+	}
+	c.paused = false
+	return nil
+}
+
+func (f *fakeRuntime) Remove(ctx context.Context, containerName string, force bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Remove", containerName); err != nil {
+		return err
+	}
+	c, ok := f.containers[containerName]
+	if !ok {
+		return NewError(ErrContainerNotFound, containerName, "no such container: %s", containerName)
+	}
+	if c.running && !force {
+		return fmt.Errorf("container %s is running", containerName)
+	}
+	delete(f.containers, containerName)
+	return nil
+}
+
+func (f *fakeRuntime) RemoveImage(ctx context.Context, image string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("RemoveImage", image); err != nil {
+		return err
+	}
+	delete(f.images, image)
+	return nil
+}
+
+func (f *fakeRuntime) ImageExists(ctx context.Context, image string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.images[image]
+}
+
+func (f *fakeRuntime) NetworkExists(ctx context.Context, name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.networks[name]
+	return ok
+}
+
+func (f *fakeRuntime) CreateNetwork(ctx context.Context, opts *NetworkOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("CreateNetwork", opts.Name, opts.Driver); err != nil {
+		return err
+	}
+	f.networks[opts.Name] = opts
+	return nil
+}
+
+func (f *fakeRuntime) InspectContainer(ctx context.Context, containerName string) (*ContainerInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failures["InspectContainer"]; err != nil {
+		return nil, err
+	}
+	c, ok := f.containers[containerName]
+	if !ok {
+		return nil, NewError(ErrContainerNotFound, containerName, "no such container: %s", containerName)
+	}
+	status := "exited"
+	if c.paused {
+		status = "paused"
+	} else if c.running {
+		status = "running"
+	}
+	info := &ContainerInfo{ID: containerName, Name: containerName, Image: c.image, Status: status,
+		Running: c.running, Paused: c.paused, ExitCode: c.exitCode, IPAddress: "10.0.0.2",
+		Labels: c.labels, Args: c.args, Mounts: c.mounts, Bindings: c.ports}
+	if c.running {
+		info.Ports = c.ports
+	}
+	return info, nil
+}
+
+func (f *fakeRuntime) Stats(ctx context.Context, containerName string) (*ContainerStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Stats", containerName); err != nil {
+		return nil, err
+	}
+	c, ok := f.containers[containerName]
+	if !ok {
+		return nil, NewError(ErrContainerNotFound, containerName, "no such container: %s", containerName)
+	}
+	if c.stats == nil {
+		return &ContainerStats{Name: containerName, Running: c.running}, nil
+	}
+	stats := *c.stats
+	stats.Name = containerName
+	return &stats, nil
+}
+
+func (f *fakeRuntime) ListContainers(ctx context.Context) ([]*ContainerInfo, error) {
+	f.mu.Lock()
+	names := make([]string, 0, len(f.containers))
+	for name := range f.containers {
+		names = append(names, name)
+	}
+	f.mu.Unlock()
+	sort.Strings(names)
+	var infos []*ContainerInfo
+	for _, name := range names {
+		info, err := f.InspectContainer(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (f *fakeRuntime) Exists(ctx context.Context, containerName string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.containers[containerName]
+	return ok
+}
+
+func (f *fakeRuntime) IsRunning(ctx context.Context, containerName string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.containers[containerName]
+	return ok && c.running
+}
+
+func (f *fakeRuntime) PruneImages(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return "", f.record("PruneImages")
+}
+
+func (f *fakeRuntime) IsAuthenticated(ctx context.Context) (bool, string, error) {
+	return false, "", nil
+}
+
+func (f *fakeRuntime) Events(ctx context.Context, containers []string) (<-chan Event, <-chan error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Events", containers...)
+	errs := make(chan error, 1)
+	if f.eventsErr != nil {
+		errs <- f.eventsErr
+	}
+	close(errs)
+	if f.events == nil {
+		events := make(chan Event)
+		close(events)
+		return events, errs
+	}
+	return f.events, errs
+}
+
+// memStore is an in-memory config.Store
+type memStore struct {
+	cfg   *config.Config
+	saves int
+}
+
+func newMemStore(containers ...*config.Container) *memStore {
+	cfg := config.GetDefault()
+	for _, c := range containers {
+		cfg.AddContainer(c)
+	}
+	return &memStore{cfg: cfg}
+}
+
+func (s *memStore) Load() (*config.Config, error) {
+	return s.cfg, nil
+}
+
+func (s *memStore) Save(cfg *config.Config) error {
+	s.cfg = cfg
+	s.saves++
+	return nil
+}
+
+// stubHost disables root and kernel module checks for the duration of a test
+func stubHost(t *testing.T) {
+	t.Helper()
+	origRoot, origBinder, origPresent, origGrace, origQuiet, origPoll := requireRoot, prepareBinder, binderPresent, startupGrace, startupQuiet, bootPollInterval
+	origSupported, origSetup, origRemove, origPort := binderfsSupported, setupBinderfs, removeBinderfs, portAvailable
+	origLockDir := lockDir
+	lockDir = t.TempDir()
+	requireRoot = func() error { return nil }
+	prepareBinder = func() error { return nil }
+	binderPresent = func() bool { return true }
+	binderfsSupported = func() bool { return false }
+	setupBinderfs = func(dir string) error { return nil }
+	removeBinderfs = func(dir string) error { return nil }
+	portAvailable = func(port int) bool { return true }
+	startupGrace = 50 * time.Millisecond
+	startupQuiet = 20 * time.Millisecond
+	bootPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() {
+		requireRoot, prepareBinder, binderPresent, startupGrace, startupQuiet, bootPollInterval = origRoot, origBinder, origPresent, origGrace, origQuiet, origPoll
+		binderfsSupported, setupBinderfs, removeBinderfs, portAvailable = origSupported, origSetup, origRemove, origPort
+		lockDir = origLockDir
+	})
+}
+
+func testContainer(t *testing.T, name string) *config.Container {
+	t.Helper()
+	return &config.Container{
+		Name:        name,
+		ImageURL:    "redroid/redroid:13.0.0-latest",
+		DataPath:    t.TempDir(),
+		Port:        5555,
+		GPUMode:     config.DefaultGPUMode,
+		Initialized: true,
+	}
+}
+
+// createdContainer is testContainer as recorded once reddock created it
+func createdContainer(t *testing.T, name string) *config.Container {
+	t.Helper()
+	c := testContainer(t, name)
+	c.RunSpec = NewManagerWith(newMemStore(), newFakeRuntime(), name).buildRunOptions(c).Fingerprint()
+	return c
+}
@@ -0,0 +1,373 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"reddock/pkg/config"
+)
+
+// Actions a fleet plan takes on a container
+const (
+	ActionCreate    = "create"
+	ActionRebuild   = "rebuild"
+	ActionRecreate  = "recreate"
+	ActionUpdate    = "update"
+	ActionRemove    = "remove"
+	ActionUnchanged = "unchanged"
+	// ActionUndeclared keeps a container missing from the spec without prune
+	ActionUndeclared = "undeclared"
+)
+
+var actionSymbols = map[string]string{
+	ActionCreate:     "+",
+	ActionRebuild:    "~",
+	ActionRecreate:   "~",
+	ActionUpdate:     "~",
+	ActionRemove:     "-",
+	ActionUndeclared: "?",
+}
+
+type FleetChange struct {
+	Name   string
+	Action string
+	// Details list the differences, such as "cpus: 2 -> 4"
+	Details []string
+
+	desired *config.Container
+	build   *config.BuildSpec
+	port    int
+}
+
+// FleetPlan lists the changes converging the containers on a fleet spec
+type FleetPlan struct {
+	Changes []FleetChange
+}
+
+func (p *FleetPlan) Pending() int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Action != ActionUnchanged && c.Action != ActionUndeclared {
+			n++
+		}
+	}
+	return n
+}
+
+// Print writes a line per changed container, its details and a summary
+func (p *FleetPlan) Print(w io.Writer) {
+	counts := make(map[string]int)
+	for _, c := range p.Changes {
+		counts[c.Action]++
+		switch c.Action {
+		case ActionUnchanged:
+			continue
+		case ActionUndeclared:
+			fmt.Fprintf(w, "  %s %-20s not in the spec, kept (use --prune to remove it)\n", actionSymbols[c.Action], c.Name)
+			continue
+		}
+		fmt.Fprintf(w, "  %s %-20s %s\n", actionSymbols[c.Action], c.Name, c.Action)
+		for _, detail := range c.Details {
+			fmt.Fprintf(w, "        %s\n", detail)
+		}
+	}
+	if p.Pending() == 0 {
+		fmt.Fprintf(w, "Fleet is up to date, %d containers unchanged\n", counts[ActionUnchanged])
+		return
+	}
+	changed := counts[ActionRebuild] + counts[ActionRecreate] + counts[ActionUpdate]
+	fmt.Fprintf(w, "Plan: %d to create, %d to change, %d to remove, %d unchanged\n",
+		counts[ActionCreate], changed, counts[ActionRemove], counts[ActionUnchanged])
+}
+
+// ImageBuilder builds target as "reddock addons build" does
+type ImageBuilder func(ctx context.Context, build *config.BuildSpec, target string) error
+
+// Fleet converges containers on a fleet spec
+type Fleet struct {
+	store   config.Store
+	runtime Runtime
+	build   ImageBuilder
+	out     io.Writer
+}
+
+func NewFleet(build ImageBuilder) *Fleet {
+	return NewFleetWith(config.NewFileStore(), nil, build, os.Stdout)
+}
+
+func NewFleetWith(store config.Store, runtime Runtime, build ImageBuilder, out io.Writer) *Fleet {
+	return &Fleet{store: store, runtime: runtime, build: build, out: out}
+}
+
+func (f *Fleet) runtimeFor(cfg *config.Config, c *config.Container) Runtime {
+	if f.runtime != nil {
+		return f.runtime
+	}
+	return NewRuntimeForContainer(cfg, c)
+}
+
+// Plan diffs the spec against the config and the live runtime
+func (f *Fleet) Plan(ctx context.Context, spec *config.FleetSpec, prune bool) (*FleetPlan, error) {
+	cfg := config.LoadOrDefault(f.store)
+	plan := &FleetPlan{}
+
+	for _, name := range spec.Names() {
+		desired, err := spec.Desired(name)
+		if err != nil {
+			return nil, fmt.Errorf("Container '%s': %v", name, err)
+		}
+		_, build := spec.Image(name)
+		change := FleetChange{Name: name, desired: desired, build: build, port: spec.Port(name)}
+
+		existing := cfg.GetContainer(name)
+		if existing == nil || !existing.Initialized {
+			change.Action = ActionCreate
+			change.Details = append(change.Details, "image: "+desired.ImageURL)
+			if build != nil {
+				change.Details = append(change.Details, "build: "+build.String())
+			}
+			if change.port != 0 {
+				change.Details = append(change.Details, fmt.Sprintf("port: %d", change.port))
+			}
+			change.Details = append(change.Details, desired.Settings()...)
+			plan.Changes = append(plan.Changes, change)
+			continue
+		}
+
+		runtime := f.runtimeFor(cfg, existing)
+		change.Details = diffContainers(existing, desired, change.port)
+		imageMissing := !runtime.ImageExists(ctx, desired.ImageURL)
+		running := runtime.IsRunning(ctx, name)
+		switch {
+		case build != nil && (imageMissing || existing.Build != desired.Build || existing.ImageURL != desired.ImageURL):
+			change.Action = ActionRebuild
+			if imageMissing {
+				change.Details = append(change.Details, "image "+desired.ImageURL+" is missing")
+			}
+		case len(change.Details) > 0 || imageMissing:
+			if imageMissing {
+				change.Details = append(change.Details, "image "+desired.ImageURL+" is missing, pulling it")
+			}
+			change.Action = ActionUpdate
+			if running {
+				change.Action = ActionRecreate
+			}
+		case running && existing.RunSpec != "" && existing.RunSpec != NewManagerWith(f.store, runtime, name).buildRunOptions(existing).Fingerprint():
+			change.Action = ActionRecreate
+			change.Details = append(change.Details, "the running container predates its settings")
+		default:
+			change.Action = ActionUnchanged
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	var undeclared []string
+	for name := range cfg.Containers {
+		if _, ok := spec.Containers[name]; !ok {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		action := ActionUndeclared
+		if prune {
+			action = ActionRemove
+		}
+		plan.Changes = append(plan.Changes, FleetChange{Name: name, Action: action})
+	}
+	return plan, nil
+}
+
+// diffContainers lists the settings desired changes, a zero port keeps the current one
+func diffContainers(existing, desired *config.Container, port int) []string {
+	var details []string
+	change := func(key, from, to string) {
+		if from == to {
+			return
+		}
+		if from == "" {
+			from = "(unset)"
+		}
+		if to == "" {
+			to = "(unset)"
+		}
+		details = append(details, fmt.Sprintf("%s: %s -> %s", key, from, to))
+	}
+	change("image", existing.ImageURL, desired.ImageURL)
+	change("build", existing.Build, desired.Build)
+	if port != 0 && port != existing.Port {
+		change("port", fmt.Sprint(existing.Port), fmt.Sprint(port))
+	}
+
+	from, keys := groupSettings(existing.Settings(), nil)
+	to, keys := groupSettings(desired.Settings(), keys)
+	for _, key := range keys {
+		change(key, from[key], to[key])
+	}
+	return details
+}
+
+// groupSettings joins the values of each key, appending new keys to keys
+func groupSettings(pairs []string, keys []string) (map[string]string, []string) {
+	grouped := make(map[string]string)
+	for _, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		if _, ok := grouped[key]; ok {
+			grouped[key] += ", " + value
+			continue
+		}
+		grouped[key] = value
+		if !contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return grouped, keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply goes one container at a time since image builds share a work
+// directory, removals first to free their ports
+func (f *Fleet) Apply(ctx context.Context, plan *FleetPlan) error {
+	var ordered []FleetChange
+	for _, c := range plan.Changes {
+		if c.Action == ActionRemove {
+			ordered = append(ordered, c)
+		}
+	}
+	for _, c := range plan.Changes {
+		if c.Action != ActionRemove && c.Action != ActionUnchanged && c.Action != ActionUndeclared {
+			ordered = append(ordered, c)
+		}
+	}
+
+	var results []BulkResult
+	for i, change := range ordered {
+		if err := ctx.Err(); err != nil {
+			results = append(results, BulkResult{Name: change.Name, Err: ContextError(ctx, err)})
+			continue
+		}
+		fmt.Fprintf(f.out, "\n[%d/%d] %s %s\n", i+1, len(ordered), change.Action, change.Name)
+		started := time.Now()
+		err := f.applyChange(ctx, change)
+		results = append(results, BulkResult{Name: change.Name, Err: err, Elapsed: time.Since(started)})
+		if err != nil {
+			fmt.Fprintf(f.out, "✘ %s: %v\n", change.Name, err)
+		}
+	}
+
+	err := NewBulkError("apply", results)
+	if err == nil {
+		fmt.Fprintf(f.out, "\nApplied %d changes\n", len(ordered))
+	}
+	return err
+}
+
+func (f *Fleet) applyChange(ctx context.Context, change FleetChange) error {
+	switch change.Action {
+	case ActionRemove:
+		return NewRemoverWith(f.store, f.runtime, change.Name).WithoutPrompt().Remove(ctx, false)
+	case ActionCreate:
+		return f.create(ctx, change)
+	case ActionRebuild:
+		if err := f.buildImage(ctx, change); err != nil {
+			return err
+		}
+	}
+	return f.update(ctx, change)
+}
+
+func (f *Fleet) buildImage(ctx context.Context, change FleetChange) error {
+	if f.build == nil {
+		return fmt.Errorf("Building images is not supported here")
+	}
+	if err := f.build(ctx, change.build, change.desired.ImageURL); err != nil {
+		return fmt.Errorf("Failed to build %s: %w", change.desired.ImageURL, err)
+	}
+	return nil
+}
+
+func (f *Fleet) create(ctx context.Context, change FleetChange) error {
+	if change.build != nil {
+		if err := f.buildImage(ctx, change); err != nil {
+			return err
+		}
+	}
+	init := NewInitializerWith(f.store, f.runtime, change.Name, change.desired.ImageURL)
+	if err := init.ApplySettings(change.desired.Settings()); err != nil {
+		return err
+	}
+	if err := init.Initialize(ctx); err != nil {
+		return err
+	}
+	return f.configure(change)
+}
+
+// update restarts a running container, which recreates it with the new settings
+func (f *Fleet) update(ctx context.Context, change FleetChange) error {
+	cfg := config.LoadOrDefault(f.store)
+	runtime := f.runtimeFor(cfg, cfg.GetContainer(change.Name))
+	if change.build == nil && !runtime.ImageExists(ctx, change.desired.ImageURL) {
+		pullCtx, cancel := WithTimeout(ctx, cfg, config.OpPull)
+		err := runtime.PullImage(pullCtx, change.desired.ImageURL)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("Failed to pull image: %w", ContextError(pullCtx, err))
+		}
+	}
+	if err := f.configure(change); err != nil {
+		return err
+	}
+	if runtime.IsRunning(ctx, change.Name) {
+		return NewManagerWith(f.store, runtime, change.Name).Restart(ctx, false)
+	}
+	return nil
+}
+
+func (f *Fleet) configure(change FleetChange) error {
+	lock, err := lockContainer(change.Name, "apply")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	cfg := config.LoadOrDefault(f.store)
+	c := cfg.GetContainer(change.Name)
+	if c == nil {
+		return notFoundError(change.Name)
+	}
+	if change.port != 0 && change.port != c.Port {
+		if owner := portOwner(cfg, c.Host, change.port, c.Name); owner != "" {
+			return NewError(ErrPortInUse, c.Name, "Port %d is assigned to '%s'", change.port, owner)
+		}
+		c.Port = change.port
+	}
+
+	// Clear every current setting, then set the declared ones
+	var pairs []string
+	for _, pair := range c.Settings() {
+		key, _, _ := strings.Cut(pair, "=")
+		pairs = append(pairs, key+"=")
+	}
+	if err := c.ApplySettings(append(pairs, change.desired.Settings()...)); err != nil {
+		return err
+	}
+	c.ImageURL = change.desired.ImageURL
+	c.Build = change.desired.Build
+	if err := f.store.Save(cfg); err != nil {
+		return fmt.Errorf("Failed to save config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"reddock/pkg/config"
+)
+
+const testFleet = `
+defaults:
+  image: redroid/redroid:13.0.0-latest
+  resources:
+    memory: 4g
+containers:
+  farm-1:
+    resources:
+      cpus: 4
+    labels:
+      tier: lab
+  farm-2: {}
+  farm-3:
+    port: 5610
+    display:
+      width: 720
+      height: 1280
+`
+
+func parseTestFleet(t *testing.T, data string) *config.FleetSpec {
+	t.Helper()
+	spec, err := config.ParseFleetSpec([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseFleetSpec: %v", err)
+	}
+	return spec
+}
+
+// fleetContainers returns farm-1 running with outdated settings, farm-2 as
+// declared, and an undeclared container
+func fleetContainers(t *testing.T, rt *fakeRuntime) *memStore {
+	t.Helper()
+	farm1 := testContainer(t, "farm-1")
+	farm1.ApplySettings([]string{"cpus=2", "memory=4g"})
+	farm1.RunSpec = NewManagerWith(newMemStore(), rt, "farm-1").buildRunOptions(farm1).Fingerprint()
+	farm2 := testContainer(t, "farm-2")
+	farm2.Port = 5556
+	farm2.ApplySettings([]string{"memory=4g"})
+	rt.images["redroid/redroid:13.0.0-latest"] = true
+	rt.containers["farm-1"] = &fakeContainer{running: true}
+	return newMemStore(farm1, farm2, testContainer(t, "legacy"))
+}
+
+func planActions(plan *FleetPlan) map[string]FleetChange {
+	changes := make(map[string]FleetChange)
+	for _, c := range plan.Changes {
+		changes[c.Name] = c
+	}
+	return changes
+}
+
+func TestFleetPlan(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	fleet := NewFleetWith(fleetContainers(t, rt), rt, nil, &bytes.Buffer{})
+
+	plan, err := fleet.Plan(context.Background(), parseTestFleet(t, testFleet), false)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	changes := planActions(plan)
+	want := map[string]string{
+		"farm-1": ActionRecreate,
+		"farm-2": ActionUnchanged,
+		"farm-3": ActionCreate,
+		"legacy": ActionUndeclared,
+	}
+	for name, action := range want {
+		if changes[name].Action != action {
+			t.Errorf("%s: action %q, want %q", name, changes[name].Action, action)
+		}
+	}
+	details := strings.Join(changes["farm-1"].Details, "\n")
+	if !strings.Contains(details, "cpus: 2 -> 4") || !strings.Contains(details, "label: (unset) -> tier=lab") {
+		t.Errorf("farm-1 details:\n%s", details)
+	}
+	if plan.Pending() != 2 {
+		t.Errorf("pending = %d, want 2", plan.Pending())
+	}
+
+	plan, _ = fleet.Plan(context.Background(), parseTestFleet(t, testFleet), true)
+	if planActions(plan)["legacy"].Action != ActionRemove {
+		t.Error("--prune should remove undeclared containers")
+	}
+}
+
+func TestFleetApply(t *testing.T) {
+	stubHost(t)
+	t.Setenv("HOME", t.TempDir())
+	rt := newFakeRuntime()
+	store := fleetContainers(t, rt)
+	fleet := NewFleetWith(store, rt, nil, &bytes.Buffer{})
+	spec := parseTestFleet(t, testFleet)
+
+	plan, err := fleet.Plan(context.Background(), spec, true)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if err := fleet.Apply(context.Background(), plan); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	farm1 := store.cfg.GetContainer("farm-1")
+	if farm1.CPUs != "4" || farm1.Labels["tier"] != "lab" || !rt.called("Run farm-1") {
+		t.Errorf("farm-1 not updated and recreated: %+v, calls = %v", farm1, rt.calls)
+	}
+	farm3 := store.cfg.GetContainer("farm-3")
+	if farm3 == nil || !farm3.Initialized || farm3.Port != 5610 || farm3.Width != 720 || farm3.Memory != "4g" {
+		t.Errorf("farm-3 not created as declared: %+v", farm3)
+	}
+	if store.cfg.GetContainer("legacy") != nil {
+		t.Error("legacy not pruned")
+	}
+
+	plan, _ = fleet.Plan(context.Background(), spec, true)
+	if plan.Pending() != 0 {
+		var out bytes.Buffer
+		plan.Print(&out)
+		t.Fatalf("fleet not converged:\n%s", out.String())
+	}
+}
+
+func TestFleetRebuildsChangedBuild(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	c := testContainer(t, "gapps")
+	c.ImageURL = "farm/gapps:13"
+	c.Build = "13.0.0:litegapps"
+	rt.images["farm/gapps:13"] = true
+	store := newMemStore(c)
+
+	var built []string
+	build := func(ctx context.Context, spec *config.BuildSpec, target string) error {
+		built = append(built, spec.BaseImage()+" "+strings.Join(spec.Addons, ",")+" -> "+target)
+		return nil
+	}
+	fleet := NewFleetWith(store, rt, build, &bytes.Buffer{})
+	spec := parseTestFleet(t, `
+containers:
+  gapps:
+    image: farm/gapps:13
+    build:
+      android: 13.0.0
+      addons: [litegapps, ndk]
+`)
+	plan, err := fleet.Plan(context.Background(), spec, false)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if got := planActions(plan)["gapps"].Action; got != ActionRebuild {
+		t.Fatalf("action = %q, want rebuild", got)
+	}
+	if err := fleet.Apply(context.Background(), plan); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(built) != 1 || built[0] != "redroid/redroid:13.0.0-latest litegapps,ndk -> farm/gapps:13" {
+		t.Fatalf("builds = %v", built)
+	}
+	if store.cfg.GetContainer("gapps").Build != "13.0.0:litegapps,ndk" {
+		t.Fatal("build not recorded")
+	}
+}
+
+func TestParseFleetSpecRejects(t *testing.T) {
+	for _, data := range []string{
+		"containers:\n  a:\n    image: redroid/redroid:13.0.0-latest\n    cpu: 2\n",
+		"containers:\n  a:\n    image: redroid/redroid:13.0.0-latest\n    resources: {memory: lots}\n",
+		"containers:\n  a: {}\n",
+		"containers:\n  bad/name:\n    image: redroid/redroid:13.0.0-latest\n",
+		"containers:\n  a:\n    image: x/y\n    build: {android: 13.0.0}\n",
+		"defaults:\n  port: 5600\ncontainers:\n  a:\n    image: redroid/redroid:13.0.0-latest\n",
+		"containers: {}\n",
+	} {
+		if _, err := config.ParseFleetSpec([]byte(data)); err == nil {
+			t.Errorf("spec accepted:\n%s", data)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package container
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,56 +13,93 @@ import (
 )
 
 type Initializer struct {
+	store     config.Store
 	config    *config.Config
 	container *config.Container
 	runtime   Runtime
+	settings  []string
 }
 
 func NewInitializer(containerName, image string) *Initializer {
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Printf("Warning: Failed to load config: %v\n", err)
-		cfg = config.GetDefault()
-	}
+	return NewInitializerWith(config.NewFileStore(), nil, containerName, image)
+}
+
+func NewInitializerWith(store config.Store, runtime Runtime, containerName, image string) *Initializer {
+	cfg := config.LoadOrDefault(store)
 
 	container := cfg.GetContainer(containerName)
+	if runtime == nil {
+		runtime = NewRuntimeForContainer(cfg, container)
+	}
 	if container == nil {
-		port := 5555
-		for _, c := range cfg.Containers {
-			if c.Port >= port {
-				port = c.Port + 1
-			}
-		}
-
 		container = &config.Container{
 			Name:        containerName,
 			ImageURL:    image,
 			DataPath:    config.GetDefaultDataPath(containerName),
 			LogFile:     containerName + ".log",
 			GPUMode:     config.DefaultGPUMode,
-			Port:        port,
+			Runtime:     runtime.Name(),
+			Host:        ResolveHost(cfg),
 			Initialized: false,
 		}
-		cfg.AddContainer(container)
-		config.Save(cfg)
 	} else {
 		container.ImageURL = image
-		config.Save(cfg)
 	}
 
 	return &Initializer{
+		store:     store,
 		config:    cfg,
 		container: container,
-		runtime:   NewRuntime(),
+		runtime:   runtime,
+	}
+}
+
+func (i *Initializer) ApplySettings(pairs []string) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	if err := i.container.ApplySettings(pairs); err != nil {
+		return err
+	}
+	i.settings = append(i.settings, pairs...)
+	return nil
+}
+
+// register records the container in a freshly loaded config, under its lock
+func (i *Initializer) register() error {
+	cfg := config.LoadOrDefault(i.store)
+	if existing := cfg.GetContainer(i.container.Name); existing != nil {
+		existing.ImageURL = i.container.ImageURL
+		if err := existing.ApplySettings(i.settings); err != nil {
+			return err
+		}
+		i.container = existing
+	} else {
+		port, err := AllocatePort(cfg, i.container.Host)
+		if err != nil {
+			return err
+		}
+		i.container.Port = port
+		cfg.AddContainer(i.container)
 	}
+	i.config = cfg
+	if err := i.store.Save(cfg); err != nil {
+		return fmt.Errorf("Failed to save the config: %v", err)
+	}
+	return nil
 }
 
-func (i *Initializer) Initialize() error {
+func (i *Initializer) Initialize(ctx context.Context) error {
+	// The name ends up in the lock, binderfs and data paths
+	if err := config.ValidateContainerName(i.container.Name); err != nil {
+		return err
+	}
+
 	fmt.Println("Initiating the Reddock container...")
 	fmt.Printf("Container: %s\n", i.container.Name)
 	fmt.Printf("Image: %s\n\n", i.container.ImageURL)
 
-	if err := CheckRoot(); err != nil {
+	if err := requireRoot(); err != nil {
 		return err
 	}
 
@@ -68,31 +107,50 @@ func (i *Initializer) Initialize() error {
 		return fmt.Errorf("Invalid image name: %v", err)
 	}
 
+	lock, err := lockContainer(i.container.Name, "init")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err := i.register(); err != nil {
+		return err
+	}
+
 	s1 := ui.NewSpinner("Checking system requirements...")
 	s1.Start()
 
-	if err := i.checkRuntime(); err != nil {
-		return fmt.Errorf("Runtime check failed: %v", err)
+	if err := i.checkRuntime(ctx); err != nil {
+		s1.Finish("System requirements not met")
+		return fmt.Errorf("Runtime check failed: %w", err)
 	}
 
-	if err := i.checkKernelModules(); err != nil {
-		return fmt.Errorf("Kernel module check failed: %v", err)
+	// binder only matters on the host that runs the container
+	if !i.container.IsRemote() {
+		if err := i.checkKernelModules(); err != nil {
+			// Missing binder only matters once the container starts
+			if !errors.Is(err, ErrBinderMissing) {
+				return fmt.Errorf("Kernel module check failed: %w", err)
+			}
+			fmt.Println()
+			fmt.Printf("Warning: %v\n", err)
+			fmt.Println("You need to prepare the binder/binderfs first before using it.")
+		}
 	}
 	s1.Finish("System requirements met")
 
 	if strings.HasPrefix(i.container.ImageURL, "redroid/redroid:") {
 		fmt.Printf("Pulling official Redroid image %s...\n", i.container.ImageURL)
-		if err := i.pullImage(); err != nil {
-			return fmt.Errorf("Failed to pull image: %v", err)
+		if err := i.pullImage(ctx); err != nil {
+			return fmt.Errorf("Failed to pull image: %w", err)
 		}
 		fmt.Println("Image pulled successfully")
 	} else {
 		s2 := ui.NewSpinner("Verifying custom image availability...")
 		s2.Start()
 
-		if err := i.verifyImageExists(); err != nil {
+		if err := i.verifyImageExists(ctx); err != nil {
 			s2.Finish("Image verification failed")
-			return fmt.Errorf("Image '%s' not found locally. Please build or pull it first.\n"+
+			return NewError(ErrImageMissing, i.container.Name, "Image '%s' not found locally. Please build or pull it first.\n"+
 				"For custom images built with 'reddock addons build', the image should already exist.\n"+
 				"Error: %v", i.container.ImageURL, err)
 		}
@@ -102,14 +160,19 @@ func (i *Initializer) Initialize() error {
 	s3 := ui.NewSpinner("Setting up container environment...")
 	s3.Start()
 
-	if err := i.createDataDirectory(); err != nil {
+	if i.container.IsRemote() {
+		fmt.Printf("\nNote: %s is created by the engine on %s\n", i.container.GetDataPath(), i.container.Host)
+	} else if err := i.createDataDirectory(); err != nil {
+		s3.Finish("Environment setup failed")
 		return fmt.Errorf("Failed to create data directory: %v", err)
 	}
 	s3.Finish("Environment setup complete")
 
+	// Reload, other containers may have changed while this one was set up
+	i.config = config.LoadOrDefault(i.store)
 	i.container.Initialized = true
 	i.config.AddContainer(i.container)
-	if err := config.Save(i.config); err != nil {
+	if err := i.store.Save(i.config); err != nil {
 		return fmt.Errorf("Failed to save the config: %v", err)
 	}
 
@@ -122,15 +185,44 @@ func (i *Initializer) Initialize() error {
 	return nil
 }
 
-func (i *Initializer) checkRuntime() error {
-	if !i.runtime.IsInstalled() {
-		return fmt.Errorf("%s is not found. Please install Docker or Podman", i.runtime.Name())
+func (i *Initializer) checkRuntime(ctx context.Context) error {
+	if !i.runtime.IsInstalled(ctx) {
+		return NewError(ErrRuntimeUnavailable, i.container.Name,
+			"%s is not found. Please install Docker or Podman", i.runtime.Name())
 	}
 	return nil
 }
 
 func (i *Initializer) checkKernelModules() error {
-	binderFound := false
+	// A container with its own binderfs needs no global binder devices
+	if i.container.BinderMode() == config.BinderBinderfs {
+		return setupBinderfs(BinderfsPath(i.container.Name))
+	}
+	if i.container.BinderMode() == config.BinderAuto && binderfsDir(i.container) != "" {
+		return nil
+	}
+	return prepareBinder()
+}
+
+var prepareBinder = func() error {
+	// A regular user cannot load modules
+	if os.Getuid() != 0 {
+		return checkBinderDevices("/dev")
+	}
+
+	if binderPresent() {
+		return nil
+	}
+
+	cmd := exec.Command("modprobe", "binder_linux", "devices=binder,hwbinder,vndbinder")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return NewError(ErrBinderMissing, "", "modprobe binder_linux failed").
+			Wrap(fmt.Errorf("%v %s", err, strings.TrimSpace(string(output))))
+	}
+	return nil
+}
+
+var binderPresent = func() bool {
 	binderPaths := []string{
 		"/sys/module/binder_linux",
 		"/sys/module/binder",
@@ -140,31 +232,20 @@ func (i *Initializer) checkKernelModules() error {
 
 	for _, path := range binderPaths {
 		if _, err := os.Stat(path); err == nil {
-			binderFound = true
-			break
-		}
-	}
-
-	if binderFound {
-	} else {
-		cmd := exec.Command("modprobe", "binder_linux", "devices=binder,hwbinder,vndbinder")
-		if err := cmd.Run(); err != nil {
-			fmt.Println()
-			fmt.Printf("Warning: modprobe binder_linux failed: %v\n", err)
-			fmt.Println("You need to prepare the binder/binderfs first before using it.")
+			return true
 		}
 	}
-
-	return nil
+	return false
 }
 
-func (i *Initializer) pullImage() error {
-	return i.runtime.PullImage(i.container.ImageURL)
+func (i *Initializer) pullImage(ctx context.Context) error {
+	ctx, cancel := WithTimeout(ctx, i.config, config.OpPull)
+	defer cancel()
+	return i.runtime.PullImage(ctx, i.container.ImageURL)
 }
 
-func (i *Initializer) verifyImageExists() error {
-	cmd := i.runtime.Command("image", "inspect", i.container.ImageURL)
-	if err := cmd.Run(); err != nil {
+func (i *Initializer) verifyImageExists(ctx context.Context) error {
+	if !i.runtime.ImageExists(ctx, i.container.ImageURL) {
 		return fmt.Errorf("Image does not exist locally")
 	}
 	return nil
@@ -178,38 +259,87 @@ func (i *Initializer) createDataDirectory() error {
 }
 
 type Lister struct {
-	config *config.Config
+	config  *config.Config
+	runtime Runtime
 }
 
 func NewLister() *Lister {
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Printf("Warning: Failed to load config: %v\n", err)
-		cfg = config.GetDefault()
-	}
-	return &Lister{config: cfg}
+	return NewListerWith(config.NewFileStore(), nil)
 }
 
-func (l *Lister) ListReddockContainers() error {
+func NewListerWith(store config.Store, runtime Runtime) *Lister {
+	return &Lister{config: config.LoadOrDefault(store), runtime: runtime}
+}
+
+func (l *Lister) ListReddockContainers(ctx context.Context) error {
 	containers := l.config.ListContainers()
 	if len(containers) == 0 {
 		fmt.Println("No Reddock containers found.")
+		l.printUntracked(ctx)
 		return nil
 	}
 
-	fmt.Printf("%-20s %-40s %-10s\n", "NAME", "IMAGE", "STATUS")
-	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("%-20s %-40s %-10s %-22s %s\n", "NAME", "IMAGE", "STATUS", "ADB", "HOST")
+	fmt.Println(strings.Repeat("-", 110))
 
-	runtime := NewRuntime()
+	// One runtime per backend and host, and one failed query marks that
+	// backend unreachable instead of timing out for every container
+	runtimes := make(map[string]Runtime)
+	unreachable := make(map[string]bool)
 	for _, c := range containers {
-		status := "Initiated"
-		if s, err := runtime.Inspect(c.Name, "{{.State.Status}}"); err == nil {
-			status = s
-		} else {
-			status = "Stopped"
+		key := c.Runtime + "|" + c.Host
+		runtime, ok := runtimes[key]
+		if l.runtime != nil {
+			runtime, ok = l.runtime, true
+		}
+		if !ok {
+			runtime = NewRuntimeForContainer(l.config, c)
+			runtimes[key] = runtime
+		}
+
+		status := "Unreachable"
+		address := ADBAddress(c)
+		if !unreachable[key] {
+			info, err := runtime.InspectContainer(ctx, c.Name)
+			switch {
+			case err == nil:
+				status = info.Status
+				if info.Running {
+					address = mappedADBAddress(c, info)
+				}
+			case errors.Is(err, ErrRuntimeUnavailable):
+				unreachable[key] = true
+			case errors.Is(err, ErrContainerNotFound) && c.RunSpec != "" && !c.Stopped:
+				// Removed behind reddock's back, see sync
+				status = "Missing"
+			default:
+				status = "Stopped"
+			}
 		}
-		fmt.Printf("%-20s %-40s %-10s\n", c.Name, c.ImageURL, status)
+		fmt.Printf("%-20s %-40s %-10s %-22s %s\n", c.Name, c.ImageURL, status, address, hostLabel(c.Host))
 	}
 
+	l.printUntracked(ctx)
 	return nil
 }
+
+// printUntracked points out containers reddock created that the config lacks
+func (l *Lister) printUntracked(ctx context.Context) {
+	runtime := l.runtime
+	if runtime == nil {
+		runtime = NewRuntimeFromConfig(l.config)
+	}
+	infos, err := runtime.ListContainers(ctx)
+	if err != nil {
+		return
+	}
+	var untracked []string
+	for _, info := range infos {
+		if info.Managed() && l.config.GetContainer(info.Name) == nil {
+			untracked = append(untracked, info.Name)
+		}
+	}
+	if len(untracked) > 0 {
+		fmt.Printf("\nNot in the config: %s, adopt them with 'reddock sync'\n", strings.Join(untracked, ", "))
+	}
+}
@@ -0,0 +1,130 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitializeOfficialImage(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	store := newMemStore()
+	dataPath := filepath.Join(t.TempDir(), "data-android")
+
+	init := NewInitializerWith(store, rt, "android", "redroid/redroid:13.0.0-latest")
+	init.container.DataPath = dataPath
+	if err := init.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	if !rt.called("PullImage redroid/redroid:13.0.0-latest") {
+		t.Fatalf("expected official image to be pulled, calls: %v", rt.calls)
+	}
+	c := store.cfg.GetContainer("android")
+	if c == nil || !c.Initialized {
+		t.Fatalf("container should be saved as initialized: %+v", c)
+	}
+	if c.Port != 5555 || c.Runtime != "fake" {
+		t.Errorf("unexpected defaults: port=%d runtime=%q", c.Port, c.Runtime)
+	}
+	if _, err := os.Stat(dataPath); err != nil {
+		t.Errorf("data directory not created: %v", err)
+	}
+}
+
+func TestInitializeAllocatesFreePort(t *testing.T) {
+	stubHost(t)
+	portAvailable = func(port int) bool { return port != 5556 }
+	local := testContainer(t, "local")
+	remote := testContainer(t, "remote")
+	remote.Host = "tcp://10.0.0.5:2375"
+	remote.Port = 5557
+	store := newMemStore(local, remote)
+
+	// 5555 belongs to a container, something else listens on 5556 and
+	// 5557 is only used on another host
+	init := NewInitializerWith(store, newFakeRuntime(), "second", "redroid/redroid:12.0.0-latest")
+	init.container.DataPath = t.TempDir()
+	if err := init.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if port := store.cfg.GetContainer("second").Port; port != 5557 {
+		t.Fatalf("port = %d, want 5557", port)
+	}
+}
+
+func TestInitializeFailsWithoutFreePort(t *testing.T) {
+	stubHost(t)
+	store := newMemStore(testContainer(t, "first"))
+	store.cfg.ADBPorts = "5555"
+
+	init := NewInitializerWith(store, newFakeRuntime(), "second", "redroid/redroid:12.0.0-latest")
+	if err := init.Initialize(context.Background()); err == nil || !strings.Contains(err.Error(), "No free ADB port in 5555-5555") {
+		t.Fatalf("Initialize error = %v, want no free port", err)
+	}
+}
+
+func TestInitializeCustomImage(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	store := newMemStore()
+
+	init := NewInitializerWith(store, rt, "custom", "reddock-custom:custom-13.0.0")
+	init.container.DataPath = t.TempDir()
+	if err := init.Initialize(context.Background()); err == nil {
+		t.Fatal("expected error for missing custom image")
+	}
+	if store.cfg.GetContainer("custom").Initialized {
+		t.Fatal("container must not be marked initialized")
+	}
+
+	rt.images["reddock-custom:custom-13.0.0"] = true
+	if err := init.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize with local image: %v", err)
+	}
+	if rt.called("PullImage") {
+		t.Fatal("custom images must not be pulled")
+	}
+}
+
+func TestInitializeRejectsInvalidImage(t *testing.T) {
+	stubHost(t)
+	init := NewInitializerWith(newMemStore(), newFakeRuntime(), "bad", "Redroid/UPPER")
+	if err := init.Initialize(context.Background()); err == nil {
+		t.Fatal("expected invalid image name error")
+	}
+}
+
+func TestInitializeRejectsInvalidName(t *testing.T) {
+	stubHost(t)
+	store := newMemStore()
+	init := NewInitializerWith(store, newFakeRuntime(), "../escape", "redroid/redroid:13.0.0-latest")
+	if err := init.Initialize(context.Background()); err == nil {
+		t.Fatal("expected invalid container name error")
+	}
+	if store.saves != 0 {
+		t.Error("an invalid name must not be saved")
+	}
+}
+
+func TestInitializeWaitsForContainerLock(t *testing.T) {
+	stubHost(t)
+	store := newMemStore(testContainer(t, "android"))
+	lock, err := lockContainer("android", "start")
+	if err != nil {
+		t.Fatalf("lockContainer: %v", err)
+	}
+	defer lock.Unlock()
+
+	init := NewInitializerWith(store, newFakeRuntime(), "android", "redroid/redroid:12.0.0-latest")
+	if err := init.Initialize(context.Background()); !errors.Is(err, ErrBusy) {
+		t.Fatalf("Initialize of a busy container = %v, want ErrBusy", err)
+	}
+	if store.saves != 0 {
+		t.Error("the config of a busy container must not be saved")
+	}
+}
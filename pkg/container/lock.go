@@ -0,0 +1,60 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lockDir holds a lock file per container
+var lockDir = defaultLockDir()
+
+func defaultLockDir() string {
+	if os.Getuid() == 0 {
+		return "/run/reddock/locks"
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "reddock", "locks")
+	}
+	return filepath.Join(os.TempDir(), "reddock-"+strconv.Itoa(os.Getuid()), "locks")
+}
+
+type containerLock struct {
+	file *os.File
+}
+
+// lockContainer fails with ErrBusy while another operation holds the lock
+func lockContainer(name, op string) (*containerLock, error) {
+	if err := os.MkdirAll(lockDir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create the lock directory: %v", err)
+	}
+	path := filepath.Join(lockDir, name+".lock")
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open the lock of '%s': %v", name, err)
+	}
+	if err := tryLock(file); err != nil {
+		file.Close()
+		holder := "another operation"
+		if data, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+			holder = strings.TrimSpace(string(data))
+		}
+		return nil, NewError(ErrBusy, name, "Container '%s' is busy: %s in progress, try again once it has finished", name, holder)
+	}
+	// The file is never removed, that would race with the next locker
+	file.Truncate(0)
+	file.WriteAt([]byte(fmt.Sprintf("%s (pid %d)\n", op, os.Getpid())), 0)
+	return &containerLock{file: file}, nil
+}
+
+func (l *containerLock) Unlock() {
+	if l == nil || l.file == nil {
+		return
+	}
+	l.file.Truncate(0)
+	unlock(l.file)
+	l.file.Close()
+	l.file = nil
+}
@@ -0,0 +1,16 @@
+//go:build linux
+
+package container
+
+import (
+	"os"
+	"syscall"
+)
+
+func tryLock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func unlock(file *os.File) {
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
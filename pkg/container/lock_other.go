@@ -0,0 +1,12 @@
+//go:build !linux
+
+package container
+
+import "os"
+
+// Other platforms cannot run redroid, so operations are not serialized
+func tryLock(file *os.File) error {
+	return nil
+}
+
+func unlock(file *os.File) {}
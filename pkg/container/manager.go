@@ -1,10 +1,12 @@
 package container
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
+	"time"
 
 	"reddock/pkg/config"
 	"reddock/pkg/ui"
@@ -12,152 +14,522 @@ import (
 
 type Manager struct {
 	runtime       Runtime
+	store         config.Store
 	config        *config.Config
 	containerName string
 }
 
 func NewManagerForContainer(containerName string) *Manager {
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Printf("Warning: Failed to load config: %v\n", err)
-		cfg = config.GetDefault()
+	return NewManagerWith(config.NewFileStore(), nil, containerName)
+}
+
+func NewManagerWith(store config.Store, runtime Runtime, containerName string) *Manager {
+	cfg := config.LoadOrDefault(store)
+	if runtime == nil {
+		runtime = NewRuntimeForContainer(cfg, cfg.GetContainer(containerName))
 	}
 	return &Manager{
-		runtime:       NewRuntime(),
+		runtime:       runtime,
+		store:         store,
 		config:        cfg,
 		containerName: containerName,
 	}
 }
 
-func (m *Manager) Start(verbose bool) error {
-	if err := CheckRoot(); err != nil {
+// lock takes the container lock for op and reloads the config under it
+func (m *Manager) lock(op string) (*containerLock, error) {
+	lock, err := lockContainer(m.containerName, op)
+	if err != nil {
+		return nil, err
+	}
+	m.config = config.LoadOrDefault(m.store)
+	return lock, nil
+}
+
+func (m *Manager) Start(ctx context.Context, verbose bool) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	lock, err := m.lock("start")
+	if err != nil {
 		return err
 	}
+	err = m.start(ctx)
+	lock.Unlock()
+	if err != nil || !verbose {
+		return err
+	}
+	return m.FollowLogs(ctx)
+}
+
+func (m *Manager) start(ctx context.Context) error {
 
 	container := m.config.GetContainer(m.containerName)
 	if container == nil {
-		return fmt.Errorf("Container '%s' not found. Run 'reddock init %s' first", m.containerName, m.containerName)
+		return notFoundError(m.containerName)
 	}
 
 	if !container.Initialized {
-		return fmt.Errorf("Container '%s' is not initialized. Run 'reddock init %s' first", m.containerName, m.containerName)
+		return NewError(ErrNotInitialized, m.containerName,
+			"Container '%s' is not initialized. Run 'reddock init %s' first", m.containerName, m.containerName)
 	}
 
-	if m.runtime.IsRunning(m.containerName) {
+	opts := m.buildRunOptions(container)
+	spec := opts.Fingerprint()
+	// Without a fingerprint the settings the container was created with are
+	// unknown, e.g. for adopted containers or ones left by a failed run
+	stale := container.RunSpec != spec
+
+	if info, err := m.runtime.InspectContainer(ctx, m.containerName); err == nil && info.Paused {
+		fmt.Printf("Container '%s' is paused. Resume it with 'reddock resume %s'\n", m.containerName, m.containerName)
+		return nil
+	}
+	if m.runtime.IsRunning(ctx, m.containerName) {
 		fmt.Printf("Container '%s' is already running\n", m.containerName)
+		if stale && container.RunSpec != "" {
+			fmt.Printf("Its settings changed since it was created, run 'reddock restart %s' to apply them\n", m.containerName)
+		}
 		return nil
 	}
 
+	// A container created with other settings is replaced, /data is kept
+	if stale && m.runtime.Exists(ctx, m.containerName) {
+		if container.RunSpec != "" {
+			fmt.Printf("Settings of '%s' changed, recreating the container\n", m.containerName)
+		} else {
+			fmt.Printf("Recreating '%s' with the current settings\n", m.containerName)
+		}
+		removeCtx, cancel := WithTimeout(ctx, m.config, config.OpRemove)
+		err := m.runtime.Remove(removeCtx, m.containerName, true)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("Failed to remove the outdated container: %w", err)
+		}
+	}
+
+	if err := checkPortConflict(m.config, container); err != nil {
+		return err
+	}
+	netCtx, cancelNet := WithTimeout(ctx, m.config, config.OpStart)
+	if err := ensureNetwork(netCtx, m.runtime, container); err != nil {
+		cancelNet()
+		return err
+	}
+	cancelNet()
+
+	// The binderfs mount does not survive a reboot, so set it up every time
+	if dir := binderfsDir(container); dir != "" {
+		if err := setupBinderfs(dir); err != nil {
+			return fmt.Errorf("Failed to prepare the binder devices of '%s': %w", m.containerName, err)
+		}
+	} else if isRootlessPodman(m.runtime) && !container.IsRemote() {
+		if err := checkBinderDevices("/dev"); err != nil {
+			return fmt.Errorf("Cannot start '%s' with rootless podman: %w", m.containerName, err)
+		}
+	}
+
 	spinner := ui.NewSpinner(fmt.Sprintf("Starting container '%s'...", m.containerName))
 	spinner.Start()
 
+	// Subscribe before starting so an immediate exit is not missed
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	events, errs := m.runtime.Events(watchCtx, []string{m.containerName})
+
+	startCtx, cancel := WithTimeout(ctx, m.config, config.OpStart)
+	defer cancel()
+
 	var err error
-	if m.runtime.Exists(m.containerName) {
-		err = m.runtime.StartExisting(m.containerName)
+	if m.runtime.Exists(startCtx, m.containerName) {
+		err = m.runtime.StartExisting(startCtx, m.containerName)
 		if err != nil {
 			spinner.Finish(fmt.Sprintf("Failed to start container '%s'", m.containerName))
-			return fmt.Errorf("Failed to start existing container: %v", err)
+			return m.startError("Failed to start existing container", err)
 		}
 	} else {
-		args := m.buildRunArgs(container)
-		cmd := m.runtime.Command(args...)
-		output, runErr := cmd.CombinedOutput()
-		if runErr != nil {
+		if err = m.runtime.Run(startCtx, opts); err != nil {
 			spinner.Finish(fmt.Sprintf("Failed to start container '%s'", m.containerName))
-			return fmt.Errorf("Failed to start container: %s\n%s", runErr, string(output))
+			if startCtx.Err() != nil {
+				m.discardPartial()
+			}
+			return m.startError("Failed to start container", err)
+		}
+	}
+
+	// Only a just created container gets here with another fingerprint
+	if container.RunSpec != spec || container.Stopped {
+		container.RunSpec = spec
+		container.Stopped = false
+		if err := m.store.Save(m.config); err != nil {
+			fmt.Printf("\nWarning: Failed to save the config: %v\n", err)
 		}
 	}
 
+	if err := m.watchStartup(ctx, events, errs); err != nil {
+		spinner.Finish(fmt.Sprintf("Container '%s' failed to start", m.containerName))
+		return err
+	}
 	spinner.Finish(fmt.Sprintf("Container '%s' started successfully", m.containerName))
 
 	fmt.Println("\nContainer started!")
-	fmt.Println("ADB Connect: adb connect localhost:5555")
+	fmt.Printf("ADB Connect: adb connect %s\n", m.ConnectAddress(ctx))
+	return nil
+}
 
-	if verbose {
-		fmt.Println("\nShowing container logs (Ctrl+C to detach)...")
-		return m.showLogs()
+// A start counts once the container stayed up startupQuiet after its start
+// event, or startupGrace passed without one
+var (
+	startupGrace = 3 * time.Second
+	startupQuiet = time.Second
+)
+
+// watchStartup fails when the container dies while it starts
+func (m *Manager) watchStartup(ctx context.Context, events <-chan Event, errs <-chan error) error {
+	grace := time.NewTimer(startupGrace)
+	defer grace.Stop()
+	var quiet, poll <-chan time.Time
+	polling := false
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if err := diedError(m.containerName, ev, "starting"); err != nil {
+				return err
+			}
+			if ev.Action == "start" && quiet == nil {
+				quiet = time.After(startupQuiet)
+			}
+		case err, ok := <-errs:
+			errs = nil
+			if ok && err != nil {
+				fmt.Printf("\nWarning: %v, polling the container state instead\n", err)
+			}
+			polling = true
+			ticker := time.NewTicker(startupQuiet / 4)
+			defer ticker.Stop()
+			poll = ticker.C
+			if quiet == nil {
+				quiet = time.After(startupQuiet)
+			}
+		case <-poll:
+			if err := m.checkStarted(ctx); err != nil {
+				return err
+			}
+		case <-quiet:
+			if polling {
+				return m.checkStarted(ctx)
+			}
+			return nil
+		case <-grace.C:
+			if polling {
+				return m.checkStarted(ctx)
+			}
+			return nil
+		case <-ctx.Done():
+			return ContextError(ctx, ctx.Err())
+		}
 	}
+}
 
-	return nil
+func (m *Manager) checkStarted(ctx context.Context) error {
+	if m.runtime.IsRunning(ctx, m.containerName) || ctx.Err() != nil {
+		return nil
+	}
+	return NewError(ErrContainerDied, m.containerName,
+		"Container '%s' stopped while starting. See 'reddock log %s'", m.containerName, m.containerName)
 }
 
-func (m *Manager) buildRunArgs(container *config.Container) []string {
-	args := []string{
-		"run",
-		"-d",
-		"--privileged",
-		"--name", m.containerName,
-		"--hostname", m.containerName,
-		"-v", fmt.Sprintf("%s:/data:z", container.GetDataPath()),
-		"-p", fmt.Sprintf("%d:5555", container.Port),
+// discardPartial uses a fresh context since the one of the run has ended
+func (m *Manager) discardPartial() {
+	ctx, cancel := WithTimeout(context.Background(), m.config, config.OpRemove)
+	defer cancel()
+	if m.runtime.Exists(ctx, m.containerName) && !m.runtime.IsRunning(ctx, m.containerName) {
+		m.runtime.Remove(ctx, m.containerName, true)
 	}
+}
 
-	// Add GPU mode if specified
-	gpuMode := container.GPUMode
-	if gpuMode == "" {
-		gpuMode = "auto"
+// startError blames the host when it has no binder devices
+func (m *Manager) startError(msg string, err error) error {
+	if errors.Is(err, ErrRuntimeUnavailable) || errors.Is(err, ErrImageMissing) ||
+		errors.Is(err, ErrTimeout) || errors.Is(err, ErrCanceled) {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	if c := m.GetContainer(); c != nil && c.IsRemote() {
+		return fmt.Errorf("%s on %s: %w", msg, c.Host, err)
 	}
+	if !binderPresent() {
+		return NewError(ErrBinderMissing, m.containerName,
+			"%s: binder devices are missing, load binder_linux or mount binderfs first", msg).Wrap(err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
 
-	// Image
-	args = append(args, container.ImageURL)
+func (m *Manager) buildRunOptions(container *config.Container) *RunOptions {
+	opts := &RunOptions{
+		Name:       m.containerName,
+		Hostname:   m.containerName,
+		Image:      container.ImageURL,
+		Privileged: true,
+		Volumes: []VolumeMount{
+			{Source: container.GetDataPath(), Target: "/data", Options: "z"},
+		},
+		CPUs:      container.CPUs,
+		Memory:    container.Memory,
+		CPUSet:    container.CPUSet,
+		PidsLimit: container.PidsLimit,
+		Devices:   append([]string{}, container.Devices...),
+		Env:       container.Env,
+		Labels:    map[string]string{LabelManaged: "true", LabelName: m.containerName},
+	}
+	if dir := binderfsDir(container); dir != "" {
+		opts.Devices = append(opts.Devices, binderDeviceMappings(dir)...)
+	}
+	// Host and macvlan containers are reached without published ports
+	if container.PublishesPorts() {
+		opts.Ports = []PortMapping{{HostPort: container.Port, ContainerPort: config.DefaultADBPort}}
+		for _, p := range container.PublishedPorts() {
+			opts.Ports = append(opts.Ports, PortMapping{HostPort: p.HostPort, ContainerPort: p.ContainerPort, Protocol: p.Protocol})
+		}
+	}
+	if container.NetworkMode() != config.NetworkBridge {
+		opts.Network = container.NetworkName()
+		opts.IPAddress = container.IP
+	}
+	for _, mount := range container.Mounts {
+		parts := strings.SplitN(mount, ":", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		volume := VolumeMount{Source: parts[0], Target: parts[1]}
+		if len(parts) == 3 {
+			volume.Options = parts[2]
+		}
+		opts.Volumes = append(opts.Volumes, volume)
+	}
 
-	// Boot arguments
-	args = append(args, fmt.Sprintf("androidboot.redroid_gpu_mode=%s", gpuMode))
+	opts.Args = container.BootArgs()
 
-	return args
+	return opts
 }
 
-func (m *Manager) Stop() error {
-	if err := CheckRoot(); err != nil {
+// Stop keeps the container unless remove is set, /data is kept either way
+func (m *Manager) Stop(ctx context.Context, remove bool) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	lock, err := m.lock("stop")
+	if err != nil {
 		return err
 	}
+	defer lock.Unlock()
+	if err := m.stop(ctx, remove); err != nil {
+		return err
+	}
+	if c := m.GetContainer(); c != nil && !c.Stopped {
+		c.Stopped = true
+		if err := m.store.Save(m.config); err != nil {
+			fmt.Printf("Warning: Failed to save the config: %v\n", err)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) stop(ctx context.Context, remove bool) error {
+	ctx, cancel := WithTimeout(ctx, m.config, config.OpStop)
+	defer cancel()
 
-	if !m.runtime.Exists(m.containerName) {
-		return fmt.Errorf("Container '%s' does not exist", m.containerName)
+	info, err := m.runtime.InspectContainer(ctx, m.containerName)
+	if errors.Is(err, ErrContainerNotFound) {
+		return NewError(ErrNotRunning, m.containerName, "Container '%s' does not exist", m.containerName)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to inspect container '%s': %w", m.containerName, err)
 	}
 
-	if !m.runtime.IsRunning(m.containerName) {
-		// Even if not running, we continue to the removal step
+	if !info.Running {
+		if !remove {
+			fmt.Printf("Container '%s' is already stopped\n", m.containerName)
+		}
 	} else {
 		spinner := ui.NewSpinner(fmt.Sprintf("Stopping container '%s'...", m.containerName))
 		spinner.Start()
 
-		if err := m.runtime.Stop(m.containerName); err != nil {
+		if err := m.runtime.Stop(ctx, m.containerName); err != nil {
 			spinner.Finish(fmt.Sprintf("Failed to stop container '%s'", m.containerName))
-			return fmt.Errorf("failed to stop container: %v", err)
+			return fmt.Errorf("failed to stop container: %w", err)
 		}
 		spinner.Finish(fmt.Sprintf("Container '%s' stopped successfully", m.containerName))
 	}
 
-	if err := m.runtime.Remove(m.containerName, false); err != nil {
-		if forceErr := m.runtime.Remove(m.containerName, true); forceErr != nil {
-			fmt.Printf("Warning: Could not remove stopped container: %v\n", forceErr)
+	if !remove {
+		return nil
+	}
+	if err := m.runtime.Remove(ctx, m.containerName, false); err != nil {
+		if forceErr := m.runtime.Remove(ctx, m.containerName, true); forceErr != nil {
+			return fmt.Errorf("Failed to remove container '%s': %w", m.containerName, forceErr)
 		}
 	}
+	if c := m.GetContainer(); c != nil {
+		fmt.Printf("Container '%s' removed, its data is kept in %s\n", m.containerName, c.GetDataPath())
+	}
 
 	return nil
 }
 
-func (m *Manager) Restart(verbose bool) error {
-	if err := m.Stop(); err != nil {
-		if !strings.Contains(err.Error(), "is already stopped") {
-			return err
-		}
+func (m *Manager) Pause(ctx context.Context) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	lock, err := m.lock("pause")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	info, err := m.runtime.InspectContainer(ctx, m.containerName)
+	if err != nil && !errors.Is(err, ErrContainerNotFound) {
+		return fmt.Errorf("Failed to inspect container '%s': %w", m.containerName, err)
+	}
+	if err != nil || !info.Running {
+		return notRunningError(m.containerName)
+	}
+	if info.Paused {
+		fmt.Printf("Container '%s' is already paused\n", m.containerName)
+		return nil
+	}
+
+	if err := m.runtime.Pause(ctx, m.containerName); err != nil {
+		return fmt.Errorf("Failed to pause container '%s': %w", m.containerName, err)
+	}
+	fmt.Printf("Container '%s' paused. Resume it with 'reddock resume %s'\n", m.containerName, m.containerName)
+	return nil
+}
+
+func (m *Manager) Resume(ctx context.Context) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	lock, err := m.lock("resume")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	info, err := m.runtime.InspectContainer(ctx, m.containerName)
+	if err != nil && !errors.Is(err, ErrContainerNotFound) {
+		return fmt.Errorf("Failed to inspect container '%s': %w", m.containerName, err)
+	}
+	if err != nil || !info.Running {
+		return notRunningError(m.containerName)
+	}
+	if !info.Paused {
+		fmt.Printf("Container '%s' is not paused\n", m.containerName)
+		return nil
+	}
+
+	if err := m.runtime.Unpause(ctx, m.containerName); err != nil {
+		return fmt.Errorf("Failed to resume container '%s': %w", m.containerName, err)
+	}
+	fmt.Printf("Container '%s' resumed\n", m.containerName)
+	return nil
+}
+
+func (m *Manager) Restart(ctx context.Context, verbose bool) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	lock, err := m.lock("restart")
+	if err != nil {
+		return err
+	}
+	if err := m.stop(ctx, false); err != nil && !errors.Is(err, ErrNotRunning) {
+		lock.Unlock()
+		return err
+	}
+	err = m.start(ctx)
+	lock.Unlock()
+	if err != nil || !verbose {
+		return err
 	}
-	return m.Start(verbose)
+	return m.FollowLogs(ctx)
 }
 
-func (m *Manager) IsRunning() bool {
-	return m.runtime.IsRunning(m.containerName)
+func (m *Manager) IsRunning(ctx context.Context) bool {
+	return m.runtime.IsRunning(ctx, m.containerName)
 }
 
-func (m *Manager) GetIP() (string, error) {
-	format := "{{range .NetworkSettings.Networks}}{{.IPAddress}}{{end}}"
-	ip, err := m.runtime.Inspect(m.containerName, format)
+func (m *Manager) GetIP(ctx context.Context) (string, error) {
+	info, err := m.runtime.InspectContainer(ctx, m.containerName)
 	if err != nil {
 		return "", err
 	}
-	return ip, nil
+	return info.IPAddress, nil
+}
+
+// ConnectAddress prefers the port the engine published while the container runs
+func (m *Manager) ConnectAddress(ctx context.Context) string {
+	container := m.GetContainer()
+	if container == nil {
+		return ""
+	}
+	info, err := m.runtime.InspectContainer(ctx, m.containerName)
+	if err != nil || !info.Running {
+		info = nil
+	}
+	return mappedADBAddress(container, info)
+}
+
+func (m *Manager) ShowPort(ctx context.Context) error {
+	if m.GetContainer() == nil {
+		return notFoundError(m.containerName)
+	}
+	fmt.Println(m.ConnectAddress(ctx))
+	return nil
+}
+
+// SetPort applies on the next start, recreating the container
+func (m *Manager) SetPort(ctx context.Context, port int) error {
+	lock, err := m.lock("port")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	container := m.GetContainer()
+	if container == nil {
+		return notFoundError(m.containerName)
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("Invalid port %d, expected 1-65535", port)
+	}
+	if !container.PublishesPorts() {
+		return fmt.Errorf("Container '%s' uses %s networking, ADB is not published on a host port", m.containerName, container.NetworkMode())
+	}
+	if port == container.Port {
+		fmt.Printf("Container '%s' already uses port %d\n", m.containerName, port)
+		return nil
+	}
+	if owner := portOwner(m.config, container.Host, port, m.containerName); owner != "" {
+		return NewError(ErrPortInUse, m.containerName, "Port %d is assigned to '%s'", port, owner)
+	}
+	if !container.IsRemote() && !portAvailable(port) {
+		return NewError(ErrPortInUse, m.containerName, "Port %d is in use by another process", port)
+	}
+
+	container.Port = port
+	if err := m.store.Save(m.config); err != nil {
+		return fmt.Errorf("Failed to save the config: %v", err)
+	}
+	fmt.Printf("ADB port of '%s' set to %d\n", m.containerName, port)
+	if m.runtime.IsRunning(ctx, m.containerName) {
+		fmt.Printf("Run 'reddock restart %s' to apply it\n", m.containerName)
+	}
+	return nil
+}
+
+func (m *Manager) Runtime() Runtime {
+	return m.runtime
 }
 
 func (m *Manager) GetContainer() *config.Container {
@@ -167,9 +539,13 @@ func (m *Manager) GetContainer() *config.Container {
 	return m.config.GetContainer(m.containerName)
 }
 
-func (m *Manager) showLogs() error {
-	cmd := exec.Command(m.runtime.Name(), "logs", "-f", m.containerName)
+func (m *Manager) showLogs(ctx context.Context) error {
+	cmd := m.runtime.Command(ctx, "logs", "-f", m.containerName)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	if err := cmd.Run(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	// Ctrl+C only detaches from the logs
+	return nil
 }
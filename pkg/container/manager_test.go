@@ -0,0 +1,542 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"reddock/pkg/config"
+)
+
+func TestStartRunsNewContainer(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	c := testContainer(t, "android")
+	c.Port = 5557
+	mgr := NewManagerWith(newMemStore(c), rt, "android")
+
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !rt.called("Run android") {
+		t.Fatalf("expected Run, calls: %v", rt.calls)
+	}
+	if !rt.IsRunning(context.Background(), "android") {
+		t.Fatal("container should be running")
+	}
+
+	opts := rt.lastRun
+	if !opts.Privileged || opts.Image != c.ImageURL || opts.Hostname != "android" {
+		t.Errorf("unexpected run options: %+v", opts)
+	}
+	if len(opts.Volumes) != 1 || opts.Volumes[0].Source != c.DataPath || opts.Volumes[0].Target != "/data" {
+		t.Errorf("unexpected volumes: %+v", opts.Volumes)
+	}
+	if len(opts.Ports) != 1 || opts.Ports[0].HostPort != 5557 || opts.Ports[0].ContainerPort != 5555 {
+		t.Errorf("unexpected ports: %+v", opts.Ports)
+	}
+	if len(opts.Args) != 1 || opts.Args[0] != "androidboot.redroid_gpu_mode=auto" {
+		t.Errorf("unexpected boot args: %v", opts.Args)
+	}
+	if opts.Labels[LabelManaged] != "true" || opts.Labels[LabelName] != "android" {
+		t.Errorf("unexpected labels: %v", opts.Labels)
+	}
+}
+
+func TestStartAlreadyRunning(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if rt.called("Run") || rt.called("StartExisting") {
+		t.Fatalf("running container must not be started again, calls: %v", rt.calls)
+	}
+}
+
+func TestStartExistingButStopped(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: false}
+	mgr := NewManagerWith(newMemStore(createdContainer(t, "android")), rt, "android")
+
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !rt.called("StartExisting android") {
+		t.Fatalf("expected StartExisting, calls: %v", rt.calls)
+	}
+	if rt.called("Run") {
+		t.Fatal("existing container must not be recreated")
+	}
+	if !rt.IsRunning(context.Background(), "android") {
+		t.Fatal("container should be running")
+	}
+}
+
+func TestStartExistingFailure(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: false}
+	rt.failOn("StartExisting", errors.New("boom"))
+	mgr := NewManagerWith(newMemStore(createdContainer(t, "android")), rt, "android")
+
+	err := mgr.Start(context.Background(), false)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected start failure, got %v", err)
+	}
+}
+
+func TestStartRecreatesContainerWithoutFingerprint(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: false}
+	store := newMemStore(testContainer(t, "android"))
+	mgr := NewManagerWith(store, rt, "android")
+
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !rt.called("Remove android") || !rt.called("Run android") || rt.called("StartExisting") {
+		t.Fatalf("a container of unknown settings should be recreated, calls: %v", rt.calls)
+	}
+	if store.cfg.GetContainer("android").RunSpec == "" {
+		t.Error("the recreated container should be fingerprinted")
+	}
+}
+
+func TestStartFailureLeavesNoFingerprint(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.failOn("Run", errors.New("port is already allocated"))
+	store := newMemStore(testContainer(t, "android"))
+
+	if err := NewManagerWith(store, rt, "android").Start(context.Background(), false); err == nil {
+		t.Fatal("expected the run failure")
+	}
+	if store.cfg.GetContainer("android").RunSpec != "" {
+		t.Error("a failed run must not be fingerprinted")
+	}
+}
+
+func TestStartRequiresInitializedContainer(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+
+	if err := NewManagerWith(newMemStore(), rt, "missing").Start(context.Background(), false); err == nil {
+		t.Fatal("expected error for unknown container")
+	}
+
+	c := testContainer(t, "android")
+	c.Initialized = false
+	if err := NewManagerWith(newMemStore(c), rt, "android").Start(context.Background(), false); err == nil {
+		t.Fatal("expected error for uninitialized container")
+	}
+	if rt.called("Run") {
+		t.Fatal("nothing should have been run")
+	}
+}
+
+func TestStopKeepsContainer(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if err := mgr.Stop(context.Background(), false); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !rt.called("Stop android") || rt.called("Remove") {
+		t.Fatalf("expected Stop without Remove, calls: %v", rt.calls)
+	}
+	if !rt.Exists(context.Background(), "android") || rt.IsRunning(context.Background(), "android") {
+		t.Fatal("container should be kept stopped")
+	}
+}
+
+func TestStopWithRemove(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if err := mgr.Stop(context.Background(), true); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !rt.called("Stop android") || !rt.called("Remove android") {
+		t.Fatalf("expected Stop and Remove, calls: %v", rt.calls)
+	}
+	if rt.Exists(context.Background(), "android") {
+		t.Fatal("container should be removed after stop")
+	}
+}
+
+func TestStopMissingContainer(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if err := mgr.Stop(context.Background(), false); err == nil {
+		t.Fatal("expected error stopping a container that does not exist")
+	}
+}
+
+func TestRestartReusesContainer(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	mgr := NewManagerWith(newMemStore(createdContainer(t, "android")), rt, "android")
+
+	if err := mgr.Restart(context.Background(), false); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	want := []string{"Stop android", "Events android", "StartExisting android"}
+	if strings.Join(rt.calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("calls = %v, want %v", rt.calls, want)
+	}
+	if !rt.IsRunning(context.Background(), "android") {
+		t.Fatal("container should be running after restart")
+	}
+}
+
+func TestManagerGetIP(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	ip, err := mgr.GetIP(context.Background())
+	if err != nil || ip != "10.0.0.2" {
+		t.Fatalf("GetIP = %q, %v", ip, err)
+	}
+	if mgr.GetContainer() == nil {
+		t.Fatal("expected container config")
+	}
+}
+
+func TestListerUsesInjectedRuntime(t *testing.T) {
+	rt := newFakeRuntime()
+	store := newMemStore(testContainer(t, "android"))
+	if err := NewListerWith(store, rt).ListReddockContainers(context.Background()); err != nil {
+		t.Fatalf("ListReddockContainers: %v", err)
+	}
+	if len(store.cfg.Containers) != 1 {
+		t.Fatal("listing must not modify the config")
+	}
+}
+
+// downRuntime answers inspects like fakeRuntime except for containers
+// whose backend is down
+type downRuntime struct {
+	*fakeRuntime
+	down map[string]bool
+}
+
+func (d downRuntime) InspectContainer(ctx context.Context, containerName string) (*ContainerInfo, error) {
+	d.mu.Lock()
+	d.record("InspectContainer", containerName)
+	d.mu.Unlock()
+	if d.down[containerName] {
+		return nil, NewError(ErrRuntimeUnavailable, containerName, "Cannot connect to the podman socket")
+	}
+	return d.fakeRuntime.InspectContainer(ctx, containerName)
+}
+
+func TestListerKeepsOtherRuntimesOfUnreachableHost(t *testing.T) {
+	rt := downRuntime{newFakeRuntime(), map[string]bool{"a-podman": true}}
+	var containers []*config.Container
+	for name, runtime := range map[string]string{"a-podman": "podman", "b-docker": "docker", "c-podman": "podman"} {
+		c := testContainer(t, name)
+		c.Runtime = runtime
+		containers = append(containers, c)
+	}
+
+	if err := NewListerWith(newMemStore(containers...), rt).ListReddockContainers(context.Background()); err != nil {
+		t.Fatalf("ListReddockContainers: %v", err)
+	}
+	if !rt.called("InspectContainer b-docker") {
+		t.Errorf("a docker container on the same host should still be inspected, calls: %v", rt.calls)
+	}
+	if rt.called("InspectContainer c-podman") {
+		t.Errorf("the unreachable podman backend should not be queried again, calls: %v", rt.calls)
+	}
+}
+
+// hangingRuntime creates containers but never gets them running, like an
+// engine that stalls between create and start
+type hangingRuntime struct {
+	*fakeRuntime
+}
+
+func (h hangingRuntime) Run(ctx context.Context, opts *RunOptions) error {
+	h.mu.Lock()
+	h.record("Run", opts.Name)
+	h.containers[opts.Name] = &fakeContainer{image: opts.Image}
+	h.mu.Unlock()
+	<-ctx.Done()
+	return ContextError(ctx, ctx.Err())
+}
+
+func TestStartTimeoutDiscardsPartialContainer(t *testing.T) {
+	stubHost(t)
+	rt := hangingRuntime{newFakeRuntime()}
+	store := newMemStore(testContainer(t, "android"))
+	store.cfg.Timeouts = map[string]string{"start": "20ms"}
+	mgr := NewManagerWith(store, rt, "android")
+
+	err := mgr.Start(context.Background(), false)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Start = %v, want ErrTimeout", err)
+	}
+	if rt.Exists(context.Background(), "android") {
+		t.Fatal("half-created container should be removed")
+	}
+}
+
+func TestStartCancelled(t *testing.T) {
+	stubHost(t)
+	rt := hangingRuntime{newFakeRuntime()}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	if err := mgr.Start(ctx, false); !errors.Is(err, ErrCanceled) {
+		t.Fatalf("Start = %v, want ErrCanceled", err)
+	}
+	if rt.Exists(context.Background(), "android") {
+		t.Fatal("half-created container should be removed")
+	}
+}
+
+func TestStartFailsWhenContainerDies(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	code := 139
+	rt.events = make(chan Event, 1)
+	rt.events <- Event{Container: "android", Action: "die", ExitCode: &code}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	err := mgr.Start(context.Background(), false)
+	if !errors.Is(err, ErrContainerDied) {
+		t.Fatalf("err = %v, want ErrContainerDied", err)
+	}
+	if !strings.Contains(err.Error(), "exited with code 139") {
+		t.Errorf("error does not carry the exit code: %v", err)
+	}
+}
+
+func TestStartReportsOOMKill(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.events = make(chan Event, 2)
+	rt.events <- Event{Container: "android", Action: "start"}
+	rt.events <- Event{Container: "android", Action: "oom"}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	err := mgr.Start(context.Background(), false)
+	if !errors.Is(err, ErrContainerDied) || !strings.Contains(err.Error(), "OOM") {
+		t.Fatalf("err = %v, want an OOM ErrContainerDied", err)
+	}
+}
+
+func TestStartSucceedsAfterQuietGracePeriod(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.events = make(chan Event)
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !rt.called("Events android") {
+		t.Errorf("start did not watch events, calls: %v", rt.calls)
+	}
+}
+
+func TestStartReturnsAfterQuietWindow(t *testing.T) {
+	stubHost(t)
+	startupGrace = time.Hour
+	rt := newFakeRuntime()
+	rt.events = make(chan Event, 1)
+	rt.events <- Event{Container: "android", Action: "start"}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	done := make(chan error, 1)
+	go func() { done <- mgr.Start(context.Background(), false) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("start waited for the grace period despite the start event")
+	}
+}
+
+func TestStartSucceedsWhenEventStreamFails(t *testing.T) {
+	stubHost(t)
+	startupGrace = time.Hour
+	rt := newFakeRuntime()
+	rt.eventsErr = errors.New("Event stream ended: connection refused")
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+}
+
+func TestStartPollingNoticesExit(t *testing.T) {
+	stubHost(t)
+	startupGrace = time.Hour
+	startupQuiet = 200 * time.Millisecond
+	rt := newFakeRuntime()
+	rt.eventsErr = errors.New("Event stream ended: connection refused")
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	go func() {
+		for !rt.IsRunning(context.Background(), "android") {
+			time.Sleep(time.Millisecond)
+		}
+		rt.Stop(context.Background(), "android")
+	}()
+	if err := mgr.Start(context.Background(), false); !errors.Is(err, ErrContainerDied) {
+		t.Fatalf("err = %v, want ErrContainerDied", err)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if err := mgr.Pause(context.Background()); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if !rt.containers["android"].paused {
+		t.Fatal("container should be paused")
+	}
+
+	// Start must not try to start a paused container again
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start on paused container: %v", err)
+	}
+	if rt.called("StartExisting") || rt.called("Run") {
+		t.Fatalf("paused container was started, calls: %v", rt.calls)
+	}
+
+	if err := mgr.Resume(context.Background()); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if rt.containers["android"].paused || !rt.containers["android"].running {
+		t.Fatal("container should be running again")
+	}
+}
+
+func TestPauseReportsInspectFailures(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	rt.failOn("InspectContainer", NewError(ErrRuntimeUnavailable, "", "docker is unavailable"))
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	for name, op := range map[string]func(context.Context) error{
+		"Pause":  mgr.Pause,
+		"Resume": mgr.Resume,
+		"Stop":   func(ctx context.Context) error { return mgr.Stop(ctx, false) },
+	} {
+		err := op(context.Background())
+		if !errors.Is(err, ErrRuntimeUnavailable) || errors.Is(err, ErrNotRunning) {
+			t.Errorf("%s = %v, want ErrRuntimeUnavailable", name, err)
+		}
+	}
+}
+
+func TestPauseStoppedContainer(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: false}
+	mgr := NewManagerWith(newMemStore(testContainer(t, "android")), rt, "android")
+
+	if err := mgr.Pause(context.Background()); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("err = %v, want ErrNotRunning", err)
+	}
+	if rt.called("Pause") {
+		t.Fatal("stopped container must not be paused")
+	}
+}
+
+func TestRestartAppliesChangedSettings(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	store := newMemStore(testContainer(t, "android"))
+	if err := NewManagerWith(store, rt, "android").Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	store.cfg.GetContainer("android").Memory = "3g"
+
+	rt.calls = nil
+	if err := NewManagerWith(store, rt, "android").Restart(context.Background(), false); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	if !rt.called("Remove android") || !rt.called("Run android") || rt.lastRun.Memory != "3g" {
+		t.Fatalf("expected a recreate with the new memory limit, calls: %v", rt.calls)
+	}
+}
+
+func TestStartMountsBinderfs(t *testing.T) {
+	stubHost(t)
+	binderfsSupported = func() bool { return true }
+	var mounted string
+	setupBinderfs = func(dir string) error {
+		mounted = dir
+		return nil
+	}
+	rt := newFakeRuntime()
+	c := testContainer(t, "android")
+	c.Devices = []string{"/dev/kvm"}
+	mgr := NewManagerWith(newMemStore(c), rt, "android")
+
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if mounted != BinderfsPath("android") {
+		t.Fatalf("mounted %q, want %q", mounted, BinderfsPath("android"))
+	}
+	want := []string{
+		"/dev/kvm",
+		"/run/reddock/binderfs/android/binder:/dev/binder",
+		"/run/reddock/binderfs/android/hwbinder:/dev/hwbinder",
+		"/run/reddock/binderfs/android/vndbinder:/dev/vndbinder",
+	}
+	if strings.Join(rt.lastRun.Devices, ",") != strings.Join(want, ",") {
+		t.Fatalf("devices = %v, want %v", rt.lastRun.Devices, want)
+	}
+	if len(c.Devices) != 1 {
+		t.Fatalf("container devices changed to %v", c.Devices)
+	}
+}
+
+func TestStartWithHostBinder(t *testing.T) {
+	stubHost(t)
+	binderfsSupported = func() bool { return true }
+	setupBinderfs = func(dir string) error {
+		t.Fatalf("binderfs mounted on %s for a host binder container", dir)
+		return nil
+	}
+	rt := newFakeRuntime()
+	c := testContainer(t, "android")
+	c.Binder = config.BinderHost
+	mgr := NewManagerWith(newMemStore(c), rt, "android")
+
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if len(rt.lastRun.Devices) != 0 {
+		t.Fatalf("devices = %v, want none", rt.lastRun.Devices)
+	}
+}
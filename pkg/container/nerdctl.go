@@ -0,0 +1,195 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultContainerdSocket    = "/run/containerd/containerd.sock"
+	DefaultContainerdNamespace = "default"
+
+	// k3s ships its own containerd on a separate socket
+	k3sContainerdSocket = "/run/k3s/containerd/containerd.sock"
+)
+
+// NerdctlRuntime drives containerd through the nerdctl CLI
+type NerdctlRuntime struct {
+	*GenericRuntime
+	address   string
+	namespace string
+}
+
+// ContainerdAddress returns the containerd socket, falling back to the k3s one
+func ContainerdAddress() string {
+	if address := os.Getenv("CONTAINERD_ADDRESS"); address != "" {
+		return strings.TrimPrefix(address, "unix://")
+	}
+	if _, err := os.Stat(DefaultContainerdSocket); err != nil {
+		if _, err := os.Stat(k3sContainerdSocket); err == nil {
+			return k3sContainerdSocket
+		}
+	}
+	return DefaultContainerdSocket
+}
+
+// ContainerdNamespace returns the namespace reddock containers live in
+func ContainerdNamespace() string {
+	if namespace := os.Getenv("CONTAINERD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	return DefaultContainerdNamespace
+}
+
+func NewNerdctlRuntime(address, namespace string) *NerdctlRuntime {
+	return &NerdctlRuntime{
+		GenericRuntime: &GenericRuntime{
+			binary:     "nerdctl",
+			globalArgs: []string{"--address", address, "--namespace", namespace},
+		},
+		address:   address,
+		namespace: namespace,
+	}
+}
+
+func (r *NerdctlRuntime) Address() string {
+	return r.address
+}
+
+func (r *NerdctlRuntime) Namespace() string {
+	return r.namespace
+}
+
+func (r *NerdctlRuntime) IsInstalled(ctx context.Context) bool {
+	if _, err := exec.LookPath("nerdctl"); err != nil {
+		return false
+	}
+	_, err := os.Stat(r.address)
+	return err == nil
+}
+
+// Run drops SELinux relabel options, nerdctl rejects them on bind mounts
+func (r *NerdctlRuntime) Run(ctx context.Context, opts *RunOptions) error {
+	return r.GenericRuntime.Run(ctx, nerdctlRunOptions(opts))
+}
+
+func nerdctlRunOptions(opts *RunOptions) *RunOptions {
+	adjusted := *opts
+	adjusted.Volumes = nil
+	for _, v := range opts.Volumes {
+		var kept []string
+		for _, option := range strings.Split(v.Options, ",") {
+			if option != "" && option != "z" && option != "Z" {
+				kept = append(kept, option)
+			}
+		}
+		v.Options = strings.Join(kept, ",")
+		adjusted.Volumes = append(adjusted.Volumes, v)
+	}
+	return &adjusted
+}
+
+// Build needs a running buildkitd, which containerd hosts often lack
+func (r *NerdctlRuntime) Build(ctx context.Context, contextDir, tag string) error {
+	err := r.GenericRuntime.Build(ctx, contextDir, tag)
+	if err != nil && ctx.Err() == nil {
+		if _, lookErr := exec.LookPath("buildctl"); lookErr != nil {
+			return fmt.Errorf("%v\nnerdctl build requires BuildKit (buildkitd and buildctl)", err)
+		}
+	}
+	return err
+}
+
+// Exists uses inspect since nerdctl name filters are not anchored
+func (r *NerdctlRuntime) Exists(ctx context.Context, containerName string) bool {
+	_, err := r.InspectContainer(ctx, containerName)
+	return err == nil
+}
+
+// IsAuthenticated reads the docker credentials file nerdctl login shares
+func (r *NerdctlRuntime) IsAuthenticated(ctx context.Context) (bool, string, error) {
+	user, _, ok := lookupCredentials(DockerConfigPath(), dockerHubRegistry)
+	return ok, user, nil
+}
+
+// nerdctlEventJSON is a raw containerd envelope with a JSON payload
+type nerdctlEventJSON struct {
+	Timestamp time.Time `json:"Timestamp"`
+	ID        string    `json:"ID"`
+	Topic     string    `json:"Topic"`
+	Event     string    `json:"Event"`
+}
+
+var nerdctlTopics = map[string]string{
+	"/containers/create": "create",
+	"/containers/delete": "destroy",
+	"/tasks/start":       "start",
+	"/tasks/exit":        "die",
+	"/tasks/oom":         "oom",
+	"/tasks/paused":      "pause",
+	"/tasks/resumed":     "unpause",
+}
+
+// Events resolves container IDs through inspect, containerd topics carry no names
+func (r *NerdctlRuntime) Events(ctx context.Context, containers []string) (<-chan Event, <-chan error) {
+	wanted := make(map[string]bool)
+	for _, name := range containers {
+		wanted[name] = true
+	}
+	names := make(map[string]string)
+
+	parse := func(line []byte) (Event, bool) {
+		msg, ok := parseNerdctlEvent(line)
+		if !ok {
+			return Event{}, false
+		}
+		name, known := names[msg.Container]
+		if !known {
+			if info, err := r.InspectContainer(ctx, msg.Container); err == nil {
+				name = info.Name
+			}
+			names[msg.Container] = name
+		}
+		if name == "" || (len(wanted) > 0 && !wanted[name]) {
+			return Event{}, false
+		}
+		msg.Container = name
+		return msg, true
+	}
+	return streamCommandEvents(ctx, r.Command(ctx, "events", "--format", "{{json .}}"), parse)
+}
+
+func parseNerdctlEvent(line []byte) (Event, bool) {
+	var msg nerdctlEventJSON
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return Event{}, false
+	}
+	action, ok := nerdctlTopics[msg.Topic]
+	if !ok {
+		return Event{}, false
+	}
+
+	var payload struct {
+		ContainerID string `json:"container_id"`
+		ID          string `json:"id"`
+		ExitStatus  *int   `json:"exit_status"`
+	}
+	json.Unmarshal([]byte(msg.Event), &payload)
+
+	ev := Event{Time: msg.Timestamp, Action: action, Container: payload.ContainerID}
+	if ev.Container == "" {
+		ev.Container = payload.ID
+	}
+	if ev.Container == "" {
+		ev.Container = msg.ID
+	}
+	if action == "die" {
+		ev.ExitCode = payload.ExitStatus
+	}
+	return ev, ev.Container != ""
+}
@@ -0,0 +1,49 @@
+package container
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNerdctlCommandTargetsContainerd(t *testing.T) {
+	rt := NewNerdctlRuntime("/run/k3s/containerd/containerd.sock", "reddock")
+	cmd := rt.Command(context.Background(), "ps", "-a")
+	got := strings.Join(cmd.Args[1:], " ")
+	want := "--address /run/k3s/containerd/containerd.sock --namespace reddock ps -a"
+	if got != want {
+		t.Fatalf("args = %q, want %q", got, want)
+	}
+	if rt.Name() != RuntimeNerdctl {
+		t.Errorf("Name = %q", rt.Name())
+	}
+}
+
+func TestNerdctlRunOptionsDropRelabel(t *testing.T) {
+	opts := &RunOptions{
+		Name:  "android",
+		Image: "redroid/redroid:13.0.0-latest",
+		Volumes: []VolumeMount{
+			{Source: "/srv/data", Target: "/data", Options: "z"},
+			{Source: "/srv/ro", Target: "/ro", Options: "ro,Z"},
+		},
+	}
+	args := strings.Join(runArgs(nerdctlRunOptions(opts)), " ")
+	if !strings.Contains(args, "-v /srv/data:/data ") || !strings.Contains(args, "-v /srv/ro:/ro:ro ") {
+		t.Fatalf("unexpected run args: %s", args)
+	}
+	if opts.Volumes[0].Options != "z" {
+		t.Fatal("caller options must not be modified")
+	}
+}
+
+func TestContainerdEnvironment(t *testing.T) {
+	t.Setenv("CONTAINERD_ADDRESS", "unix:///tmp/containerd.sock")
+	t.Setenv("CONTAINERD_NAMESPACE", "ci")
+	if got := ContainerdAddress(); got != "/tmp/containerd.sock" {
+		t.Errorf("ContainerdAddress = %q", got)
+	}
+	if got := ContainerdNamespace(); got != "ci" {
+		t.Errorf("ContainerdNamespace = %q", got)
+	}
+}
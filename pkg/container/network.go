@@ -0,0 +1,40 @@
+package container
+
+import (
+	"context"
+	"fmt"
+
+	"reddock/pkg/config"
+)
+
+// ensureNetwork creates the network a container joins unless the engine has it
+func ensureNetwork(ctx context.Context, runtime Runtime, c *config.Container) error {
+	mode := c.NetworkMode()
+	if mode == config.NetworkBridge || mode == config.NetworkHost {
+		return nil
+	}
+	name := c.NetworkName()
+	if runtime.NetworkExists(ctx, name) {
+		return nil
+	}
+
+	opts := &NetworkOptions{Name: name, Subnet: c.Subnet, Gateway: c.Gateway}
+	if mode == config.NetworkMacvlan {
+		opts.Driver = "macvlan"
+		opts.Parent = c.MacvlanParent
+	}
+	fmt.Printf("Creating network '%s'\n", name)
+	return runtime.CreateNetwork(ctx, opts)
+}
+
+// NetworkLabel describes the network of a container for status output
+func NetworkLabel(c *config.Container) string {
+	label := c.NetworkName()
+	if c.NetworkMode() == config.NetworkMacvlan {
+		label = "macvlan on " + c.MacvlanParent
+	}
+	if c.IP != "" {
+		label += " (" + c.IP + ")"
+	}
+	return label
+}
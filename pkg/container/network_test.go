@@ -0,0 +1,122 @@
+package container
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"reddock/pkg/config"
+)
+
+func TestNetworkSettingsValidation(t *testing.T) {
+	tests := []struct {
+		pairs []string
+		ok    bool
+	}{
+		{[]string{"network=lab", "ip=172.30.0.10", "subnet=172.30.0.0/24"}, true},
+		{[]string{"network=macvlan", "macvlan-parent=eth0", "subnet=192.168.1.0/24", "ip=192.168.1.50"}, true},
+		{[]string{"network=host"}, true},
+		{[]string{"publish=27042:27042", "publish=5900/tcp"}, true},
+		{[]string{"ip=172.30.0.10"}, false},
+		{[]string{"network=host", "publish=5900"}, false},
+		{[]string{"network=macvlan", "subnet=192.168.1.0/24"}, false},
+		{[]string{"network=lab", "ip=10.0.0.5", "subnet=172.30.0.0/24"}, false},
+		{[]string{"network=bad name"}, false},
+		{[]string{"publish=27042:frida"}, false},
+		{[]string{"publish=5900/sctp"}, false},
+	}
+	for _, tt := range tests {
+		err := (&config.Container{}).ApplySettings(tt.pairs)
+		if (err == nil) != tt.ok {
+			t.Errorf("ApplySettings(%v) error = %v, want ok %v", tt.pairs, err, tt.ok)
+		}
+	}
+}
+
+func TestStartCreatesMacvlanNetwork(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	c := testContainer(t, "android")
+	if err := c.ApplySettings([]string{"network=macvlan", "macvlan-parent=eth0",
+		"subnet=192.168.1.0/24", "gateway=192.168.1.1", "ip=192.168.1.50"}); err != nil {
+		t.Fatalf("ApplySettings: %v", err)
+	}
+	m := NewManagerWith(newMemStore(c), rt, "android")
+
+	if err := m.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	network := rt.networks["reddock-macvlan-eth0"]
+	if network == nil || network.Driver != "macvlan" || network.Parent != "eth0" || network.Subnet != "192.168.1.0/24" {
+		t.Fatalf("macvlan network not created: %+v", network)
+	}
+	if rt.lastRun.Network != "reddock-macvlan-eth0" || rt.lastRun.IPAddress != "192.168.1.50" || len(rt.lastRun.Ports) != 0 {
+		t.Fatalf("unexpected run options: %+v", rt.lastRun)
+	}
+	if got := ADBAddress(c); got != "192.168.1.50:5555" {
+		t.Fatalf("ADBAddress = %s, want the LAN address", got)
+	}
+}
+
+func TestStartJoinsExistingNetworkWithExtraPorts(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.networks["lab"] = &NetworkOptions{Name: "lab"}
+	c := testContainer(t, "android")
+	if err := c.ApplySettings([]string{"network=lab", "publish=27042:27042", "publish=5900:5900/udp"}); err != nil {
+		t.Fatalf("ApplySettings: %v", err)
+	}
+
+	if err := NewManagerWith(newMemStore(c), rt, "android").Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if rt.called("CreateNetwork") {
+		t.Fatalf("existing network recreated, calls = %v", rt.calls)
+	}
+	var ports []string
+	for _, p := range rt.lastRun.Ports {
+		ports = append(ports, p.String())
+	}
+	if rt.lastRun.Network != "lab" || strings.Join(ports, " ") != "5555:5555/tcp 27042:27042/tcp 5900:5900/udp" {
+		t.Fatalf("network = %q, ports = %v", rt.lastRun.Network, ports)
+	}
+}
+
+func TestDefaultNetworkKeepsFingerprint(t *testing.T) {
+	c := testContainer(t, "android")
+	before := NewManagerWith(newMemStore(c), newFakeRuntime(), "android").buildRunOptions(c).Fingerprint()
+	c.Network = config.NetworkBridge
+	after := NewManagerWith(newMemStore(c), newFakeRuntime(), "android").buildRunOptions(c).Fingerprint()
+	if before != after {
+		t.Fatal("an explicit bridge network should not recreate the container")
+	}
+}
+
+func TestRunArgsNetwork(t *testing.T) {
+	args := strings.Join(runArgs(&RunOptions{Name: "a", Image: "img", Network: "lab", IPAddress: "172.30.0.10"}), " ")
+	if !strings.Contains(args, "--network lab --ip 172.30.0.10") {
+		t.Fatalf("run args %q lack the network", args)
+	}
+	create := strings.Join(networkCreateArgs(&NetworkOptions{Name: "reddock-macvlan-eth0", Driver: "macvlan",
+		Subnet: "192.168.1.0/24", Parent: "eth0"}), " ")
+	if create != "network create --driver macvlan --subnet 192.168.1.0/24 -o parent=eth0 reddock-macvlan-eth0" {
+		t.Fatalf("network create args = %q", create)
+	}
+}
+
+func TestEngineRuntimeStaticIP(t *testing.T) {
+	engine, socket := startStandInEngine(t)
+	rt := NewEngineRuntime(socket)
+
+	err := rt.Run(context.Background(), &RunOptions{Name: "android", Image: "img", Network: "lab", IPAddress: "172.30.0.10"})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if engine.lastCreate.HostConfig.NetworkMode != "lab" {
+		t.Fatalf("network mode = %q", engine.lastCreate.HostConfig.NetworkMode)
+	}
+	endpoint := engine.lastCreate.NetworkingConfig.EndpointsConfig["lab"]
+	if endpoint.IPAMConfig == nil || endpoint.IPAMConfig.IPv4Address != "172.30.0.10" {
+		t.Fatalf("static address not requested: %+v", engine.lastCreate.NetworkingConfig)
+	}
+}
@@ -0,0 +1,515 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"reddock/pkg/config"
+)
+
+const (
+	DefaultPodmanSocket = "/run/podman/podman.sock"
+	libpodAPIPrefix     = "/v4.0.0/libpod"
+)
+
+// PodmanRuntime talks to the libpod REST API
+type PodmanRuntime struct {
+	client   *apiClient
+	rootless bool
+}
+
+// PodmanSocketPath returns the libpod socket for the current user
+func PodmanSocketPath() string {
+	if host := os.Getenv("CONTAINER_HOST"); strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://")
+	}
+	if os.Getuid() == 0 {
+		return DefaultPodmanSocket
+	}
+	return filepath.Join(userRuntimeDir(), "podman", "podman.sock")
+}
+
+func userRuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return fmt.Sprintf("/run/user/%d", os.Getuid())
+}
+
+func PodmanAuthPath() string {
+	if path := os.Getenv("REGISTRY_AUTH_FILE"); path != "" {
+		return path
+	}
+	path := filepath.Join(userRuntimeDir(), "containers", "auth.json")
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return DockerConfigPath()
+}
+
+func NewPodmanRuntime(socketPath string) *PodmanRuntime {
+	return &PodmanRuntime{
+		client:   newAPIClient(unixEndpoint(socketPath), libpodAPIPrefix),
+		rootless: os.Getuid() != 0,
+	}
+}
+
+// RootlessSupported reports whether rootless podman can run redroid here
+func RootlessSupported() bool {
+	if _, err := exec.LookPath("podman"); err != nil {
+		return false
+	}
+	return userNamespacesEnabled()
+}
+
+func userNamespacesEnabled() bool {
+	if data, err := os.ReadFile("/proc/sys/user/max_user_namespaces"); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && n == 0 {
+			return false
+		}
+	}
+	// Debian and Ubuntu kernels gate unprivileged namespaces behind a sysctl
+	if data, err := os.ReadFile("/proc/sys/kernel/unprivileged_userns_clone"); err == nil {
+		if strings.TrimSpace(string(data)) != "1" {
+			return false
+		}
+	}
+	return true
+}
+
+type podmanSpec struct {
+	Name         string                   `json:"name"`
+	Hostname     string                   `json:"hostname,omitempty"`
+	Image        string                   `json:"image"`
+	Privileged   bool                     `json:"privileged"`
+	Command      []string                 `json:"command,omitempty"`
+	Mounts       []podmanMount            `json:"mounts,omitempty"`
+	PortMappings []podmanPortMapping      `json:"portmappings,omitempty"`
+	Env          map[string]string        `json:"env,omitempty"`
+	Labels       map[string]string        `json:"labels,omitempty"`
+	Devices      []podmanDevice           `json:"devices,omitempty"`
+	Resources    *podmanResources         `json:"resource_limits,omitempty"`
+	NetNS        *podmanNamespace         `json:"netns,omitempty"`
+	Networks     map[string]podmanNetwork `json:"Networks,omitempty"`
+}
+
+type podmanNamespace struct {
+	NSMode string `json:"nsmode"`
+}
+
+type podmanNetwork struct {
+	StaticIPs []string `json:"static_ips,omitempty"`
+}
+
+type podmanNetworkRequest struct {
+	Name             string         `json:"name"`
+	Driver           string         `json:"driver,omitempty"`
+	NetworkInterface string         `json:"network_interface,omitempty"`
+	Subnets          []podmanSubnet `json:"subnets,omitempty"`
+}
+
+type podmanSubnet struct {
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway,omitempty"`
+}
+
+type podmanDevice struct {
+	Path string `json:"path"`
+}
+
+type podmanResources struct {
+	CPU    *podmanCPU    `json:"cpu,omitempty"`
+	Memory *podmanMemory `json:"memory,omitempty"`
+	Pids   *podmanPids   `json:"pids,omitempty"`
+}
+
+type podmanCPU struct {
+	Quota  int64  `json:"quota,omitempty"`
+	Period uint64 `json:"period,omitempty"`
+	Cpus   string `json:"cpus,omitempty"`
+}
+
+type podmanMemory struct {
+	Limit int64 `json:"limit"`
+}
+
+type podmanPids struct {
+	Limit int64 `json:"limit"`
+}
+
+// cpuPeriod is the CFS period the --cpus shorthand is expressed against
+const cpuPeriod = 100000
+
+func podmanLimits(opts *RunOptions) (*podmanResources, error) {
+	res := &podmanResources{}
+	if opts.CPUs != "" || opts.CPUSet != "" {
+		res.CPU = &podmanCPU{Cpus: opts.CPUSet}
+		if opts.CPUs != "" {
+			cpus, err := strconv.ParseFloat(opts.CPUs, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid cpus '%s': %v", opts.CPUs, err)
+			}
+			res.CPU.Quota = int64(cpus * cpuPeriod)
+			res.CPU.Period = cpuPeriod
+		}
+	}
+	if opts.Memory != "" {
+		memory, err := config.ParseMemorySize(opts.Memory)
+		if err != nil {
+			return nil, err
+		}
+		res.Memory = &podmanMemory{Limit: memory}
+	}
+	if opts.PidsLimit != 0 {
+		res.Pids = &podmanPids{Limit: opts.PidsLimit}
+	}
+	if res.CPU == nil && res.Memory == nil && res.Pids == nil {
+		return nil, nil
+	}
+	return res, nil
+}
+
+type podmanMount struct {
+	Destination string   `json:"destination"`
+	Source      string   `json:"source"`
+	Type        string   `json:"type"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type podmanPortMapping struct {
+	HostPort      int    `json:"host_port"`
+	ContainerPort int    `json:"container_port"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+type podmanContainerJSON struct {
+	containerJSON
+	ImageName string `json:"ImageName"`
+}
+
+func (r *PodmanRuntime) Name() string {
+	return "podman"
+}
+
+func (r *PodmanRuntime) Rootless() bool {
+	return r.rootless
+}
+
+// isRootlessPodman reports whether runtime drives podman as a regular user
+func isRootlessPodman(runtime Runtime) bool {
+	switch r := runtime.(type) {
+	case *PodmanRuntime:
+		return r.Rootless()
+	case *GenericRuntime:
+		return r.binary == "podman" && len(r.globalArgs) == 0 && os.Getuid() != 0
+	}
+	return false
+}
+
+// Command runs the local podman CLI, which shares the service's storage
+func (r *PodmanRuntime) Command(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "podman", args...)
+}
+
+func (r *PodmanRuntime) IsInstalled(ctx context.Context) bool {
+	return r.client.ping(ctx, "/_ping")
+}
+
+func (r *PodmanRuntime) PullImage(ctx context.Context, image string) error {
+	query := url.Values{"reference": {image}}
+	header := http.Header{"X-Registry-Auth": {registryAuthHeader(PodmanAuthPath(), image)}}
+
+	resp, err := r.client.do(ctx, http.MethodPost, "/images/pull", query, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return ContextError(ctx, readStream(resp.Body, os.Stdout))
+}
+
+func (r *PodmanRuntime) PushImage(ctx context.Context, image string) error {
+	header := http.Header{"X-Registry-Auth": {registryAuthHeader(PodmanAuthPath(), image)}}
+
+	resp, err := r.client.do(ctx, http.MethodPost, "/images/"+image+"/push", nil, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return ContextError(ctx, readStream(resp.Body, os.Stdout))
+}
+
+func (r *PodmanRuntime) Run(ctx context.Context, opts *RunOptions) error {
+	spec := podmanSpec{
+		Name:       opts.Name,
+		Hostname:   opts.Hostname,
+		Image:      opts.Image,
+		Privileged: opts.Privileged,
+		Command:    opts.Args,
+		Labels:     opts.Labels,
+	}
+	resources, err := podmanLimits(opts)
+	if err != nil {
+		return err
+	}
+	spec.Resources = resources
+	for _, d := range opts.Devices {
+		spec.Devices = append(spec.Devices, podmanDevice{Path: d})
+	}
+	if len(opts.Env) > 0 {
+		spec.Env = make(map[string]string)
+		for _, e := range opts.Env {
+			name, value, _ := strings.Cut(e, "=")
+			spec.Env[name] = value
+		}
+	}
+	for _, v := range opts.Volumes {
+		mount := podmanMount{Destination: v.Target, Source: v.Source, Type: "bind", Options: []string{"rbind"}}
+		if v.Options != "" {
+			mount.Options = append(mount.Options, strings.Split(v.Options, ",")...)
+		}
+		spec.Mounts = append(spec.Mounts, mount)
+	}
+	switch opts.Network {
+	case "", config.NetworkBridge:
+	case config.NetworkHost:
+		spec.NetNS = &podmanNamespace{NSMode: "host"}
+	default:
+		network := podmanNetwork{}
+		if opts.IPAddress != "" {
+			network.StaticIPs = []string{opts.IPAddress}
+		}
+		spec.NetNS = &podmanNamespace{NSMode: "bridge"}
+		spec.Networks = map[string]podmanNetwork{opts.Network: network}
+	}
+	for _, p := range opts.Ports {
+		spec.PortMappings = append(spec.PortMappings, podmanPortMapping{
+			HostPort:      p.HostPort,
+			ContainerPort: p.ContainerPort,
+			Protocol:      p.proto(),
+		})
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := r.client.doJSON(ctx, http.MethodPost, "/containers/create", nil, spec, &created); err != nil {
+		return classify(err, ErrImageMissing, opts.Name)
+	}
+	if err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+created.ID+"/start", nil, nil, nil); err != nil {
+		// Do not leave a created but never started container behind
+		r.Remove(ctx, created.ID, true)
+		return classify(err, ErrContainerNotFound, opts.Name)
+	}
+	return nil
+}
+
+func (r *PodmanRuntime) Build(ctx context.Context, contextDir, tag string) error {
+	body, err := tarDirectory(contextDir)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	query := url.Values{"t": {tag}, "dockerfile": {"Dockerfile"}}
+	header := http.Header{"Content-Type": {"application/x-tar"}}
+	resp, err := r.client.do(ctx, http.MethodPost, "/build", query, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var output bytes.Buffer
+	if err := readStream(resp.Body, &output); err != nil {
+		if ctx.Err() != nil {
+			return ContextError(ctx, err)
+		}
+		return fmt.Errorf("%v\n%s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+func (r *PodmanRuntime) Stop(ctx context.Context, containerName string) error {
+	err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+containerName+"/stop", nil, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *PodmanRuntime) StartExisting(ctx context.Context, containerName string) error {
+	err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+containerName+"/start", nil, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *PodmanRuntime) Pause(ctx context.Context, containerName string) error {
+	err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+containerName+"/pause", nil, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *PodmanRuntime) Unpause(ctx context.Context, containerName string) error {
+	err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+containerName+"/unpause", nil, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *PodmanRuntime) Rename(ctx context.Context, containerName, newName string) error {
+	query := url.Values{"name": {newName}}
+	err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+containerName+"/rename", query, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *PodmanRuntime) Remove(ctx context.Context, containerName string, force bool) error {
+	query := url.Values{"force": {strconv.FormatBool(force)}}
+	err := r.client.doJSON(ctx, http.MethodDelete, "/containers/"+containerName, query, nil, nil)
+	return classify(err, ErrContainerNotFound, containerName)
+}
+
+func (r *PodmanRuntime) RemoveImage(ctx context.Context, image string) error {
+	err := r.client.doJSON(ctx, http.MethodDelete, "/images/"+image, nil, nil, nil)
+	return classify(err, ErrImageMissing, "")
+}
+
+func (r *PodmanRuntime) ImageExists(ctx context.Context, image string) bool {
+	return r.client.doJSON(ctx, http.MethodGet, "/images/"+image+"/exists", nil, nil, nil) == nil
+}
+
+func (r *PodmanRuntime) InspectContainer(ctx context.Context, containerName string) (*ContainerInfo, error) {
+	var doc podmanContainerJSON
+	if err := r.client.doJSON(ctx, http.MethodGet, "/containers/"+containerName+"/json", nil, nil, &doc); err != nil {
+		return nil, classify(err, ErrContainerNotFound, containerName)
+	}
+	info := doc.info()
+	// libpod reports the image ID in Image and the reference in ImageName
+	if doc.ImageName != "" {
+		info.Image = doc.ImageName
+	}
+	return info, nil
+}
+
+func (r *PodmanRuntime) Stats(ctx context.Context, containerName string) (*ContainerStats, error) {
+	var report struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"Error"`
+		Stats []struct {
+			CPU         float64 `json:"CPU"`
+			MemUsage    uint64  `json:"MemUsage"`
+			MemLimit    uint64  `json:"MemLimit"`
+			NetInput    uint64  `json:"NetInput"`
+			NetOutput   uint64  `json:"NetOutput"`
+			BlockInput  uint64  `json:"BlockInput"`
+			BlockOutput uint64  `json:"BlockOutput"`
+			PIDs        uint64  `json:"PIDs"`
+		} `json:"Stats"`
+	}
+	query := url.Values{"containers": {containerName}, "stream": {"false"}}
+	if err := r.client.doJSON(ctx, http.MethodGet, "/containers/stats", query, nil, &report); err != nil {
+		return nil, classify(err, ErrContainerNotFound, containerName)
+	}
+	if report.Error != nil && report.Error.Message != "" {
+		return nil, fmt.Errorf("Failed to read the stats of '%s': %s", containerName, report.Error.Message)
+	}
+	if len(report.Stats) == 0 {
+		return nil, NewError(ErrContainerNotFound, containerName, "No stats for container '%s'", containerName)
+	}
+	s := report.Stats[0]
+	return &ContainerStats{
+		Name:        containerName,
+		Running:     true,
+		CPUPercent:  s.CPU,
+		MemoryUsage: s.MemUsage,
+		MemoryLimit: s.MemLimit,
+		NetworkRx:   s.NetInput,
+		NetworkTx:   s.NetOutput,
+		BlockRead:   s.BlockInput,
+		BlockWrite:  s.BlockOutput,
+		PIDs:        s.PIDs,
+	}, nil
+}
+
+func (r *PodmanRuntime) ListContainers(ctx context.Context) ([]*ContainerInfo, error) {
+	var summaries []struct {
+		ID string `json:"Id"`
+	}
+	query := url.Values{"all": {"true"}}
+	if err := r.client.doJSON(ctx, http.MethodGet, "/containers/json", query, nil, &summaries); err != nil {
+		return nil, err
+	}
+	var infos []*ContainerInfo
+	for _, s := range summaries {
+		info, err := r.InspectContainer(ctx, s.ID)
+		if errors.Is(err, ErrContainerNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (r *PodmanRuntime) NetworkExists(ctx context.Context, name string) bool {
+	return r.client.doJSON(ctx, http.MethodGet, "/networks/"+name+"/exists", nil, nil, nil) == nil
+}
+
+func (r *PodmanRuntime) CreateNetwork(ctx context.Context, opts *NetworkOptions) error {
+	req := podmanNetworkRequest{Name: opts.Name, Driver: opts.Driver, NetworkInterface: opts.Parent}
+	if opts.Subnet != "" {
+		req.Subnets = []podmanSubnet{{Subnet: opts.Subnet, Gateway: opts.Gateway}}
+	}
+	if err := r.client.doJSON(ctx, http.MethodPost, "/networks/create", nil, req, nil); err != nil {
+		return fmt.Errorf("Failed to create network '%s': %w", opts.Name, err)
+	}
+	return nil
+}
+
+func (r *PodmanRuntime) Exists(ctx context.Context, containerName string) bool {
+	return r.client.doJSON(ctx, http.MethodGet, "/containers/"+containerName+"/exists", nil, nil, nil) == nil
+}
+
+func (r *PodmanRuntime) IsRunning(ctx context.Context, containerName string) bool {
+	info, err := r.InspectContainer(ctx, containerName)
+	if err != nil {
+		return false
+	}
+	return info.Running
+}
+
+func (r *PodmanRuntime) Events(ctx context.Context, containers []string) (<-chan Event, <-chan error) {
+	return r.client.events(ctx, containers)
+}
+
+func (r *PodmanRuntime) PruneImages(ctx context.Context) (string, error) {
+	var reports []struct {
+		ID   string `json:"Id"`
+		Err  string `json:"Err"`
+		Size int64  `json:"Size"`
+	}
+	if err := r.client.doJSON(ctx, http.MethodPost, "/images/prune", nil, nil, &reports); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	var reclaimed int64
+	for _, report := range reports {
+		if report.Err != "" {
+			out.WriteString(fmt.Sprintf("error: %s: %s\n", report.ID, report.Err))
+			continue
+		}
+		out.WriteString(report.ID + "\n")
+		reclaimed += report.Size
+	}
+	out.WriteString(fmt.Sprintf("Total reclaimed space: %s\n", formatBytes(reclaimed)))
+	return out.String(), nil
+}
+
+func (r *PodmanRuntime) IsAuthenticated(ctx context.Context) (bool, string, error) {
+	user, _, ok := lookupCredentials(PodmanAuthPath(), dockerHubRegistry)
+	return ok, user, nil
+}
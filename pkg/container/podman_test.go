@@ -0,0 +1,456 @@
+package container
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// standInLibpod is a tiny in-process imitation of the libpod REST API
+type standInLibpod struct {
+	mu         sync.Mutex
+	containers map[string]*standInContainer
+	images     map[string]bool
+	lastCreate podmanSpec
+	lastBuild  *http.Request
+	buildFiles []string
+	buildError string
+	startError string
+}
+
+func startStandInLibpod(t *testing.T) (*standInLibpod, string) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "podman.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	libpod := &standInLibpod{
+		containers: make(map[string]*standInContainer),
+		images:     map[string]bool{"docker.io/redroid/redroid:13.0.0-latest": true},
+	}
+	server := &http.Server{Handler: libpod}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return libpod, socket
+}
+
+func (p *standInLibpod) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Everything lives under the versioned libpod prefix
+	path, ok := strings.CutPrefix(req.URL.Path, libpodAPIPrefix)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	switch {
+	case path == "/_ping":
+		w.Write([]byte("OK"))
+
+	case path == "/containers/create" && req.Method == http.MethodPost:
+		var spec podmanSpec
+		json.NewDecoder(req.Body).Decode(&spec)
+		if !p.images[spec.Image] {
+			writeLibpodError(w, http.StatusNotFound, spec.Image+": image not known")
+			return
+		}
+		if _, exists := p.containers[spec.Name]; exists {
+			writeLibpodError(w, http.StatusConflict, "the container name \""+spec.Name+"\" is already in use")
+			return
+		}
+		p.lastCreate = spec
+		p.containers[spec.Name] = &standInContainer{name: spec.Name, image: spec.Image, labels: spec.Labels}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"Id": spec.Name})
+
+	case path == "/containers/json":
+		var summaries []map[string]string
+		for name := range p.containers {
+			summaries = append(summaries, map[string]string{"Id": name})
+		}
+		json.NewEncoder(w).Encode(summaries)
+
+	case path == "/containers/stats":
+		name := req.URL.Query().Get("containers")
+		if _, ok := p.containers[name]; !ok {
+			writeLibpodError(w, http.StatusNotFound, "unable to look up container "+name+": no such container")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Error": nil,
+			"Stats": []map[string]interface{}{{
+				"CPU": 12.5, "MemUsage": 512 << 20, "MemLimit": 2 << 30,
+				"NetInput": 100, "NetOutput": 200, "BlockInput": 300, "BlockOutput": 400, "PIDs": 42,
+			}},
+		})
+
+	case path == "/build" && req.Method == http.MethodPost:
+		p.lastBuild = req
+		reader := tar.NewReader(req.Body)
+		for {
+			header, err := reader.Next()
+			if err != nil {
+				break
+			}
+			p.buildFiles = append(p.buildFiles, header.Name)
+		}
+		if p.buildError != "" {
+			json.NewEncoder(w).Encode(map[string]string{"stream": "STEP 1/2: FROM redroid\n"})
+			json.NewEncoder(w).Encode(map[string]string{"error": p.buildError})
+			return
+		}
+		p.images[req.URL.Query().Get("t")] = true
+		json.NewEncoder(w).Encode(map[string]string{"stream": "COMMIT " + req.URL.Query().Get("t") + "\n"})
+
+	case strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/exists"):
+		if !p.images[strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/exists")] {
+			writeLibpodError(w, http.StatusNotFound, "failed to find image")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case strings.HasPrefix(path, "/containers/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/containers/"), "/")
+		c, ok := p.containers[parts[0]]
+		if !ok {
+			writeLibpodError(w, http.StatusNotFound, "no container with name or ID \""+parts[0]+"\" found: no such container")
+			return
+		}
+		action := ""
+		if len(parts) > 1 {
+			action = parts[1]
+		}
+		switch {
+		case action == "json":
+			status := "exited"
+			if c.running {
+				status = "running"
+			}
+			// libpod puts the image ID in Image and the reference in
+			// ImageName, and names containers without a leading slash
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"Id":        c.name,
+				"Name":      c.name,
+				"Image":     "0f3c9a6e5d1b",
+				"ImageName": c.image,
+				"Config":    map[string]interface{}{"Image": "0f3c9a6e5d1b", "Labels": c.labels},
+				"State":     map[string]interface{}{"Status": status, "Running": c.running},
+			})
+		case action == "exists":
+			w.WriteHeader(http.StatusNoContent)
+		case action == "start":
+			if p.startError != "" {
+				writeLibpodError(w, http.StatusInternalServerError, p.startError)
+				return
+			}
+			if c.running {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			c.running = true
+			w.WriteHeader(http.StatusNoContent)
+		case action == "stop":
+			if !c.running {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			c.running = false
+			w.WriteHeader(http.StatusNoContent)
+		case action == "" && req.Method == http.MethodDelete:
+			if c.running && req.URL.Query().Get("force") != "true" {
+				writeLibpodError(w, http.StatusConflict, "cannot remove container "+c.name+" as it is running")
+				return
+			}
+			delete(p.containers, c.name)
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode([]map[string]string{{"Id": c.name}})
+		default:
+			http.NotFound(w, req)
+		}
+
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// writeLibpodError answers like libpod, which adds a cause to the message
+func writeLibpodError(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"cause": "no such container", "message": message, "response": code})
+}
+
+func TestPodmanRuntimeLifecycle(t *testing.T) {
+	ctx := context.Background()
+	libpod, socket := startStandInLibpod(t)
+	rt := NewPodmanRuntime(socket)
+
+	if !rt.IsInstalled(ctx) {
+		t.Fatal("expected the stand-in service to answer the ping")
+	}
+	opts := &RunOptions{
+		Name:       "android",
+		Hostname:   "android",
+		Image:      "docker.io/redroid/redroid:13.0.0-latest",
+		Privileged: true,
+		Volumes:    []VolumeMount{{Source: "/srv/android", Target: "/data", Options: "z"}},
+		Ports:      []PortMapping{{HostPort: 5555, ContainerPort: 5555}},
+		Env:        []string{"TZ=UTC"},
+		Labels:     map[string]string{LabelManaged: "true", LabelName: "android"},
+		Memory:     "2g",
+		CPUs:       "1.5",
+		Args:       []string{"androidboot.redroid_width=720"},
+	}
+	if err := rt.Run(ctx, opts); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	spec := libpod.lastCreate
+	if !spec.Privileged || spec.Hostname != "android" || spec.Env["TZ"] != "UTC" {
+		t.Errorf("unexpected spec: %+v", spec)
+	}
+	if len(spec.Mounts) != 1 || spec.Mounts[0].Type != "bind" || strings.Join(spec.Mounts[0].Options, ",") != "rbind,z" {
+		t.Errorf("mounts = %+v, want one rbind,z bind mount", spec.Mounts)
+	}
+	if len(spec.PortMappings) != 1 || spec.PortMappings[0].HostPort != 5555 || spec.PortMappings[0].Protocol != "tcp" {
+		t.Errorf("port mappings = %+v", spec.PortMappings)
+	}
+	if spec.Resources == nil || spec.Resources.Memory.Limit != 2<<30 || spec.Resources.CPU.Quota != 150000 {
+		t.Errorf("resource limits = %+v", spec.Resources)
+	}
+	if spec.Labels[LabelManaged] != "true" || len(spec.Command) != 1 {
+		t.Errorf("labels %v or command %v were not passed", spec.Labels, spec.Command)
+	}
+
+	info, err := rt.InspectContainer(ctx, "android")
+	if err != nil {
+		t.Fatalf("InspectContainer: %v", err)
+	}
+	if info.Name != "android" || !info.Running || !info.Managed() {
+		t.Errorf("unexpected inspect result: %+v", info)
+	}
+	if info.Image != opts.Image {
+		t.Errorf("Image = %q, want the ImageName reference %q", info.Image, opts.Image)
+	}
+
+	stats, err := rt.Stats(ctx, "android")
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.CPUPercent != 12.5 || stats.MemoryUsage != 512<<20 || stats.PIDs != 42 || stats.BlockWrite != 400 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	infos, err := rt.ListContainers(ctx)
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("ListContainers = %v, %v", infos, err)
+	}
+
+	if err := rt.Stop(ctx, "android"); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if rt.IsRunning(ctx, "android") {
+		t.Error("container should be stopped")
+	}
+	if err := rt.Remove(ctx, "android", false); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if rt.Exists(ctx, "android") {
+		t.Error("container should be gone")
+	}
+}
+
+func TestPodmanRuntimeErrors(t *testing.T) {
+	ctx := context.Background()
+	_, socket := startStandInLibpod(t)
+	rt := NewPodmanRuntime(socket)
+
+	_, err := rt.InspectContainer(ctx, "missing")
+	if !errors.Is(err, ErrContainerNotFound) {
+		t.Fatalf("InspectContainer of a missing container = %v, want ErrContainerNotFound", err)
+	}
+	if !strings.Contains(err.Error(), "no such container") {
+		t.Errorf("expected the libpod message in the error, got %q", err.Error())
+	}
+	for name, op := range map[string]func() error{
+		"Stop":   func() error { return rt.Stop(ctx, "missing") },
+		"Start":  func() error { return rt.StartExisting(ctx, "missing") },
+		"Remove": func() error { return rt.Remove(ctx, "missing", true) },
+		"Stats":  func() error { _, err := rt.Stats(ctx, "missing"); return err },
+	} {
+		if err := op(); !errors.Is(err, ErrContainerNotFound) {
+			t.Errorf("%s of a missing container = %v, want ErrContainerNotFound", name, err)
+		}
+	}
+
+	err = rt.Run(ctx, &RunOptions{Name: "android", Image: "docker.io/redroid/redroid:99"})
+	if !errors.Is(err, ErrImageMissing) {
+		t.Errorf("Run with an unknown image = %v, want ErrImageMissing", err)
+	}
+
+	opts := &RunOptions{Name: "dup", Image: "docker.io/redroid/redroid:13.0.0-latest"}
+	if err := rt.Run(ctx, opts); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	err = rt.Run(ctx, opts)
+	if !isStatus(err, http.StatusConflict) || errors.Is(err, ErrContainerNotFound) || errors.Is(err, ErrImageMissing) {
+		t.Errorf("duplicate Run = %v, want a plain 409 APIError", err)
+	}
+	if err := rt.Remove(ctx, "dup", false); !isStatus(err, http.StatusConflict) {
+		t.Errorf("Remove of a running container = %v, want a 409 APIError", err)
+	}
+}
+
+func TestPodmanRuntimeRunRemovesUnstartedContainer(t *testing.T) {
+	ctx := context.Background()
+	libpod, socket := startStandInLibpod(t)
+	libpod.startError = "rootlessport listen tcp 0.0.0.0:5555: bind: address already in use"
+	rt := NewPodmanRuntime(socket)
+
+	err := rt.Run(ctx, &RunOptions{Name: "android", Image: "docker.io/redroid/redroid:13.0.0-latest"})
+	if !isStatus(err, http.StatusInternalServerError) || !strings.Contains(err.Error(), "address already in use") {
+		t.Fatalf("Run = %v, want the start error", err)
+	}
+	if rt.Exists(ctx, "android") {
+		t.Error("the container that failed to start should be removed")
+	}
+}
+
+func TestPodmanRuntimeUnavailable(t *testing.T) {
+	ctx := context.Background()
+	rt := NewPodmanRuntime(filepath.Join(t.TempDir(), "absent.sock"))
+	if rt.IsInstalled(ctx) {
+		t.Fatal("expected a missing socket to report not installed")
+	}
+	_, err := rt.InspectContainer(ctx, "android")
+	if !errors.Is(err, ErrRuntimeUnavailable) || errors.Is(err, ErrContainerNotFound) {
+		t.Fatalf("err = %v, want ErrRuntimeUnavailable", err)
+	}
+}
+
+func TestPodmanRuntimeBuild(t *testing.T) {
+	ctx := context.Background()
+	libpod, socket := startStandInLibpod(t)
+	rt := NewPodmanRuntime(socket)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM redroid/redroid:13.0.0-latest\n"), 0644)
+	if err := rt.Build(ctx, dir, "reddock/custom:latest"); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	// libpod builds natively: no buildx, the context goes up as a tar
+	query := libpod.lastBuild.URL.Query()
+	if query.Get("t") != "reddock/custom:latest" || query.Get("dockerfile") != "Dockerfile" {
+		t.Errorf("build query = %v", query)
+	}
+	if ct := libpod.lastBuild.Header.Get("Content-Type"); ct != "application/x-tar" {
+		t.Errorf("Content-Type = %q, want application/x-tar", ct)
+	}
+	if strings.Join(libpod.buildFiles, ",") != "Dockerfile" {
+		t.Errorf("build context = %v, want the Dockerfile", libpod.buildFiles)
+	}
+	if !rt.ImageExists(ctx, "reddock/custom:latest") {
+		t.Error("built image should exist")
+	}
+
+	libpod.buildError = "no such image: redroid/redroid:13.0.0-latest"
+	err := rt.Build(ctx, dir, "reddock/broken:latest")
+	if err == nil || !strings.Contains(err.Error(), "no such image") {
+		t.Fatalf("Build = %v, want the build error", err)
+	}
+}
+
+func TestPodmanCLIBuildSkipsBuildx(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	for _, binary := range []string{"podman", "docker"} {
+		path := filepath.Join(dir, binary)
+		script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\n"
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+
+	tests := map[string]string{
+		"podman": "build -t reddock/custom:latest ctx",
+		"docker": "buildx build --load -t reddock/custom:latest ctx",
+	}
+	for binary, want := range tests {
+		rt := &GenericRuntime{binary: binary}
+		if err := rt.Build(ctx, "ctx", "reddock/custom:latest"); err != nil {
+			t.Fatalf("%s Build: %v", binary, err)
+		}
+		got, _ := os.ReadFile(argsFile)
+		if strings.TrimSpace(string(got)) != want {
+			t.Errorf("%s build args = %q, want %q", binary, strings.TrimSpace(string(got)), want)
+		}
+	}
+}
+
+func TestPodmanSocketPath(t *testing.T) {
+	t.Setenv("CONTAINER_HOST", "unix:///srv/podman/api.sock")
+	if got := PodmanSocketPath(); got != "/srv/podman/api.sock" {
+		t.Errorf("PodmanSocketPath with CONTAINER_HOST = %q", got)
+	}
+
+	// Remote hosts are not a local socket
+	t.Setenv("CONTAINER_HOST", "ssh://core@lab/run/podman/podman.sock")
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1234")
+	want := "/run/user/1234/podman/podman.sock"
+	if os.Getuid() == 0 {
+		want = DefaultPodmanSocket
+	}
+	if got := PodmanSocketPath(); got != want {
+		t.Errorf("PodmanSocketPath = %q, want %q", got, want)
+	}
+}
+
+func TestRootCheckOnlyRelaxedForRootlessPodman(t *testing.T) {
+	if err := checkRootless(&GenericRuntime{binary: "docker"}); err == nil {
+		t.Error("docker should need root")
+	}
+	if err := checkRootless(NewEngineRuntime(DefaultDockerSocket)); err == nil {
+		t.Error("the Engine API backend should need root")
+	}
+	if err := checkRootless(NewNerdctlRuntime("/run/containerd/containerd.sock", "default")); err == nil {
+		t.Error("nerdctl should need root")
+	}
+	if err := checkRootless(&PodmanRuntime{rootless: false}); err == nil {
+		t.Error("the rootful podman service should need root")
+	}
+	if !RootlessSupported() {
+		t.Skip("this host has no rootless podman")
+	}
+	if err := checkRootless(&PodmanRuntime{rootless: true}); err != nil {
+		t.Errorf("rootless podman should not need root: %v", err)
+	}
+}
+
+func TestRootlessBinderDevices(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"binder", "hwbinder"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0666)
+	}
+	err := checkBinderDevices(dir)
+	if !errors.Is(err, ErrBinderMissing) || !strings.Contains(err.Error(), "vndbinder") {
+		t.Fatalf("err = %v, want ErrBinderMissing naming vndbinder", err)
+	}
+	os.WriteFile(filepath.Join(dir, "vndbinder"), nil, 0666)
+	if err := checkBinderDevices(dir); err != nil {
+		t.Fatalf("checkBinderDevices: %v", err)
+	}
+}
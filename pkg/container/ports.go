@@ -0,0 +1,103 @@
+package container
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"reddock/pkg/config"
+)
+
+var portAvailable = func(port int) bool {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+func portOwner(cfg *config.Config, host string, port int, except string) string {
+	var owners []string
+	for name, c := range cfg.Containers {
+		if name != except && c.Host == host && (c.ADBHostPort() == port || publishes(c, port)) {
+			owners = append(owners, name)
+		}
+	}
+	if len(owners) == 0 {
+		return ""
+	}
+	sort.Strings(owners)
+	return owners[0]
+}
+
+func publishes(c *config.Container, port int) bool {
+	if !c.PublishesPorts() {
+		return false
+	}
+	for _, p := range c.PublishedPorts() {
+		if p.HostPort == port {
+			return true
+		}
+	}
+	return false
+}
+
+// AllocatePort picks the first free port of the configured range on host
+func AllocatePort(cfg *config.Config, host string) (int, error) {
+	first, last := cfg.ADBPortRange()
+	remote := (&config.Container{Host: host}).IsRemote()
+	for port := first; port <= last; port++ {
+		if portOwner(cfg, host, port, "") != "" {
+			continue
+		}
+		if !remote && !portAvailable(port) {
+			continue
+		}
+		return port, nil
+	}
+	return 0, fmt.Errorf("No free ADB port in %d-%d, widen \"adb_ports\" in %s", first, last, config.GetConfigPath())
+}
+
+// mappedADBAddress prefers the port the engine published over the configured one
+func mappedADBAddress(c *config.Container, info *ContainerInfo) string {
+	if c.NetworkMode() == config.NetworkMacvlan && info != nil && info.IPAddress != "" {
+		return net.JoinHostPort(info.IPAddress, strconv.Itoa(config.DefaultADBPort))
+	}
+	if info != nil && c.PublishesPorts() {
+		if port := info.HostPort(config.DefaultADBPort); port != 0 {
+			return net.JoinHostPort(ContainerHost(c.Host), strconv.Itoa(port))
+		}
+	}
+	return ADBAddress(c)
+}
+
+func checkPortConflict(cfg *config.Config, c *config.Container) error {
+	if c.PublishesPorts() {
+		for _, p := range c.PublishedPorts() {
+			if owner := portOwner(cfg, c.Host, p.HostPort, c.Name); owner != "" {
+				return NewError(ErrPortInUse, c.Name,
+					"Published port %d of '%s' is also used by '%s'", p.HostPort, c.Name, owner)
+			}
+			if !c.IsRemote() && !portAvailable(p.HostPort) {
+				return NewError(ErrPortInUse, c.Name,
+					"Published port %d of '%s' is in use by another process", p.HostPort, c.Name)
+			}
+		}
+	}
+
+	port := c.ADBHostPort()
+	if port == 0 {
+		return nil
+	}
+	if owner := portOwner(cfg, c.Host, port, c.Name); owner != "" {
+		return NewError(ErrPortInUse, c.Name,
+			"ADB port %d of '%s' is also assigned to '%s'. Pick another with 'reddock port %s <port>'", port, c.Name, owner, c.Name)
+	}
+	if !c.IsRemote() && !portAvailable(port) {
+		return NewError(ErrPortInUse, c.Name,
+			"ADB port %d of '%s' is in use by another process. Pick another with 'reddock port %s <port>'", port, c.Name, c.Name)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"reddock/pkg/config"
+)
+
+func TestStartFailsOnPortConflict(t *testing.T) {
+	tests := []struct {
+		name   string
+		other  bool
+		listen bool
+	}{
+		{"assigned to another container", true, false},
+		{"taken by another process", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubHost(t)
+			portAvailable = func(port int) bool { return !tt.listen }
+			containers := []*config.Container{testContainer(t, "android")}
+			if tt.other {
+				containers = append(containers, testContainer(t, "other"))
+			}
+			rt := newFakeRuntime()
+
+			err := NewManagerWith(newMemStore(containers...), rt, "android").Start(context.Background(), false)
+			if !errors.Is(err, ErrPortInUse) {
+				t.Fatalf("Start error = %v, want ErrPortInUse", err)
+			}
+			if rt.called("Run") {
+				t.Fatalf("container started despite the conflict, calls = %v", rt.calls)
+			}
+		})
+	}
+}
+
+func TestConnectAddressUsesMappedPort(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	c := testContainer(t, "android")
+	c.Port = 5557
+	m := NewManagerWith(newMemStore(c), rt, "android")
+
+	if got := m.ConnectAddress(context.Background()); got != "localhost:5557" {
+		t.Fatalf("stopped address = %s, want the configured port", got)
+	}
+	rt.containers["android"] = &fakeContainer{running: true,
+		ports: []PortMapping{{HostPort: 32768, ContainerPort: config.DefaultADBPort}}}
+	if got := m.ConnectAddress(context.Background()); got != "localhost:32768" {
+		t.Fatalf("running address = %s, want the published port", got)
+	}
+}
+
+func TestSetPort(t *testing.T) {
+	stubHost(t)
+	a := testContainer(t, "a")
+	b := testContainer(t, "b")
+	b.Port = 5556
+	store := newMemStore(a, b)
+	m := NewManagerWith(store, newFakeRuntime(), "a")
+
+	if err := m.SetPort(context.Background(), 5556); !errors.Is(err, ErrPortInUse) {
+		t.Fatalf("SetPort to b's port = %v, want ErrPortInUse", err)
+	}
+	if err := m.SetPort(context.Background(), 70000); err == nil {
+		t.Fatal("SetPort accepted an out of range port")
+	}
+	portAvailable = func(port int) bool { return port != 5560 }
+	if err := m.SetPort(context.Background(), 5560); !errors.Is(err, ErrPortInUse) {
+		t.Fatalf("SetPort to a listened port = %v, want ErrPortInUse", err)
+	}
+
+	if err := m.SetPort(context.Background(), 5570); err != nil {
+		t.Fatalf("SetPort: %v", err)
+	}
+	if got := store.cfg.GetContainer("a").Port; got != 5570 {
+		t.Fatalf("port = %d, want 5570", got)
+	}
+}
+
+func TestContainerInfoPorts(t *testing.T) {
+	var c containerJSON
+	doc := `{"Name":"/android","State":{"Running":true},"NetworkSettings":{"Ports":{
+		"5555/tcp":[{"HostIp":"0.0.0.0","HostPort":"5600"}],"8080/udp":[{"HostPort":"9000"}],"9999/tcp":null}}}`
+	if err := json.Unmarshal([]byte(doc), &c); err != nil {
+		t.Fatal(err)
+	}
+	info := c.info()
+	if got := info.HostPort(config.DefaultADBPort); got != 5600 {
+		t.Fatalf("HostPort(5555) = %d, want 5600", got)
+	}
+	if got := info.HostPort(8080); got != 0 {
+		t.Fatalf("HostPort(8080) = %d, want 0 for a udp port", got)
+	}
+}
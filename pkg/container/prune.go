@@ -1,6 +1,7 @@
 package container
 
 import (
+	"context"
 	"fmt"
 	"reddock/pkg/ui"
 )
@@ -10,22 +11,27 @@ type Pruner struct {
 }
 
 func NewPruner() *Pruner {
+	return NewPrunerWith(NewRuntime())
+}
+
+func NewPrunerWith(runtime Runtime) *Pruner {
 	return &Pruner{
-		runtime: NewRuntime(),
+		runtime: runtime,
 	}
 }
 
-func (p *Pruner) Prune() error {
-	if err := CheckRoot(); err != nil {
+func (p *Pruner) Prune(ctx context.Context) error {
+	if err := requireRoot(); err != nil {
 		return err
 	}
 
 	msg := fmt.Sprintf("Pruning unused images using %s...", p.runtime.Name())
 	s := ui.NewSpinner(msg)
 	s.Start()
-	output, err := p.runtime.PruneImages()
+	output, err := p.runtime.PruneImages(ctx)
 	if err != nil {
-		return fmt.Errorf("Failed to prune images: %v", err)
+		s.Finish("Failed to prune images")
+		return fmt.Errorf("Failed to prune images: %w", err)
 	}
 	s.Finish("Unused images have been pruned successfully")
 
@@ -1,6 +1,7 @@
 package container
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reddock/pkg/config"
@@ -8,35 +9,53 @@ import (
 )
 
 type Remover struct {
+	store         config.Store
 	config        *config.Config
 	containerName string
 	runtime       Runtime
+	// noPrompt skips the image question for unattended removals
+	noPrompt bool
 }
 
 func NewRemover(containerName string) *Remover {
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Printf("Warning: Failed to load config: %v\n", err)
-		cfg = config.GetDefault()
+	return NewRemoverWith(config.NewFileStore(), nil, containerName)
+}
+
+func NewRemoverWith(store config.Store, runtime Runtime, containerName string) *Remover {
+	cfg := config.LoadOrDefault(store)
+	if runtime == nil {
+		runtime = NewRuntimeForContainer(cfg, cfg.GetContainer(containerName))
 	}
 	return &Remover{
+		store:         store,
 		config:        cfg,
 		containerName: containerName,
-		runtime:       NewRuntime(),
+		runtime:       runtime,
 	}
 }
 
-func (r *Remover) Remove(removeImage bool) error {
-	if err := CheckRoot(); err != nil {
+// WithoutPrompt keeps the image instead of asking on stdin
+func (r *Remover) WithoutPrompt() *Remover {
+	r.noPrompt = true
+	return r
+}
+
+func (r *Remover) Remove(ctx context.Context, removeImage bool) error {
+	if err := requireRoot(); err != nil {
 		return err
 	}
 
 	container := r.config.GetContainer(r.containerName)
 	if container == nil {
-		return fmt.Errorf("Container '%s' not found", r.containerName)
+		return NewError(ErrContainerNotFound, r.containerName, "Container '%s' not found", r.containerName)
 	}
+	lock, err := lockContainer(container.Name, "remove")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 
-	if !removeImage {
+	if !removeImage && !r.noPrompt {
 		fmt.Print("\nDo you want to also remove the Docker image? [y/N]: ")
 		var response string
 		fmt.Scanln(&response)
@@ -52,18 +71,36 @@ func (r *Remover) Remove(removeImage bool) error {
 		{
 			name: fmt.Sprintf("Stopping and removing container '%s'", container.Name),
 			fn: func() error {
-				if r.runtime.IsRunning(container.Name) {
-					r.runtime.Stop(container.Name)
+				ctx, cancel := WithTimeout(ctx, r.config, config.OpRemove)
+				defer cancel()
+				if r.runtime.IsRunning(ctx, container.Name) {
+					r.runtime.Stop(ctx, container.Name)
 				}
-				if err := r.runtime.Remove(container.Name, true); err != nil {
+				if err := r.runtime.Remove(ctx, container.Name, true); err != nil {
 					fmt.Printf("\nWarning: Failed to remove container: %v\n", err)
 				}
 				return nil
 			},
 		},
+		{
+			name: fmt.Sprintf("Releasing binder devices of '%s'", container.Name),
+			fn: func() error {
+				if container.IsRemote() {
+					return nil
+				}
+				if err := removeBinderfs(BinderfsPath(container.Name)); err != nil {
+					fmt.Printf("\nWarning: %v\n", err)
+				}
+				return nil
+			},
+		},
 		{
 			name: fmt.Sprintf("Removing data directory: %s", container.GetDataPath()),
 			fn: func() error {
+				if container.IsRemote() {
+					fmt.Printf("\nNote: %s is on %s, remove it there\n", container.GetDataPath(), container.Host)
+					return nil
+				}
 				if err := os.RemoveAll(container.GetDataPath()); err != nil {
 					fmt.Printf("\nWarning: Could not remove data directory: %v\n", err)
 				}
@@ -79,7 +116,7 @@ func (r *Remover) Remove(removeImage bool) error {
 		}{
 			name: fmt.Sprintf("Removing Docker image: %s", container.ImageURL),
 			fn: func() error {
-				if err := r.runtime.RemoveImage(container.ImageURL); err != nil {
+				if err := r.runtime.RemoveImage(ctx, container.ImageURL); err != nil {
 					fmt.Printf("\nWarning: Could not remove image: %v\n", err)
 					fmt.Printf("The image might be in use by other containers or already removed.\n")
 				} else {
@@ -97,7 +134,7 @@ func (r *Remover) Remove(removeImage bool) error {
 		name: "Updating configuration",
 		fn: func() error {
 			r.config.RemoveContainer(container.Name)
-			if err := config.Save(r.config); err != nil {
+			if err := r.store.Save(r.config); err != nil {
 				return fmt.Errorf("Failed to save config: %v", err)
 			}
 			return nil
@@ -108,8 +145,13 @@ func (r *Remover) Remove(removeImage bool) error {
 	bar.Start()
 
 	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			fmt.Println()
+			return ContextError(ctx, err)
+		}
 		bar.SetMessage(step.name)
 		if err := step.fn(); err != nil {
+			fmt.Println()
 			return err
 		}
 		bar.Increment()
@@ -0,0 +1,76 @@
+package container
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestRemoveDeletesEverything(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	c := testContainer(t, "android")
+	rt.containers["android"] = &fakeContainer{running: true}
+	rt.images[c.ImageURL] = true
+	store := newMemStore(c)
+
+	if err := NewRemoverWith(store, rt, "android").Remove(context.Background(), true); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if rt.Exists(context.Background(), "android") {
+		t.Error("container should be removed")
+	}
+	if rt.ImageExists(context.Background(), c.ImageURL) {
+		t.Error("image should be removed")
+	}
+	if _, err := os.Stat(c.DataPath); !os.IsNotExist(err) {
+		t.Error("data directory should be removed")
+	}
+	if store.cfg.GetContainer("android") != nil {
+		t.Error("config entry should be removed")
+	}
+}
+
+func TestRemoveReleasesBinderfs(t *testing.T) {
+	stubHost(t)
+	var released string
+	removeBinderfs = func(dir string) error {
+		released = dir
+		return nil
+	}
+	store := newMemStore(testContainer(t, "android"))
+
+	if err := NewRemoverWith(store, newFakeRuntime(), "android").Remove(context.Background(), true); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if released != BinderfsPath("android") {
+		t.Fatalf("released %q, want %q", released, BinderfsPath("android"))
+	}
+}
+
+func TestRemoveUnknownContainer(t *testing.T) {
+	stubHost(t)
+	if err := NewRemoverWith(newMemStore(), newFakeRuntime(), "missing").Remove(context.Background(), true); err == nil {
+		t.Fatal("expected error for unknown container")
+	}
+}
+
+func TestRemoveStoppedContainerKeepsImage(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	c := testContainer(t, "android")
+	rt.images[c.ImageURL] = true
+	store := newMemStore(c)
+
+	// No container exists in the runtime; removal still cleans up config
+	remover := NewRemoverWith(store, rt, "android")
+	if err := remover.Remove(context.Background(), false); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if !rt.ImageExists(context.Background(), c.ImageURL) {
+		t.Error("image should be kept")
+	}
+	if store.cfg.GetContainer("android") != nil {
+		t.Error("config entry should be removed")
+	}
+}
@@ -0,0 +1,132 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"reddock/pkg/config"
+)
+
+type Renamer struct {
+	store   config.Store
+	runtime Runtime
+}
+
+func NewRenamer() *Renamer {
+	return NewRenamerWith(config.NewFileStore(), nil)
+}
+
+func NewRenamerWith(store config.Store, runtime Runtime) *Renamer {
+	return &Renamer{store: store, runtime: runtime}
+}
+
+// Rename renames a stopped container, moving its data directory with moveData
+func (r *Renamer) Rename(ctx context.Context, oldName, newName string, moveData bool) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	if err := config.ValidateContainerName(newName); err != nil {
+		return err
+	}
+	if oldName == newName {
+		return fmt.Errorf("Container '%s' already has that name", oldName)
+	}
+
+	lock, err := lockContainer(oldName, "rename")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	newLock, err := lockContainer(newName, "rename")
+	if err != nil {
+		return err
+	}
+	defer newLock.Unlock()
+
+	// Load under the locks, so no other operation saves meanwhile
+	cfg := config.LoadOrDefault(r.store)
+	container := cfg.GetContainer(oldName)
+	if container == nil {
+		return notFoundError(oldName)
+	}
+	if cfg.GetContainer(newName) != nil {
+		return fmt.Errorf("Container '%s' already exists", newName)
+	}
+	runtime := r.runtime
+	if runtime == nil {
+		runtime = NewRuntimeForContainer(cfg, container)
+	}
+	if runtime.Exists(ctx, newName) {
+		return fmt.Errorf("A %s container named '%s' already exists, remove it or pick another name", runtime.Name(), newName)
+	}
+	if runtime.IsRunning(ctx, oldName) {
+		return fmt.Errorf("Container '%s' is running, stop it first with 'reddock stop %s'", oldName, oldName)
+	}
+	if moveData && container.IsRemote() {
+		return fmt.Errorf("Container '%s' runs on %s, move its data there", oldName, container.Host)
+	}
+
+	// Undo the steps done so far when a later one fails
+	var undo []func()
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+
+	oldPath := container.GetDataPath()
+	dataPath := oldPath
+	if moveData {
+		dataPath = filepath.Join(filepath.Dir(oldPath), "data-"+newName)
+		if _, err := os.Stat(dataPath); err == nil {
+			return fmt.Errorf("Data directory %s already exists", dataPath)
+		}
+		if _, err := os.Stat(oldPath); err == nil {
+			if err := os.Rename(oldPath, dataPath); err != nil {
+				return fmt.Errorf("Failed to move data directory: %v", err)
+			}
+			undo = append(undo, func() { os.Rename(dataPath, oldPath) })
+		}
+	}
+
+	existed := runtime.Exists(ctx, oldName)
+	if existed {
+		if err := runtime.Rename(ctx, oldName, newName); err != nil {
+			rollback()
+			return fmt.Errorf("Failed to rename container '%s': %w", oldName, err)
+		}
+		undo = append(undo, func() { runtime.Rename(context.WithoutCancel(ctx), newName, oldName) })
+	}
+
+	cfg.RemoveContainer(oldName)
+	container.Name = newName
+	container.LogFile = newName + ".log"
+	container.DataPath = dataPath
+	cfg.AddContainer(container)
+	if err := r.store.Save(cfg); err != nil {
+		rollback()
+		return fmt.Errorf("Failed to save config: %v", err)
+	}
+
+	// The binderfs instance is set up again under the new name on start
+	if !container.IsRemote() {
+		if err := removeBinderfs(BinderfsPath(oldName)); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	fmt.Printf("Container '%s' renamed to '%s'\n", oldName, newName)
+	if dataPath != oldPath {
+		fmt.Printf("Data moved to %s\n", dataPath)
+	}
+	if existed {
+		fmt.Printf("Its next start recreates it with the hostname '%s', /data is kept\n", newName)
+	}
+	if _, err := os.Stat(filepath.Join(SystemdUnitDir, ContainerUnitName(oldName))); err == nil {
+		fmt.Printf("Warning: %s still starts '%s', regenerate it with 'reddock systemd generate %s --install'\n",
+			ContainerUnitName(oldName), oldName, newName)
+	}
+	return nil
+}
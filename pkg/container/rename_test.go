@@ -0,0 +1,167 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRenameMovesConfigContainerAndData(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["pixel"] = &fakeContainer{}
+	c := labelled(t, "pixel", "tier=lab")
+	os.WriteFile(filepath.Join(c.DataPath, "marker"), []byte("data"), 0644)
+	oldPath := c.DataPath
+	store := newMemStore(c)
+
+	if err := NewRenamerWith(store, rt).Rename(context.Background(), "pixel", "pixel-lab", true); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if store.cfg.GetContainer("pixel") != nil {
+		t.Fatal("old config entry kept")
+	}
+	renamed := store.cfg.GetContainer("pixel-lab")
+	if renamed == nil || renamed.Name != "pixel-lab" || renamed.Labels["tier"] != "lab" {
+		t.Fatalf("renamed entry = %+v", renamed)
+	}
+	if _, ok := rt.containers["pixel-lab"]; !ok || !rt.called("Rename pixel pixel-lab") {
+		t.Fatalf("runtime container not renamed, calls = %v", rt.calls)
+	}
+	wantPath := filepath.Join(filepath.Dir(oldPath), "data-pixel-lab")
+	if renamed.DataPath != wantPath {
+		t.Fatalf("data path = %s, want %s", renamed.DataPath, wantPath)
+	}
+	if data, err := os.ReadFile(filepath.Join(wantPath, "marker")); err != nil || string(data) != "data" {
+		t.Fatalf("data not moved: %q, %v", data, err)
+	}
+}
+
+func TestRenameKeepsDataPathByDefault(t *testing.T) {
+	stubHost(t)
+	c := testContainer(t, "pixel")
+	c.DataPath = ""
+	store := newMemStore(c)
+
+	if err := NewRenamerWith(store, newFakeRuntime()).Rename(context.Background(), "pixel", "pixel-lab", false); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	// An unset path followed the name, it must now point at the old data
+	if got := store.cfg.GetContainer("pixel-lab").GetDataPath(); filepath.Base(got) != "data-pixel" {
+		t.Fatalf("data path = %s, want the old data-pixel", got)
+	}
+}
+
+func TestRenameRefusals(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["running"] = &fakeContainer{running: true}
+	store := newMemStore(testContainer(t, "pixel"), testContainer(t, "taken"), testContainer(t, "running"))
+	renamer := NewRenamerWith(store, rt)
+
+	if err := renamer.Rename(context.Background(), "missing", "x", false); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("missing container: %v", err)
+	}
+	for _, tt := range []struct{ old, new string }{
+		{"pixel", "taken"},
+		{"pixel", "bad/name"},
+		{"pixel", "pixel"},
+		{"running", "stopped"},
+	} {
+		if err := renamer.Rename(context.Background(), tt.old, tt.new, false); err == nil {
+			t.Errorf("rename %s to %s accepted", tt.old, tt.new)
+		}
+	}
+	if store.cfg.GetContainer("pixel") == nil || store.cfg.GetContainer("running") == nil {
+		t.Fatal("a refused rename changed the config")
+	}
+}
+
+func TestRenameRefusesBusyContainer(t *testing.T) {
+	stubHost(t)
+	store := newMemStore(testContainer(t, "pixel"))
+
+	lock, err := lockContainer("pixel", "start")
+	if err != nil {
+		t.Fatalf("lockContainer: %v", err)
+	}
+	err = NewRenamerWith(store, newFakeRuntime()).Rename(context.Background(), "pixel", "pixel-lab", false)
+	if !errors.Is(err, ErrBusy) {
+		t.Fatalf("Rename of a busy container = %v, want ErrBusy", err)
+	}
+	lock.Unlock()
+
+	if err := NewRenamerWith(store, newFakeRuntime()).Rename(context.Background(), "pixel", "pixel-lab", false); err != nil {
+		t.Fatalf("Rename after the lock was released: %v", err)
+	}
+}
+
+// pausingRuntime holds Pause until released, to rename mid-operation
+type pausingRuntime struct {
+	*fakeRuntime
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (r *pausingRuntime) Pause(ctx context.Context, containerName string) error {
+	close(r.entered)
+	<-r.release
+	return r.fakeRuntime.Pause(ctx, containerName)
+}
+
+func TestRenameRefusesDuringPause(t *testing.T) {
+	stubHost(t)
+	store := newMemStore(testContainer(t, "pixel"))
+	rt := &pausingRuntime{fakeRuntime: newFakeRuntime(), entered: make(chan struct{}), release: make(chan struct{})}
+	rt.containers["pixel"] = &fakeContainer{running: true}
+
+	paused := make(chan error, 1)
+	go func() { paused <- NewManagerWith(store, rt, "pixel").Pause(context.Background()) }()
+	<-rt.entered
+	err := NewRenamerWith(store, rt).Rename(context.Background(), "pixel", "pixel-lab", false)
+	close(rt.release)
+	if !errors.Is(err, ErrBusy) {
+		t.Fatalf("Rename during a pause = %v, want ErrBusy", err)
+	}
+	if err := <-paused; err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if store.cfg.GetContainer("pixel") == nil || store.cfg.GetContainer("pixel-lab") != nil {
+		t.Error("the container should keep its name")
+	}
+}
+
+func TestConfigChangesWaitForRename(t *testing.T) {
+	stubHost(t)
+	store := newMemStore(testContainer(t, "pixel"))
+	rt := newFakeRuntime()
+	rt.containers["pixel"] = &fakeContainer{running: true}
+
+	lock, err := lockContainer("pixel", "rename")
+	if err != nil {
+		t.Fatalf("lockContainer: %v", err)
+	}
+	defer lock.Unlock()
+
+	mgr := NewManagerWith(store, rt, "pixel")
+	ops := map[string]func() error{
+		"pause":  func() error { return mgr.Pause(context.Background()) },
+		"resume": func() error { return mgr.Resume(context.Background()) },
+		"port":   func() error { return mgr.SetPort(context.Background(), 5600) },
+		"wait": func() error {
+			_, err := mgr.WaitForBoot(context.Background(), time.Second)
+			return err
+		},
+		"config set": func() error {
+			return NewSettingsManagerWith(store, rt).Set(context.Background(), "pixel", []string{"memory=2g"})
+		},
+	}
+	for name, op := range ops {
+		if err := op(); !errors.Is(err, ErrBusy) {
+			t.Errorf("%s during a rename = %v, want ErrBusy", name, err)
+		}
+	}
+}
@@ -1,133 +1,636 @@
 package container
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"reddock/pkg/config"
 )
 
+// Runtime is a container engine backend
 type Runtime interface {
 	Name() string
-	Command(args ...string) *exec.Cmd
-	IsInstalled() bool
-	PullImage(image string) error
-	PushImage(image string) error
-	Run(args ...string) error
-	Stop(containerName string) error
-	StartExisting(containerName string) error
-	Remove(containerName string, force bool) error
-	RemoveImage(image string) error
-	Inspect(containerName string, format string) (string, error)
-	Exists(containerName string) bool
-	IsRunning(containerName string) bool
-	PruneImages() (string, error)
-	IsAuthenticated() (bool, string, error)
+	Command(ctx context.Context, args ...string) *exec.Cmd
+	IsInstalled(ctx context.Context) bool
+	PullImage(ctx context.Context, image string) error
+	PushImage(ctx context.Context, image string) error
+	Run(ctx context.Context, opts *RunOptions) error
+	Build(ctx context.Context, contextDir, tag string) error
+	Stop(ctx context.Context, containerName string) error
+	StartExisting(ctx context.Context, containerName string) error
+	// Pause and Unpause freeze and thaw the container's processes
+	Pause(ctx context.Context, containerName string) error
+	Unpause(ctx context.Context, containerName string) error
+	Remove(ctx context.Context, containerName string, force bool) error
+	// Rename gives a container another name, keeping its filesystem
+	Rename(ctx context.Context, containerName, newName string) error
+	RemoveImage(ctx context.Context, image string) error
+	ImageExists(ctx context.Context, image string) bool
+	InspectContainer(ctx context.Context, containerName string) (*ContainerInfo, error)
+	Exists(ctx context.Context, containerName string) bool
+	IsRunning(ctx context.Context, containerName string) bool
+	PruneImages(ctx context.Context) (string, error)
+	IsAuthenticated(ctx context.Context) (bool, string, error)
+	NetworkExists(ctx context.Context, name string) bool
+	CreateNetwork(ctx context.Context, opts *NetworkOptions) error
+	// Events streams state transitions until ctx ends, then closes both channels
+	Events(ctx context.Context, containers []string) (<-chan Event, <-chan error)
+	// ListContainers inspects every container, running or not
+	ListContainers(ctx context.Context) ([]*ContainerInfo, error)
+	// Stats samples the resource usage, averaging the CPU over about a second
+	Stats(ctx context.Context, containerName string) (*ContainerStats, error)
+}
+
+// Labels mark the containers reddock creates
+const (
+	LabelManaged = "reddock.managed"
+	LabelName    = "reddock.name"
+)
+
+// RunOptions describes a container to be created and started in the background
+type RunOptions struct {
+	Name       string
+	Hostname   string
+	Image      string
+	Privileged bool
+	Volumes    []VolumeMount
+	Ports      []PortMapping
+	Args       []string
+
+	// Resource limits, left empty or zero for none
+	CPUs      string
+	Memory    string
+	CPUSet    string
+	PidsLimit int64
+	// Devices use the docker form /dev/host[:/dev/container[:permissions]]
+	Devices []string
+	Env     []string
+
+	// Network and IPAddress are left out of the fingerprint when empty
+	Network   string `json:",omitempty"`
+	IPAddress string `json:",omitempty"`
+
+	// Labels are left out of the fingerprint so unlabelled containers are not recreated
+	Labels map[string]string `json:"-"`
+}
+
+type NetworkOptions struct {
+	Name    string
+	Driver  string
+	Subnet  string
+	Gateway string
+	// Parent is the host interface of a macvlan network
+	Parent string
+}
+
+// Fingerprint identifies the options a container was created with
+func (o *RunOptions) Fingerprint() string {
+	data, _ := json.Marshal(o)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func parseDevice(spec string) (string, string, string) {
+	parts := strings.SplitN(spec, ":", 3)
+	host, target, perms := parts[0], parts[0], "rwm"
+	if len(parts) > 1 && parts[1] != "" {
+		target = parts[1]
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		perms = parts[2]
+	}
+	return host, target, perms
+}
+
+type VolumeMount struct {
+	Source  string
+	Target  string
+	Options string
+}
+
+func (v VolumeMount) String() string {
+	if v.Options == "" {
+		return fmt.Sprintf("%s:%s", v.Source, v.Target)
+	}
+	return fmt.Sprintf("%s:%s:%s", v.Source, v.Target, v.Options)
+}
+
+type PortMapping struct {
+	HostPort      int
+	ContainerPort int
+	Protocol      string
+}
+
+func (p PortMapping) String() string {
+	return fmt.Sprintf("%d:%d/%s", p.HostPort, p.ContainerPort, p.proto())
+}
+
+func (p PortMapping) proto() string {
+	if p.Protocol == "" {
+		return "tcp"
+	}
+	return p.Protocol
+}
+
+// ContainerInfo is the subset of container inspect data reddock relies on
+type ContainerInfo struct {
+	ID        string
+	Name      string
+	Image     string
+	Status    string
+	Running   bool
+	Paused    bool
+	ExitCode  int
+	IPAddress string
+	// Ports lists the published ports, only while the container runs
+	Ports []PortMapping
+	// StartedAt is zero when the engine does not report it
+	StartedAt time.Time
+
+	// What the container was created with, see adopt
+	Labels map[string]string
+	Args   []string
+	Mounts []VolumeMount
+	// Bindings lists the ports the container publishes when running
+	Bindings []PortMapping
+}
+
+func (i *ContainerInfo) Managed() bool {
+	return i.Labels[LabelManaged] == "true"
+}
+
+func (i *ContainerInfo) Mount(target string) string {
+	for _, m := range i.Mounts {
+		if m.Target == target {
+			return m.Source
+		}
+	}
+	return ""
+}
+
+// HostPort returns the host port of a TCP container port, zero when unpublished
+func (i *ContainerInfo) HostPort(containerPort int) int {
+	for _, p := range i.Ports {
+		if p.ContainerPort == containerPort && p.proto() == "tcp" {
+			return p.HostPort
+		}
+	}
+	return 0
+}
+
+// containerJSON mirrors the docker-compatible inspect document
+type containerJSON struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Cmd    []string          `json:"Cmd"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	HostConfig struct {
+		PortBindings map[string][]struct {
+			HostPort string `json:"HostPort"`
+		} `json:"PortBindings"`
+	} `json:"HostConfig"`
+	Mounts []struct {
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+	} `json:"Mounts"`
+	State struct {
+		Status    string `json:"Status"`
+		Running   bool   `json:"Running"`
+		Paused    bool   `json:"Paused"`
+		StartedAt string `json:"StartedAt"`
+		ExitCode  int    `json:"ExitCode"`
+	} `json:"State"`
+	NetworkSettings struct {
+		IPAddress string `json:"IPAddress"`
+		Ports     map[string][]struct {
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+func (c *containerJSON) info() *ContainerInfo {
+	info := &ContainerInfo{
+		ID:        c.ID,
+		Name:      strings.TrimPrefix(c.Name, "/"),
+		Image:     c.Config.Image,
+		Status:    c.State.Status,
+		Running:   c.State.Running,
+		Paused:    c.State.Paused,
+		ExitCode:  c.State.ExitCode,
+		IPAddress: c.NetworkSettings.IPAddress,
+		Labels:    c.Config.Labels,
+		Args:      c.Config.Cmd,
+	}
+	if started, err := time.Parse(time.RFC3339Nano, c.State.StartedAt); err == nil && started.Year() > 1 {
+		info.StartedAt = started
+	}
+	for key, bindings := range c.NetworkSettings.Ports {
+		for _, binding := range bindings {
+			if p, ok := parseBinding(key, binding.HostPort); ok {
+				info.Ports = append(info.Ports, p)
+			}
+		}
+	}
+	for key, bindings := range c.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			if p, ok := parseBinding(key, binding.HostPort); ok {
+				info.Bindings = append(info.Bindings, p)
+			}
+		}
+	}
+	for _, m := range c.Mounts {
+		info.Mounts = append(info.Mounts, VolumeMount{Source: m.Source, Target: m.Destination})
+	}
+	if info.IPAddress == "" {
+		for _, network := range c.NetworkSettings.Networks {
+			if network.IPAddress != "" {
+				info.IPAddress = network.IPAddress
+				break
+			}
+		}
+	}
+	return info
+}
+
+func parseBinding(key, hostPort string) (PortMapping, bool) {
+	port, proto, _ := strings.Cut(key, "/")
+	containerPort, err1 := strconv.Atoi(port)
+	host, err2 := strconv.Atoi(hostPort)
+	if err1 != nil || err2 != nil {
+		return PortMapping{}, false
+	}
+	return PortMapping{HostPort: host, ContainerPort: containerPort, Protocol: proto}, true
+}
+
+func sortedLabels(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func runArgs(opts *RunOptions) []string {
+	args := []string{"run", "-d"}
+	if opts.Privileged {
+		args = append(args, "--privileged")
+	}
+	args = append(args, "--name", opts.Name)
+	if opts.Hostname != "" {
+		args = append(args, "--hostname", opts.Hostname)
+	}
+	for _, v := range opts.Volumes {
+		args = append(args, "-v", v.String())
+	}
+	if opts.Network != "" {
+		args = append(args, "--network", opts.Network)
+	}
+	if opts.IPAddress != "" {
+		args = append(args, "--ip", opts.IPAddress)
+	}
+	for _, p := range opts.Ports {
+		args = append(args, "-p", p.String())
+	}
+	if opts.CPUs != "" {
+		args = append(args, "--cpus", opts.CPUs)
+	}
+	if opts.Memory != "" {
+		args = append(args, "--memory", opts.Memory)
+	}
+	if opts.CPUSet != "" {
+		args = append(args, "--cpuset-cpus", opts.CPUSet)
+	}
+	if opts.PidsLimit != 0 {
+		args = append(args, "--pids-limit", strconv.FormatInt(opts.PidsLimit, 10))
+	}
+	for _, d := range opts.Devices {
+		args = append(args, "--device", d)
+	}
+	for _, e := range opts.Env {
+		args = append(args, "-e", e)
+	}
+	for _, key := range sortedLabels(opts.Labels) {
+		args = append(args, "--label", key+"="+opts.Labels[key])
+	}
+	args = append(args, opts.Image)
+	args = append(args, opts.Args...)
+	return args
 }
 
+// GenericRuntime drives a docker-compatible CLI
 type GenericRuntime struct {
-	binary string
+	binary     string
+	globalArgs []string
 }
 
+// NewRuntime returns the runtime selected by flag, environment or config
 func NewRuntime() Runtime {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.GetDefault()
+	}
+	return NewRuntimeFromConfig(cfg)
+}
+
+func detectRuntime() Runtime {
 	// Prefer podman if available, otherwise docker
 	if _, err := exec.LookPath("podman"); err == nil {
+		// Use the libpod service when its socket is up, the CLI otherwise
+		if podman := NewPodmanRuntime(PodmanSocketPath()); podman.IsInstalled(context.Background()) {
+			return podman
+		}
 		return &GenericRuntime{binary: "podman"}
 	}
+	// Without a docker CLI, use containerd (k3s nodes). The Engine API backend
+	// is never picked, exec, logs and cp still need the docker CLI.
+	if _, err := exec.LookPath("docker"); err != nil {
+		if nerdctl := NewNerdctlRuntime(ContainerdAddress(), ContainerdNamespace()); nerdctl.IsInstalled(context.Background()) {
+			return nerdctl
+		}
+	}
 	return &GenericRuntime{binary: "docker"}
 }
 
+// cliError maps a failed command onto a typed error
+func (r *GenericRuntime) cliError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ContextError(ctx, err)
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return NewError(ErrRuntimeUnavailable, "", "%s is not installed", r.binary).Wrap(err)
+	}
+	stderr := cliStderr(err)
+	if stderr == "" {
+		return err
+	}
+	lower := strings.ToLower(stderr)
+	for _, reason := range []string{"cannot connect", "unable to connect", "connection refused", "permission denied", "daemon running"} {
+		if strings.Contains(lower, reason) {
+			return NewError(ErrRuntimeUnavailable, "", "%s is unavailable: %s", r.binary, stderr).Wrap(err)
+		}
+	}
+	return fmt.Errorf("%w: %s", err, stderr)
+}
+
+func cliStderr(err error) string {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ""
+	}
+	return strings.TrimSpace(string(exitErr.Stderr))
+}
+
+// noSuchContainer matches the not-found messages of docker, podman and nerdctl
+func noSuchContainer(err error) bool {
+	stderr := strings.ToLower(cliStderr(err))
+	return strings.Contains(stderr, "no such container") || strings.Contains(stderr, "no such object")
+}
+
 func (r *GenericRuntime) Name() string {
 	return r.binary
 }
 
-func (r *GenericRuntime) Command(args ...string) *exec.Cmd {
-	return exec.Command(r.binary, args...)
+func (r *GenericRuntime) Command(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, r.binary, append(append([]string{}, r.globalArgs...), args...)...)
 }
 
-func (r *GenericRuntime) IsInstalled() bool {
+func (r *GenericRuntime) IsInstalled(ctx context.Context) bool {
 	_, err := exec.LookPath(r.binary)
 	return err == nil
 }
 
-func (r *GenericRuntime) PullImage(image string) error {
-	cmd := r.Command("pull", image)
+func (r *GenericRuntime) PullImage(ctx context.Context, image string) error {
+	cmd := r.Command(ctx, "pull", image)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return r.cliError(ctx, cmd.Run())
 }
 
-func (r *GenericRuntime) PushImage(image string) error {
-	cmd := r.Command("push", image)
+func (r *GenericRuntime) PushImage(ctx context.Context, image string) error {
+	cmd := r.Command(ctx, "push", image)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return r.cliError(ctx, cmd.Run())
 }
 
-func (r *GenericRuntime) Run(args ...string) error {
-	cmd := r.Command(append([]string{"run"}, args...)...)
-	return cmd.Run()
+func (r *GenericRuntime) Run(ctx context.Context, opts *RunOptions) error {
+	output, err := r.Command(ctx, runArgs(opts)...).CombinedOutput()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) || ctx.Err() != nil {
+			return r.cliError(ctx, err)
+		}
+		return fmt.Errorf("%v\n%s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
 }
 
-func (r *GenericRuntime) Stop(containerName string) error {
-	return r.Command("stop", containerName).Run()
+func (r *GenericRuntime) Build(ctx context.Context, contextDir, tag string) error {
+	// Podman has no buildx; docker needs --load to keep the result local
+	args := []string{"build", "-t", tag, contextDir}
+	if r.binary == "docker" {
+		args = []string{"buildx", "build", "--load", "-t", tag, contextDir}
+	}
+	output, err := r.Command(ctx, args...).CombinedOutput()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) || ctx.Err() != nil {
+			return r.cliError(ctx, err)
+		}
+		return fmt.Errorf("%v\n%s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
 }
 
-func (r *GenericRuntime) StartExisting(containerName string) error {
-	return r.Command("start", containerName).Run()
+func (r *GenericRuntime) Stop(ctx context.Context, containerName string) error {
+	return r.cliError(ctx, r.Command(ctx, "stop", containerName).Run())
 }
 
-func (r *GenericRuntime) Remove(containerName string, force bool) error {
+func (r *GenericRuntime) StartExisting(ctx context.Context, containerName string) error {
+	return r.cliError(ctx, r.Command(ctx, "start", containerName).Run())
+}
+
+func (r *GenericRuntime) Pause(ctx context.Context, containerName string) error {
+	return r.cliError(ctx, r.Command(ctx, "pause", containerName).Run())
+}
+
+func (r *GenericRuntime) Unpause(ctx context.Context, containerName string) error {
+	return r.cliError(ctx, r.Command(ctx, "unpause", containerName).Run())
+}
+
+func (r *GenericRuntime) Remove(ctx context.Context, containerName string, force bool) error {
 	args := []string{"rm"}
 	if force {
 		args = append(args, "-f")
 	}
 	args = append(args, containerName)
-	return r.Command(args...).Run()
+	return r.cliError(ctx, r.Command(ctx, args...).Run())
 }
 
-func (r *GenericRuntime) RemoveImage(image string) error {
-	return r.Command("rmi", image).Run()
+func (r *GenericRuntime) Rename(ctx context.Context, containerName, newName string) error {
+	return r.cliError(ctx, r.Command(ctx, "rename", containerName, newName).Run())
 }
 
-func (r *GenericRuntime) Inspect(containerName string, format string) (string, error) {
-	cmd := r.Command("inspect", "-f", format, containerName)
-	output, err := cmd.Output()
+func (r *GenericRuntime) RemoveImage(ctx context.Context, image string) error {
+	return r.cliError(ctx, r.Command(ctx, "rmi", image).Run())
+}
+
+func (r *GenericRuntime) ImageExists(ctx context.Context, image string) bool {
+	return r.Command(ctx, "image", "inspect", image).Run() == nil
+}
+
+func (r *GenericRuntime) InspectContainer(ctx context.Context, containerName string) (*ContainerInfo, error) {
+	output, err := r.Command(ctx, "container", "inspect", containerName).Output()
+	if err != nil {
+		if noSuchContainer(err) {
+			return nil, NewError(ErrContainerNotFound, containerName, "Failed to inspect container '%s'", containerName).Wrap(err)
+		}
+		return nil, r.cliError(ctx, err)
+	}
+	var docs []containerJSON
+	if err := json.Unmarshal(output, &docs); err != nil {
+		return nil, fmt.Errorf("Failed to parse inspect output: %v", err)
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("No such container: %s", containerName)
+	}
+	return docs[0].info(), nil
+}
+
+func (r *GenericRuntime) Stats(ctx context.Context, containerName string) (*ContainerStats, error) {
+	output, err := r.Command(ctx, "stats", "--no-stream", "--format", "{{json .}}", containerName).Output()
+	if err != nil {
+		if noSuchContainer(err) {
+			return nil, NewError(ErrContainerNotFound, containerName, "Failed to read the stats of '%s'", containerName).Wrap(err)
+		}
+		return nil, r.cliError(ctx, err)
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	var doc cliStatsJSON
+	if err := json.Unmarshal([]byte(line), &doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse stats output: %v", err)
+	}
+	return doc.stats(containerName), nil
+}
+
+func (r *GenericRuntime) ListContainers(ctx context.Context) ([]*ContainerInfo, error) {
+	output, err := r.Command(ctx, "ps", "-a", "-q", "--no-trunc").Output()
+	if err != nil {
+		return nil, r.cliError(ctx, err)
+	}
+	ids := strings.Fields(string(output))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	output, err = r.Command(ctx, append([]string{"container", "inspect"}, ids...)...).Output()
+	if err != nil {
+		return nil, r.cliError(ctx, err)
+	}
+	var docs []containerJSON
+	if err := json.Unmarshal(output, &docs); err != nil {
+		return nil, fmt.Errorf("Failed to parse inspect output: %v", err)
+	}
+	infos := make([]*ContainerInfo, 0, len(docs))
+	for i := range docs {
+		infos = append(infos, docs[i].info())
+	}
+	return infos, nil
+}
+
+func (r *GenericRuntime) NetworkExists(ctx context.Context, name string) bool {
+	return r.Command(ctx, "network", "inspect", name).Run() == nil
+}
+
+func (r *GenericRuntime) CreateNetwork(ctx context.Context, opts *NetworkOptions) error {
+	output, err := r.Command(ctx, networkCreateArgs(opts)...).CombinedOutput()
 	if err != nil {
-		return "", err
+		if errors.Is(err, exec.ErrNotFound) || ctx.Err() != nil {
+			return r.cliError(ctx, err)
+		}
+		return fmt.Errorf("Failed to create network '%s': %v\n%s", opts.Name, err, strings.TrimSpace(string(output)))
 	}
-	return strings.TrimSpace(string(output)), nil
+	return nil
 }
 
-func (r *GenericRuntime) Exists(containerName string) bool {
+func networkCreateArgs(opts *NetworkOptions) []string {
+	args := []string{"network", "create"}
+	if opts.Driver != "" {
+		args = append(args, "--driver", opts.Driver)
+	}
+	if opts.Subnet != "" {
+		args = append(args, "--subnet", opts.Subnet)
+	}
+	if opts.Gateway != "" {
+		args = append(args, "--gateway", opts.Gateway)
+	}
+	if opts.Parent != "" {
+		args = append(args, "-o", "parent="+opts.Parent)
+	}
+	return append(args, opts.Name)
+}
+
+func (r *GenericRuntime) Exists(ctx context.Context, containerName string) bool {
 	// Implement generic exists check using ps -a or inspect
 	// Using ps -a with filter is robust
-	cmd := r.Command("ps", "-a", "--filter", "name=^"+containerName+"$", "--format", "{{.Names}}")
+	cmd := r.Command(ctx, "ps", "-a", "--filter", "name=^"+containerName+"$", "--format", "{{.Names}}")
 	output, _ := cmd.Output()
 	return strings.TrimSpace(string(output)) == containerName
 }
 
-func (r *GenericRuntime) IsRunning(containerName string) bool {
-	state, err := r.Inspect(containerName, "{{.State.Running}}")
+func (r *GenericRuntime) IsRunning(ctx context.Context, containerName string) bool {
+	info, err := r.InspectContainer(ctx, containerName)
 	if err != nil {
 		return false
 	}
-	return state == "true"
+	return info.Running
 }
 
-func (r *GenericRuntime) PruneImages() (string, error) {
-	cmd := r.Command("image", "prune", "-f")
+func (r *GenericRuntime) Events(ctx context.Context, containers []string) (<-chan Event, <-chan error) {
+	args := []string{"events", "--format", "{{json .}}", "--filter", "type=container"}
+	for _, name := range containers {
+		args = append(args, "--filter", "container="+name)
+	}
+	return streamCommandEvents(ctx, r.Command(ctx, args...), parseCLIEvent)
+}
+
+func (r *GenericRuntime) PruneImages(ctx context.Context) (string, error) {
+	cmd := r.Command(ctx, "image", "prune", "-f")
 	output, err := cmd.Output()
 	if err != nil {
-		return "", err
+		return "", r.cliError(ctx, err)
 	}
 	return string(output), nil
 }
 
-func (r *GenericRuntime) IsAuthenticated() (bool, string, error) {
-	cmd := r.Command("info")
+func (r *GenericRuntime) IsAuthenticated(ctx context.Context) (bool, string, error) {
+	// podman info does not report the registry login
+	if r.binary == "podman" {
+		user, _, ok := lookupCredentials(PodmanAuthPath(), dockerHubRegistry)
+		return ok, user, nil
+	}
+
+	cmd := r.Command(ctx, "info")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return false, "", err
+		return false, "", r.cliError(ctx, err)
 	}
 	outStr := string(output)
 	lines := strings.Split(outStr, "\n")
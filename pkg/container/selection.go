@@ -0,0 +1,203 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"reddock/pkg/config"
+)
+
+const (
+	RuntimeAuto      = "auto"
+	RuntimeDocker    = "docker"
+	RuntimeDockerAPI = "docker-api"
+	RuntimePodman    = "podman"
+	RuntimeNerdctl   = "nerdctl"
+
+	// RuntimeEnvVar selects the runtime when no --runtime flag is given
+	RuntimeEnvVar = "REDDOCK_RUNTIME"
+	// HostEnvVar selects the engine endpoint when no --host flag is given
+	HostEnvVar = "REDDOCK_HOST"
+)
+
+var runtimeOverride string
+
+var hostOverride string
+
+func RuntimeNames() []string {
+	return []string{RuntimeAuto, RuntimeDocker, RuntimeDockerAPI, RuntimePodman, RuntimeNerdctl}
+}
+
+func ValidateRuntimeName(name string) error {
+	for _, valid := range RuntimeNames() {
+		if name == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown runtime '%s' (valid: %s)", name, strings.Join(RuntimeNames(), ", "))
+}
+
+func SetRuntimeOverride(name string) error {
+	if err := ValidateRuntimeName(name); err != nil {
+		return err
+	}
+	runtimeOverride = name
+	return nil
+}
+
+// ResolveRuntimeName applies the precedence flag > environment > config
+func ResolveRuntimeName(cfg *config.Config) string {
+	if runtimeOverride != "" {
+		return runtimeOverride
+	}
+	if env := os.Getenv(RuntimeEnvVar); env != "" {
+		if err := ValidateRuntimeName(env); err != nil {
+			fmt.Printf("Warning: ignoring %s: %v\n", RuntimeEnvVar, err)
+		} else {
+			return env
+		}
+	}
+	if cfg != nil && cfg.Runtime != "" {
+		if err := ValidateRuntimeName(cfg.Runtime); err != nil {
+			fmt.Printf("Warning: ignoring runtime from config: %v\n", err)
+		} else {
+			return cfg.Runtime
+		}
+	}
+	return RuntimeAuto
+}
+
+func SetHostOverride(host string) error {
+	if _, err := ParseEndpoint(host); err != nil {
+		return err
+	}
+	hostOverride = host
+	return nil
+}
+
+// ResolveHost applies the precedence flag > environment > config
+func ResolveHost(cfg *config.Config) string {
+	if hostOverride != "" {
+		return hostOverride
+	}
+	if env := os.Getenv(HostEnvVar); env != "" {
+		if _, err := ParseEndpoint(env); err != nil {
+			fmt.Printf("Warning: ignoring %s: %v\n", HostEnvVar, err)
+		} else {
+			return env
+		}
+	}
+	if cfg != nil && cfg.Host != "" {
+		if _, err := ParseEndpoint(cfg.Host); err != nil {
+			fmt.Printf("Warning: ignoring host from config: %v\n", err)
+		} else {
+			return cfg.Host
+		}
+	}
+	return ""
+}
+
+func NewRuntimeByName(name string) (Runtime, error) {
+	return NewRuntimeByNameAt(name, "")
+}
+
+// NewRuntimeByNameAt connects a backend to host, empty for the local engine
+func NewRuntimeByNameAt(name, host string) (Runtime, error) {
+	if host != "" {
+		return newRemoteRuntime(name, host)
+	}
+	switch name {
+	case "", RuntimeAuto:
+		return detectRuntime(), nil
+	case RuntimeDocker:
+		return &GenericRuntime{binary: "docker"}, nil
+	case RuntimeDockerAPI:
+		return NewEngineRuntime(DockerSocketPath()), nil
+	case RuntimePodman:
+		// Use the libpod service when its socket is up, the CLI otherwise
+		if podman := NewPodmanRuntime(PodmanSocketPath()); podman.IsInstalled(context.Background()) {
+			return podman, nil
+		}
+		return &GenericRuntime{binary: "podman"}, nil
+	case RuntimeNerdctl:
+		return NewNerdctlRuntime(ContainerdAddress(), ContainerdNamespace()), nil
+	default:
+		return nil, ValidateRuntimeName(name)
+	}
+}
+
+func newRemoteRuntime(name, host string) (Runtime, error) {
+	ep, err := ParseEndpoint(host)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "", RuntimeAuto, RuntimeDocker:
+		return &GenericRuntime{binary: "docker", globalArgs: []string{"-H", ep.String()}}, nil
+	case RuntimeDockerAPI:
+		return NewEngineRuntimeAt(ep), nil
+	case RuntimePodman:
+		if !ep.IsRemote() {
+			if podman := NewPodmanRuntime(ep.Path); podman.IsInstalled(context.Background()) {
+				return podman, nil
+			}
+		}
+		// podman remote understands unix, tcp and ssh URLs
+		return &GenericRuntime{binary: "podman", globalArgs: []string{"--url", ep.String()}}, nil
+	case RuntimeNerdctl:
+		if ep.IsRemote() {
+			return nil, fmt.Errorf("nerdctl cannot manage remote host %s, use docker or podman", host)
+		}
+		return NewNerdctlRuntime(ep.Path, ContainerdNamespace()), nil
+	default:
+		return nil, ValidateRuntimeName(name)
+	}
+}
+
+// NewRuntimeFromConfig returns the runtime for operations on no container
+func NewRuntimeFromConfig(cfg *config.Config) Runtime {
+	runtime, err := NewRuntimeByNameAt(ResolveRuntimeName(cfg), ResolveHost(cfg))
+	if err != nil {
+		fmt.Printf("Warning: %v, falling back to auto-detection\n", err)
+		return detectRuntime()
+	}
+	return runtime
+}
+
+// NewRuntimeForContainer returns the backend and host that created a container
+func NewRuntimeForContainer(cfg *config.Config, c *config.Container) Runtime {
+	if c == nil {
+		return NewRuntimeFromConfig(cfg)
+	}
+	name := c.Runtime
+	if name == "" {
+		name = ResolveRuntimeName(cfg)
+	} else if runtimeOverride != "" && runtimeOverride != RuntimeAuto && runtimeOverride != c.Runtime {
+		fmt.Printf("Note: container '%s' is managed by %s, ignoring --runtime %s\n", c.Name, c.Runtime, runtimeOverride)
+	}
+	if hostOverride != "" && hostOverride != c.Host {
+		fmt.Printf("Note: container '%s' lives on %s, ignoring --host %s\n", c.Name, hostLabel(c.Host), hostOverride)
+	}
+
+	runtime, err := NewRuntimeByNameAt(name, c.Host)
+	if err == nil {
+		return runtime
+	}
+	fmt.Printf("Warning: container '%s': %v, falling back to auto-detection\n", c.Name, err)
+	// Never fall back to the local engine for a container on another host
+	if c.Host != "" {
+		if runtime, err := NewRuntimeByNameAt(RuntimeAuto, c.Host); err == nil {
+			return runtime
+		}
+	}
+	return detectRuntime()
+}
+
+func hostLabel(host string) string {
+	if host == "" {
+		return "local"
+	}
+	return host
+}
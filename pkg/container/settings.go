@@ -0,0 +1,73 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"reddock/pkg/config"
+)
+
+// SettingsManager changes the run settings of an existing container
+type SettingsManager struct {
+	store   config.Store
+	config  *config.Config
+	runtime Runtime
+}
+
+func NewSettingsManager() *SettingsManager {
+	return NewSettingsManagerWith(config.NewFileStore(), nil)
+}
+
+func NewSettingsManagerWith(store config.Store, runtime Runtime) *SettingsManager {
+	return &SettingsManager{store: store, config: config.LoadOrDefault(store), runtime: runtime}
+}
+
+func (s *SettingsManager) Set(ctx context.Context, containerName string, pairs []string) error {
+	lock, err := lockContainer(containerName, "config set")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	// Load under the lock, so no other operation saves meanwhile
+	s.config = config.LoadOrDefault(s.store)
+	container := s.config.GetContainer(containerName)
+	if container == nil {
+		return notFoundError(containerName)
+	}
+	if len(pairs) == 0 {
+		return fmt.Errorf("No settings given. Usage: reddock config set %s key=value...", containerName)
+	}
+	if err := container.ApplySettings(pairs); err != nil {
+		return err
+	}
+	if err := s.store.Save(s.config); err != nil {
+		return fmt.Errorf("Failed to save the config: %v", err)
+	}
+
+	fmt.Printf("Updated settings of '%s'\n", containerName)
+	runtime := s.runtime
+	if runtime == nil {
+		runtime = NewRuntimeForContainer(s.config, container)
+	}
+	if runtime.IsRunning(ctx, containerName) {
+		fmt.Printf("Run 'reddock restart %s' to apply them\n", containerName)
+	} else {
+		fmt.Println("They apply the next time the container starts")
+	}
+	return nil
+}
+
+func (s *SettingsManager) Show(containerName string) error {
+	container := s.config.GetContainer(containerName)
+	if container == nil {
+		return notFoundError(containerName)
+	}
+	settings := container.Settings()
+	if len(settings) == 0 {
+		fmt.Printf("Container '%s' uses the default settings\n", containerName)
+		return nil
+	}
+	fmt.Println(strings.Join(settings, "\n"))
+	return nil
+}
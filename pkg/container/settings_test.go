@@ -0,0 +1,208 @@
+package container
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"reddock/pkg/config"
+)
+
+func TestApplySettingsValidates(t *testing.T) {
+	for _, pair := range []string{
+		"cpus=zero", "cpus=-1", "memory=lots", "cpuset=a-b", "pids-limit=0",
+		"device=kvm", "env==x", "mount=/a", "mount=/a:/data", "unknown=1", "cpus",
+	} {
+		c := &config.Container{CPUs: "1"}
+		if err := c.ApplySettings([]string{pair}); err == nil {
+			t.Errorf("ApplySettings(%q) succeeded, want an error", pair)
+		}
+		if c.CPUs != "1" {
+			t.Errorf("failed ApplySettings(%q) modified the container", pair)
+		}
+	}
+}
+
+func TestApplySettingsReplacesLists(t *testing.T) {
+	c := &config.Container{Devices: []string{"/dev/old"}, Env: []string{"A=1"}}
+	err := c.ApplySettings([]string{"device=/dev/kvm", "device=/dev/dri:/dev/dri:rw", "memory=4g", "env="})
+	if err != nil {
+		t.Fatalf("ApplySettings: %v", err)
+	}
+	if strings.Join(c.Devices, ",") != "/dev/kvm,/dev/dri:/dev/dri:rw" {
+		t.Errorf("devices = %v", c.Devices)
+	}
+	if len(c.Env) != 0 || c.Memory != "4g" {
+		t.Errorf("unexpected container: %+v", c)
+	}
+
+	want := "memory=4g device=/dev/kvm device=/dev/dri:/dev/dri:rw"
+	if got := strings.Join(c.Settings(), " "); got != want {
+		t.Errorf("Settings() = %q, want %q", got, want)
+	}
+}
+
+func TestRunArgsResourceLimits(t *testing.T) {
+	args := strings.Join(runArgs(&RunOptions{
+		Name:      "a",
+		Image:     "img",
+		CPUs:      "1.5",
+		Memory:    "4g",
+		CPUSet:    "0-3",
+		PidsLimit: 512,
+		Devices:   []string{"/dev/kvm"},
+		Env:       []string{"A=1"},
+	}), " ")
+	for _, want := range []string{"--cpus 1.5", "--memory 4g", "--cpuset-cpus 0-3", "--pids-limit 512", "--device /dev/kvm", "-e A=1 img"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("run args %q missing %q", args, want)
+		}
+	}
+}
+
+func TestPodmanLimits(t *testing.T) {
+	res, err := podmanLimits(&RunOptions{CPUs: "0.5", Memory: "1g", PidsLimit: 100})
+	if err != nil {
+		t.Fatalf("podmanLimits: %v", err)
+	}
+	if res.CPU.Quota != 50000 || res.CPU.Period != 100000 || res.Memory.Limit != 1<<30 || res.Pids.Limit != 100 {
+		t.Errorf("unexpected limits: %+v %+v %+v", res.CPU, res.Memory, res.Pids)
+	}
+	if res, _ := podmanLimits(&RunOptions{}); res != nil {
+		t.Errorf("no limits should give nil, got %+v", res)
+	}
+}
+
+func TestStartAppliesSettings(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	c := testContainer(t, "android")
+	c.Memory = "2g"
+	c.Mounts = []string{"/srv/apks:/sdcard/apks:ro"}
+	store := newMemStore(c)
+	mgr := NewManagerWith(store, rt, "android")
+
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if rt.lastRun.Memory != "2g" {
+		t.Errorf("memory = %q", rt.lastRun.Memory)
+	}
+	if len(rt.lastRun.Volumes) != 2 || rt.lastRun.Volumes[1].String() != "/srv/apks:/sdcard/apks:ro" {
+		t.Errorf("volumes = %+v", rt.lastRun.Volumes)
+	}
+	if store.cfg.GetContainer("android").RunSpec == "" {
+		t.Error("run spec was not recorded")
+	}
+}
+
+func TestStartRecreatesAfterSettingsChange(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	c := testContainer(t, "android")
+	store := newMemStore(c)
+
+	if err := NewManagerWith(store, rt, "android").Start(context.Background(), false); err != nil {
+		t.Fatalf("first Start: %v", err)
+	}
+	rt.containers["android"].running = false
+
+	settings := NewSettingsManagerWith(store, rt)
+	if err := settings.Set(context.Background(), "android", []string{"cpus=2"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	rt.calls = nil
+	if err := NewManagerWith(store, rt, "android").Start(context.Background(), false); err != nil {
+		t.Fatalf("second Start: %v", err)
+	}
+	if !rt.called("Remove android") || !rt.called("Run android") || rt.called("StartExisting") {
+		t.Fatalf("expected the container to be recreated, calls: %v", rt.calls)
+	}
+	if rt.lastRun.CPUs != "2" {
+		t.Errorf("cpus = %q", rt.lastRun.CPUs)
+	}
+}
+
+func TestStartKeepsContainerWithUnchangedSettings(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	store := newMemStore(testContainer(t, "android"))
+
+	if err := NewManagerWith(store, rt, "android").Start(context.Background(), false); err != nil {
+		t.Fatalf("first Start: %v", err)
+	}
+	rt.containers["android"].running = false
+
+	rt.calls = nil
+	if err := NewManagerWith(store, rt, "android").Start(context.Background(), false); err != nil {
+		t.Fatalf("second Start: %v", err)
+	}
+	if rt.called("Remove") || !rt.called("StartExisting android") {
+		t.Fatalf("expected the existing container to be started, calls: %v", rt.calls)
+	}
+}
+
+func TestBootPropertySettings(t *testing.T) {
+	c := &config.Container{GPUMode: config.DefaultGPUMode}
+	err := c.ApplySettings([]string{
+		"width=1080", "height=1920", "dpi=480", "fps=60",
+		"gpu-mode=host", "gpu-node=/dev/dri/renderD128",
+		"ro.product.model=Pixel 7", "androidboot.hardware=redroid",
+	})
+	if err != nil {
+		t.Fatalf("ApplySettings: %v", err)
+	}
+
+	want := []string{
+		"androidboot.redroid_gpu_mode=host",
+		"androidboot.redroid_gpu_node=/dev/dri/renderD128",
+		"androidboot.redroid_width=1080",
+		"androidboot.redroid_height=1920",
+		"androidboot.redroid_dpi=480",
+		"androidboot.redroid_fps=60",
+		"androidboot.hardware=redroid",
+		"ro.product.model=Pixel 7",
+	}
+	if got := c.BootArgs(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("BootArgs() = %v, want %v", got, want)
+	}
+
+	if err := c.ApplySettings([]string{"ro.product.model=", "gpu-mode=", "width="}); err != nil {
+		t.Fatalf("clearing: %v", err)
+	}
+	if _, ok := c.BootProps["ro.product.model"]; ok || c.GPUMode != config.DefaultGPUMode || c.Width != 0 {
+		t.Errorf("settings were not cleared: %+v", c)
+	}
+}
+
+func TestBootPropertyValidation(t *testing.T) {
+	for _, pair := range []string{
+		"width=wide", "fps=0", "gpu-mode=fast", "gpu-node=renderD128",
+		"androidboot.redroid_width=720", "ro.bad key=1",
+	} {
+		c := &config.Container{BootProps: map[string]string{"ro.keep": "1"}}
+		if err := c.ApplySettings([]string{"ro.new=1", pair}); err == nil {
+			t.Errorf("ApplySettings(%q) succeeded, want an error", pair)
+		}
+		if len(c.BootProps) != 1 {
+			t.Errorf("failed ApplySettings(%q) modified the boot properties: %v", pair, c.BootProps)
+		}
+	}
+}
+
+func TestStartPassesBootArgs(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	c := testContainer(t, "android")
+	c.Width, c.Height = 720, 1280
+	mgr := NewManagerWith(newMemStore(c), rt, "android")
+
+	if err := mgr.Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	args := strings.Join(rt.lastRun.Args, " ")
+	if args != "androidboot.redroid_gpu_mode=auto androidboot.redroid_width=720 androidboot.redroid_height=1280" {
+		t.Errorf("boot args = %q", args)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package container
+
+import "syscall"
+
+// freeSpace returns the bytes available to unprivileged users under path
+func freeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
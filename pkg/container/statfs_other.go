@@ -0,0 +1,9 @@
+//go:build !linux
+
+package container
+
+import "errors"
+
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space is only checked on Linux")
+}
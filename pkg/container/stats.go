@@ -0,0 +1,304 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"reddock/pkg/config"
+)
+
+// DefaultStatsInterval is how often "reddock stats" refreshes
+const DefaultStatsInterval = 2 * time.Second
+
+// ContainerStats is one resource usage sample, sizes are in bytes
+type ContainerStats struct {
+	Name        string  `json:"name"`
+	Host        string  `json:"host,omitempty"`
+	Running     bool    `json:"running"`
+	CPUPercent  float64 `json:"cpu_percent"`
+	MemoryUsage uint64  `json:"memory_usage"`
+	MemoryLimit uint64  `json:"memory_limit"`
+	NetworkRx   uint64  `json:"network_rx"`
+	NetworkTx   uint64  `json:"network_tx"`
+	BlockRead   uint64  `json:"block_read"`
+	BlockWrite  uint64  `json:"block_write"`
+	PIDs        uint64  `json:"pids"`
+}
+
+func (s *ContainerStats) MemoryPercent() float64 {
+	if s.MemoryLimit == 0 {
+		return 0
+	}
+	return float64(s.MemoryUsage) / float64(s.MemoryLimit) * 100
+}
+
+type engineStatsJSON struct {
+	CPUStats    engineCPUStats `json:"cpu_stats"`
+	PreCPUStats engineCPUStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+type engineCPUStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  uint64 `json:"online_cpus"`
+}
+
+// stats computes a sample the way "docker stats" does, memory without the page cache
+func (s *engineStatsJSON) stats(name string) *ContainerStats {
+	stats := &ContainerStats{
+		Name:        name,
+		Running:     true,
+		MemoryUsage: s.MemoryStats.Usage,
+		MemoryLimit: s.MemoryStats.Limit,
+		PIDs:        s.PidsStats.Current,
+	}
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	cpus := float64(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		stats.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+	// cgroup v2 reports inactive_file, v1 total_inactive_file
+	for _, key := range []string{"inactive_file", "total_inactive_file"} {
+		if cache, ok := s.MemoryStats.Stats[key]; ok && cache < stats.MemoryUsage {
+			stats.MemoryUsage -= cache
+			break
+		}
+	}
+	for _, n := range s.Networks {
+		stats.NetworkRx += n.RxBytes
+		stats.NetworkTx += n.TxBytes
+	}
+	for _, entry := range s.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.BlockRead += entry.Value
+		case "write":
+			stats.BlockWrite += entry.Value
+		}
+	}
+	return stats
+}
+
+// cliStatsJSON is a line of "<runtime> stats --format '{{json .}}'"
+type cliStatsJSON struct {
+	Name     string `json:"Name"`
+	CPUPerc  string `json:"CPUPerc"`
+	MemUsage string `json:"MemUsage"`
+	NetIO    string `json:"NetIO"`
+	BlockIO  string `json:"BlockIO"`
+	PIDs     string `json:"PIDs"`
+}
+
+func (s *cliStatsJSON) stats(name string) *ContainerStats {
+	stats := &ContainerStats{Name: name, Running: true}
+	stats.CPUPercent, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s.CPUPerc), "%"), 64)
+	stats.MemoryUsage, stats.MemoryLimit = parseSizePair(s.MemUsage)
+	stats.NetworkRx, stats.NetworkTx = parseSizePair(s.NetIO)
+	stats.BlockRead, stats.BlockWrite = parseSizePair(s.BlockIO)
+	stats.PIDs, _ = strconv.ParseUint(strings.TrimSpace(s.PIDs), 10, 64)
+	return stats
+}
+
+func parseSizePair(value string) (uint64, uint64) {
+	first, second, _ := strings.Cut(value, "/")
+	return parseSize(first), parseSize(second)
+}
+
+// parseSize parses a size such as 1.2kB or 3.8GiB, zero when it cannot
+func parseSize(value string) uint64 {
+	value = strings.TrimSpace(value)
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"B", 1},
+	}
+	for _, u := range units {
+		if number, ok := strings.CutSuffix(value, u.suffix); ok {
+			n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil {
+				return 0
+			}
+			return uint64(n * u.scale)
+		}
+	}
+	return 0
+}
+
+// StatsMonitor samples reddock containers on every runtime and host
+type StatsMonitor struct {
+	config  *config.Config
+	runtime Runtime
+}
+
+func NewStatsMonitor() *StatsMonitor {
+	return NewStatsMonitorWith(config.NewFileStore(), nil)
+}
+
+func NewStatsMonitorWith(store config.Store, runtime Runtime) *StatsMonitor {
+	return &StatsMonitor{config: config.LoadOrDefault(store), runtime: runtime}
+}
+
+// Sample leaves out the containers that could not be sampled and reports them
+func (m *StatsMonitor) Sample(ctx context.Context, names []string) ([]*ContainerStats, error) {
+	containers := m.config.ListContainers()
+	if len(names) > 0 {
+		containers = nil
+		for _, name := range names {
+			c := m.config.GetContainer(name)
+			if c == nil {
+				return nil, notFoundError(name)
+			}
+			containers = append(containers, c)
+		}
+	}
+
+	runtimes := make(map[string]Runtime)
+	for _, c := range containers {
+		key := c.Runtime + "|" + c.Host
+		if _, ok := runtimes[key]; !ok {
+			runtime := m.runtime
+			if runtime == nil {
+				runtime = NewRuntimeForContainer(m.config, c)
+			}
+			runtimes[key] = runtime
+		}
+	}
+
+	samples := make([]*ContainerStats, len(containers))
+	results := make([]BulkResult, len(containers))
+	var wg sync.WaitGroup
+	for i, c := range containers {
+		wg.Add(1)
+		go func(i int, c *config.Container, runtime Runtime) {
+			defer wg.Done()
+			results[i].Name = c.Name
+			stats := &ContainerStats{Name: c.Name}
+			if runtime.IsRunning(ctx, c.Name) {
+				var err error
+				stats, err = runtime.Stats(ctx, c.Name)
+				if errors.Is(err, ErrContainerNotFound) {
+					// Removed since it was checked
+					stats, err = &ContainerStats{Name: c.Name}, nil
+				}
+				if err != nil {
+					results[i].Err = err
+					return
+				}
+			}
+			stats.Host = c.Host
+			samples[i] = stats
+		}(i, c, runtimes[c.Runtime+"|"+c.Host])
+	}
+	wg.Wait()
+
+	var sampled []*ContainerStats
+	for _, s := range samples {
+		if s != nil {
+			sampled = append(sampled, s)
+		}
+	}
+	if ctx.Err() != nil {
+		return sampled, ContextError(ctx, ctx.Err())
+	}
+	return sampled, NewBulkError("report stats", results)
+}
+
+// Watch prints a fresh table every interval until ctx ends
+func (m *StatsMonitor) Watch(ctx context.Context, names []string, out io.Writer, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultStatsInterval
+	}
+	for {
+		samples, err := m.Sample(ctx, names)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var bulkErr *BulkError
+		if err != nil && !errors.As(err, &bulkErr) {
+			return err
+		}
+		// Clear the screen and move the cursor home, as top does
+		fmt.Fprint(out, "\033[H\033[2J")
+		fmt.Fprintf(out, "Every %s: reddock stats%s\n\n", interval, time.Now().Format("  15:04:05"))
+		PrintStats(out, samples)
+		if bulkErr != nil {
+			for _, r := range bulkErr.Failed {
+				fmt.Fprintf(out, "%s: %v\n", r.Name, r.Err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// PrintStats writes samples as a table like "docker stats"
+func PrintStats(w io.Writer, samples []*ContainerStats) {
+	if len(samples) == 0 {
+		fmt.Fprintln(w, "No Reddock containers found.")
+		return
+	}
+	fmt.Fprintf(w, "%-20s %7s %-21s %6s %-21s %-21s %5s\n",
+		"NAME", "CPU %", "MEM USAGE / LIMIT", "MEM %", "NET I/O", "BLOCK I/O", "PIDS")
+	for _, s := range samples {
+		if !s.Running {
+			fmt.Fprintf(w, "%-20s %7s %-21s %6s %-21s %-21s %5s\n", s.Name, "--", "not running", "--", "--", "--", "--")
+			continue
+		}
+		fmt.Fprintf(w, "%-20s %6.2f%% %-21s %5.1f%% %-21s %-21s %5d\n", s.Name, s.CPUPercent,
+			sizePair(s.MemoryUsage, s.MemoryLimit), s.MemoryPercent(),
+			sizePair(s.NetworkRx, s.NetworkTx), sizePair(s.BlockRead, s.BlockWrite), s.PIDs)
+	}
+}
+
+func sizePair(a, b uint64) string {
+	return formatBytes(int64(a)) + " / " + formatBytes(int64(b))
+}
+
+// PrintStatsJSON writes samples as one JSON array
+func PrintStatsJSON(w io.Writer, samples []*ContainerStats) error {
+	if samples == nil {
+		samples = []*ContainerStats{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(samples)
+}
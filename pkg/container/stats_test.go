@@ -0,0 +1,85 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEngineStatsLikeDockerStats(t *testing.T) {
+	doc := `{
+		"cpu_stats": {"cpu_usage": {"total_usage": 3000000000}, "system_cpu_usage": 20000000000, "online_cpus": 4},
+		"precpu_stats": {"cpu_usage": {"total_usage": 2000000000}, "system_cpu_usage": 10000000000},
+		"memory_stats": {"usage": 2000000000, "limit": 4000000000, "stats": {"inactive_file": 500000000}},
+		"networks": {"eth0": {"rx_bytes": 1000, "tx_bytes": 2000}, "eth1": {"rx_bytes": 10, "tx_bytes": 20}},
+		"blkio_stats": {"io_service_bytes_recursive": [{"op": "read", "value": 4096}, {"op": "Write", "value": 8192}]},
+		"pids_stats": {"current": 312}
+	}`
+	var stats engineStatsJSON
+	if err := json.Unmarshal([]byte(doc), &stats); err != nil {
+		t.Fatal(err)
+	}
+	got := stats.stats("android")
+	want := ContainerStats{Name: "android", Running: true, CPUPercent: 40, MemoryUsage: 1500000000, MemoryLimit: 4000000000,
+		NetworkRx: 1010, NetworkTx: 2020, BlockRead: 4096, BlockWrite: 8192, PIDs: 312}
+	if *got != want {
+		t.Fatalf("stats = %+v, want %+v", *got, want)
+	}
+	if got.MemoryPercent() != 37.5 {
+		t.Errorf("memory percent = %v", got.MemoryPercent())
+	}
+}
+
+func TestCLIStatsParsesSizes(t *testing.T) {
+	line := `{"Name":"android","CPUPerc":"12.50%","MemUsage":"1.5GiB / 4GiB","NetIO":"1.2kB / 648B","BlockIO":"3MB / 0B","PIDs":"97"}`
+	var doc cliStatsJSON
+	if err := json.Unmarshal([]byte(line), &doc); err != nil {
+		t.Fatal(err)
+	}
+	got := doc.stats("android")
+	want := ContainerStats{Name: "android", Running: true, CPUPercent: 12.5, MemoryUsage: 1.5 * (1 << 30), MemoryLimit: 4 << 30,
+		NetworkRx: 1200, NetworkTx: 648, BlockRead: 3000000, PIDs: 97}
+	if *got != want {
+		t.Fatalf("stats = %+v, want %+v", *got, want)
+	}
+}
+
+func TestStatsMonitorSample(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["busy"] = &fakeContainer{running: true,
+		stats: &ContainerStats{Running: true, CPUPercent: 180, MemoryUsage: 3 << 30, MemoryLimit: 4 << 30, PIDs: 400}}
+	store := newMemStore(testContainer(t, "busy"), testContainer(t, "idle"))
+	monitor := NewStatsMonitorWith(store, rt)
+
+	samples, err := monitor.Sample(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Sample: %v", err)
+	}
+	if len(samples) != 2 || samples[0].Name != "busy" || samples[0].CPUPercent != 180 || samples[1].Running {
+		t.Fatalf("samples = %+v", samples)
+	}
+	if rt.called("Stats idle") {
+		t.Error("a stopped container was sampled")
+	}
+
+	var table bytes.Buffer
+	PrintStats(&table, samples)
+	if !strings.Contains(table.String(), "180.00%") || !strings.Contains(table.String(), "not running") {
+		t.Errorf("table:\n%s", table.String())
+	}
+	var out bytes.Buffer
+	if err := PrintStatsJSON(&out, samples); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []ContainerStats
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 2 || decoded[0].PIDs != 400 {
+		t.Fatalf("json = %s, %v", out.String(), err)
+	}
+
+	if _, err := monitor.Sample(context.Background(), []string{"missing"}); err == nil {
+		t.Error("unknown container sampled")
+	}
+}
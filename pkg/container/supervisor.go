@@ -0,0 +1,277 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"reddock/pkg/config"
+)
+
+const (
+	DefaultSuperviseInterval = 30 * time.Second
+	// unhealthyThreshold failed checks in a row restart a running container
+	unhealthyThreshold = 3
+	probeTimeout       = 15 * time.Second
+)
+
+var adbReachable = func(ctx context.Context, address string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+type healthStatus int
+
+const (
+	healthOK healthStatus = iota
+	healthBooting
+	healthPaused
+	healthStopped
+	healthFailing
+	healthUnreachable
+)
+
+type health struct {
+	status   healthStatus
+	reason   string
+	exitCode int
+}
+
+type superviseState struct {
+	failures    int
+	restarts    int
+	nextRestart time.Time
+	gaveUp      bool
+	// runningSince stands in for engines that do not report the start time
+	runningSince time.Time
+	last         string
+}
+
+// Supervisor restarts unhealthy containers according to their restart policy
+type Supervisor struct {
+	store    config.Store
+	runtime  Runtime
+	logger   *log.Logger
+	interval time.Duration
+	states   map[string]*superviseState
+}
+
+func NewSupervisor(interval time.Duration) *Supervisor {
+	return NewSupervisorWith(config.NewFileStore(), nil, os.Stdout, interval)
+}
+
+func NewSupervisorWith(store config.Store, runtime Runtime, out io.Writer, interval time.Duration) *Supervisor {
+	if interval <= 0 {
+		interval = DefaultSuperviseInterval
+	}
+	return &Supervisor{
+		store:    store,
+		runtime:  runtime,
+		logger:   log.New(out, "", log.LstdFlags),
+		interval: interval,
+		states:   make(map[string]*superviseState),
+	}
+}
+
+// Run checks the named containers, or every initialized one, until ctx ends
+func (s *Supervisor) Run(ctx context.Context, names []string) error {
+	cfg := config.LoadOrDefault(s.store)
+	for _, name := range names {
+		if cfg.GetContainer(name) == nil {
+			return notFoundError(name)
+		}
+	}
+
+	if len(names) == 0 {
+		s.logger.Printf("Supervising all containers, checking every %s", s.interval)
+	} else {
+		s.logger.Printf("Supervising %v, checking every %s", names, s.interval)
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.check(ctx, names)
+		select {
+		case <-ctx.Done():
+			s.logger.Printf("Supervisor stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Supervisor) check(ctx context.Context, names []string) {
+	if len(names) == 0 {
+		cfg := config.LoadOrDefault(s.store)
+		for name, c := range cfg.Containers {
+			if c.Initialized {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		s.checkContainer(ctx, name)
+	}
+}
+
+func (s *Supervisor) checkContainer(ctx context.Context, name string) {
+	m := NewManagerWith(s.store, s.runtime, name)
+	container := m.GetContainer()
+	if container == nil || !container.Initialized {
+		delete(s.states, name)
+		return
+	}
+	st := s.states[name]
+	if st == nil {
+		st = &superviseState{}
+		s.states[name] = st
+	}
+
+	h := s.probe(ctx, m, container, st)
+	policy := container.RestartPolicy()
+	switch h.status {
+	case healthOK:
+		*st = superviseState{runningSince: st.runningSince, last: st.last}
+		s.report(name, st, "healthy")
+	case healthBooting:
+		s.report(name, st, "booting")
+	case healthPaused:
+		s.report(name, st, "paused, not probed")
+	case healthUnreachable:
+		s.report(name, st, "cannot be inspected: "+h.reason)
+	case healthStopped:
+		switch {
+		case container.Stopped:
+			s.report(name, st, "stopped with 'reddock stop', not restarting")
+		case policy == config.RestartNo:
+			s.report(name, st, fmt.Sprintf("%s, restart policy is %s", h.reason, policy))
+		case policy == config.RestartOnFailure && h.exitCode == 0:
+			s.report(name, st, fmt.Sprintf("%s, restart policy is %s", h.reason, policy))
+		default:
+			s.restart(ctx, m, container, st, h.reason)
+		}
+	case healthFailing:
+		st.failures++
+		if st.failures < unhealthyThreshold {
+			s.logf(name, "health check failed (%d/%d): %s", st.failures, unhealthyThreshold, h.reason)
+			st.last = ""
+			return
+		}
+		if policy == config.RestartNo {
+			s.report(name, st, fmt.Sprintf("unhealthy: %s, restart policy is %s", h.reason, policy))
+			return
+		}
+		s.restart(ctx, m, container, st, "unhealthy: "+h.reason)
+	}
+}
+
+// probe counts a container within its boot timeout as booting, not failing
+func (s *Supervisor) probe(ctx context.Context, m *Manager, container *config.Container, st *superviseState) health {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	info, err := m.runtime.InspectContainer(ctx, m.containerName)
+	if errors.Is(err, ErrContainerNotFound) {
+		st.runningSince = time.Time{}
+		return health{status: healthStopped, reason: "container does not exist"}
+	}
+	if err != nil {
+		return health{status: healthUnreachable, reason: err.Error()}
+	}
+	if !info.Running {
+		st.runningSince = time.Time{}
+		return health{status: healthStopped, reason: fmt.Sprintf("exited with code %d", info.ExitCode), exitCode: info.ExitCode}
+	}
+	if info.Paused {
+		return health{status: healthPaused}
+	}
+
+	startedAt := info.StartedAt
+	if startedAt.IsZero() {
+		if st.runningSince.IsZero() {
+			st.runningSince = time.Now()
+		}
+		startedAt = st.runningSince
+	}
+
+	// Without exec or adb the boot state is unknown, ADB still is probed
+	booted, err := m.bootCompleted(ctx, container)
+	if err == nil && !booted {
+		if time.Since(startedAt) < m.config.Timeout(config.OpBoot) {
+			return health{status: healthBooting}
+		}
+		return health{status: healthFailing, reason: "sys.boot_completed is not 1"}
+	}
+
+	// The host cannot reach its own macvlan containers
+	if container.NetworkMode() == config.NetworkMacvlan {
+		return health{status: healthOK}
+	}
+	address := mappedADBAddress(container, info)
+	if err := adbReachable(ctx, address); err != nil {
+		return health{status: healthFailing, reason: fmt.Sprintf("ADB at %s is unreachable", address)}
+	}
+	return health{status: healthOK}
+}
+
+func (s *Supervisor) restart(ctx context.Context, m *Manager, container *config.Container, st *superviseState, reason string) {
+	name := m.containerName
+	if st.gaveUp {
+		return
+	}
+	if container.RestartMax > 0 && st.restarts >= container.RestartMax {
+		st.gaveUp = true
+		s.logf(name, "giving up after %d restarts: %s", st.restarts, reason)
+		return
+	}
+	if time.Now().Before(st.nextRestart) {
+		s.report(name, st, fmt.Sprintf("%s, next restart at %s", reason, st.nextRestart.Format("15:04:05")))
+		return
+	}
+
+	st.restarts++
+	st.failures = 0
+	st.nextRestart = time.Now().Add(container.RestartBackoff(st.restarts))
+	st.last = ""
+	s.logf(name, "restarting (attempt %d): %s", st.restarts, reason)
+
+	var err error
+	if m.IsRunning(ctx) {
+		err = m.Restart(ctx, false)
+	} else {
+		err = m.Start(ctx, false)
+	}
+	if err != nil {
+		s.logf(name, "restart failed: %v", err)
+		return
+	}
+	st.runningSince = time.Time{}
+	s.logf(name, "restarted")
+}
+
+func (s *Supervisor) report(name string, st *superviseState, status string) {
+	if st.last == status {
+		return
+	}
+	st.last = status
+	s.logf(name, "%s", status)
+}
+
+func (s *Supervisor) logf(name, format string, args ...interface{}) {
+	s.logger.Printf("%s: %s", name, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,183 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"reddock/pkg/config"
+)
+
+// stubADB makes the ADB probe return err
+func stubADB(t *testing.T, err error) {
+	t.Helper()
+	orig := adbReachable
+	adbReachable = func(ctx context.Context, address string) error { return err }
+	t.Cleanup(func() { adbReachable = orig })
+}
+
+func newTestSupervisor(t *testing.T, rt *fakeRuntime, c *config.Container) (*Supervisor, *bytes.Buffer) {
+	t.Helper()
+	var out bytes.Buffer
+	return NewSupervisorWith(newMemStore(c), rt, &out, time.Millisecond), &out
+}
+
+func TestSuperviseRestartsCrashedContainer(t *testing.T) {
+	stubHost(t)
+	stubADB(t, nil)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{exitCode: 137}
+	c := createdContainer(t, "android")
+	c.Restart = config.RestartOnFailure
+	s, out := newTestSupervisor(t, rt, c)
+
+	s.check(context.Background(), nil)
+
+	if !rt.called("StartExisting android") {
+		t.Fatalf("crashed container not restarted, calls = %v", rt.calls)
+	}
+	if !strings.Contains(out.String(), "android: restarting (attempt 1): exited with code 137") {
+		t.Fatalf("restart not logged:\n%s", out.String())
+	}
+}
+
+func TestSuperviseRespectsPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		stopped  bool
+		exitCode int
+	}{
+		{"policy no", config.RestartNo, false, 137},
+		{"clean exit on-failure", config.RestartOnFailure, false, 0},
+		{"stopped by user", config.RestartAlways, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubHost(t)
+			rt := newFakeRuntime()
+			rt.containers["android"] = &fakeContainer{exitCode: tt.exitCode}
+			c := testContainer(t, "android")
+			c.Restart = tt.policy
+			c.Stopped = tt.stopped
+			s, _ := newTestSupervisor(t, rt, c)
+
+			s.check(context.Background(), nil)
+
+			if rt.called("StartExisting") || rt.called("Run") {
+				t.Fatalf("container should be left alone, calls = %v", rt.calls)
+			}
+		})
+	}
+}
+
+func TestSuperviseRestartsUnhealthyContainer(t *testing.T) {
+	stubHost(t)
+	stubADB(t, errors.New("connection refused"))
+	rt := newFakeRuntime()
+	rt.execOutput = "1"
+	rt.containers["android"] = &fakeContainer{running: true}
+	c := createdContainer(t, "android")
+	c.Restart = config.RestartAlways
+	s, out := newTestSupervisor(t, rt, c)
+
+	for i := 1; i < unhealthyThreshold; i++ {
+		s.check(context.Background(), nil)
+	}
+	if rt.called("Stop") {
+		t.Fatalf("restarted before %d failed checks", unhealthyThreshold)
+	}
+	s.check(context.Background(), nil)
+
+	if !rt.called("Stop android") || !rt.called("StartExisting android") {
+		t.Fatalf("unhealthy container not restarted, calls = %v", rt.calls)
+	}
+	if !strings.Contains(out.String(), "ADB at localhost:5555 is unreachable") {
+		t.Fatalf("probe failure not logged:\n%s", out.String())
+	}
+}
+
+func TestSuperviseBacksOffAndGivesUp(t *testing.T) {
+	stubHost(t)
+	stubADB(t, nil)
+	rt := newFakeRuntime()
+	rt.failOn("StartExisting", errors.New("binder missing"))
+	rt.containers["android"] = &fakeContainer{exitCode: 1}
+	c := createdContainer(t, "android")
+	c.Restart = config.RestartAlways
+	c.RestartMax = 2
+	s, out := newTestSupervisor(t, rt, c)
+	ctx := context.Background()
+
+	s.check(ctx, nil)
+	s.check(ctx, nil)
+	if got := strings.Count(out.String(), "restarting (attempt"); got != 1 {
+		t.Fatalf("restarted %d times within the backoff, want 1:\n%s", got, out.String())
+	}
+
+	s.states["android"].nextRestart = time.Time{}
+	s.check(ctx, nil)
+	s.states["android"].nextRestart = time.Time{}
+	s.check(ctx, nil)
+	s.check(ctx, nil)
+
+	if got := strings.Count(out.String(), "restarting (attempt"); got != 2 {
+		t.Fatalf("restarted %d times, want restart-max 2:\n%s", got, out.String())
+	}
+	if strings.Count(out.String(), "giving up after 2 restarts") != 1 {
+		t.Fatalf("giving up not logged once:\n%s", out.String())
+	}
+}
+
+func TestSuperviseHealthyContainer(t *testing.T) {
+	stubHost(t)
+	stubADB(t, nil)
+	rt := newFakeRuntime()
+	rt.execOutput = "1"
+	rt.containers["android"] = &fakeContainer{running: true}
+	c := testContainer(t, "android")
+	c.Restart = config.RestartAlways
+	s, out := newTestSupervisor(t, rt, c)
+
+	s.check(context.Background(), nil)
+	s.check(context.Background(), nil)
+
+	if rt.called("Stop") || rt.called("StartExisting") {
+		t.Fatalf("healthy container restarted, calls = %v", rt.calls)
+	}
+	if got := strings.Count(out.String(), "android: healthy"); got != 1 {
+		t.Fatalf("healthy logged %d times, want 1:\n%s", got, out.String())
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	c := &config.Container{RestartDelay: "20s"}
+	for attempt, want := range map[int]time.Duration{1: 20 * time.Second, 2: 40 * time.Second, 5: 5 * time.Minute} {
+		if got := c.RestartBackoff(attempt); got != want {
+			t.Errorf("RestartBackoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestStopMarksContainerStopped(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	rt.containers["android"] = &fakeContainer{running: true}
+	store := newMemStore(testContainer(t, "android"))
+
+	if err := NewManagerWith(store, rt, "android").Stop(context.Background(), false); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !store.cfg.GetContainer("android").Stopped {
+		t.Fatal("stop should mark the container as stopped")
+	}
+	if err := NewManagerWith(store, rt, "android").Start(context.Background(), false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if store.cfg.GetContainer("android").Stopped {
+		t.Fatal("start should clear the stopped mark")
+	}
+}
@@ -0,0 +1,201 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"reddock/pkg/config"
+)
+
+// Kinds of drift between the config and the runtime
+const (
+	// DriftUntracked is a labelled container missing from the config
+	DriftUntracked = "untracked"
+	// DriftMissing is a config entry whose container vanished while not stopped
+	DriftMissing = "missing"
+	// DriftImage is a container running another image than configured
+	DriftImage = "image"
+)
+
+var driftFixes = map[string]string{
+	DriftUntracked: "adopt into the config",
+	DriftMissing:   "mark stopped, the next start recreates it",
+	DriftImage:     "recreate from the configured image",
+}
+
+type Drift struct {
+	Name   string
+	Kind   string
+	Detail string
+}
+
+type SyncReport struct {
+	Drifts  []Drift
+	Checked int
+}
+
+// Print writes one line per drifted container with its fix
+func (r *SyncReport) Print(w io.Writer) {
+	if len(r.Drifts) == 0 {
+		fmt.Fprintf(w, "No drift, %d containers in sync\n", r.Checked)
+		return
+	}
+	for _, d := range r.Drifts {
+		fmt.Fprintf(w, "  %-20s %-10s %s\n", d.Name, d.Kind, d.Detail)
+		fmt.Fprintf(w, "  %-20s %-10s fix: %s\n", "", "", driftFixes[d.Kind])
+	}
+	fmt.Fprintf(w, "%d of %d containers drifted\n", len(r.Drifts), r.Checked)
+}
+
+// Syncer reconciles the config with the containers of the runtime
+type Syncer struct {
+	store   config.Store
+	runtime Runtime
+	out     io.Writer
+}
+
+func NewSyncer() *Syncer {
+	return NewSyncerWith(config.NewFileStore(), nil, os.Stdout)
+}
+
+func NewSyncerWith(store config.Store, runtime Runtime, out io.Writer) *Syncer {
+	return &Syncer{store: store, runtime: runtime, out: out}
+}
+
+// Check compares the config with the runtime without changing either
+func (s *Syncer) Check(ctx context.Context) (*SyncReport, error) {
+	cfg := config.LoadOrDefault(s.store)
+	report := &SyncReport{}
+
+	runtime := s.runtime
+	if runtime == nil {
+		runtime = NewRuntimeFromConfig(cfg)
+	}
+	containers, err := runtime.ListContainers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list %s containers: %w", runtime.Name(), err)
+	}
+	for _, info := range containers {
+		if info.Managed() && cfg.GetContainer(info.Name) == nil {
+			report.Checked++
+			report.Drifts = append(report.Drifts, Drift{Name: info.Name, Kind: DriftUntracked,
+				Detail: "created by reddock but not in the config"})
+		}
+	}
+
+	// As in list, an unreachable host is skipped as a whole
+	runtimes := make(map[string]Runtime)
+	unreachable := make(map[string]bool)
+	for _, c := range cfg.ListContainers() {
+		if !c.Initialized || unreachable[c.Host] {
+			continue
+		}
+		key := c.Runtime + "|" + c.Host
+		runtime, ok := runtimes[key]
+		if s.runtime != nil {
+			runtime, ok = s.runtime, true
+		}
+		if !ok {
+			runtime = NewRuntimeForContainer(cfg, c)
+			runtimes[key] = runtime
+		}
+
+		info, err := runtime.InspectContainer(ctx, c.Name)
+		switch {
+		case errors.Is(err, ErrRuntimeUnavailable):
+			fmt.Fprintf(s.out, "Warning: Skipping the containers on %s: %v\n", hostLabel(c.Host), err)
+			unreachable[c.Host] = true
+			continue
+		case errors.Is(err, ErrContainerNotFound):
+			// Never started, or stopped with --rm, is not drift
+			if c.RunSpec != "" && !c.Stopped {
+				report.Drifts = append(report.Drifts, Drift{Name: c.Name, Kind: DriftMissing,
+					Detail: fmt.Sprintf("its %s container vanished", runtime.Name())})
+			}
+		case err != nil:
+			return nil, fmt.Errorf("Failed to inspect container '%s': %w", c.Name, err)
+		case !sameImage(info.Image, c.ImageURL):
+			report.Drifts = append(report.Drifts, Drift{Name: c.Name, Kind: DriftImage,
+				Detail: fmt.Sprintf("runs %s, configured %s", info.Image, c.ImageURL)})
+		}
+		report.Checked++
+	}
+
+	sort.Slice(report.Drifts, func(i, j int) bool { return report.Drifts[i].Name < report.Drifts[j].Name })
+	return report, nil
+}
+
+func (s *Syncer) Fix(ctx context.Context, report *SyncReport) error {
+	var results []BulkResult
+	for _, d := range report.Drifts {
+		if err := ctx.Err(); err != nil {
+			results = append(results, BulkResult{Name: d.Name, Err: ContextError(ctx, err)})
+			continue
+		}
+		started := time.Now()
+		err := s.fix(ctx, d)
+		results = append(results, BulkResult{Name: d.Name, Err: err, Elapsed: time.Since(started)})
+		if err != nil {
+			fmt.Fprintf(s.out, "✘ %s: %v\n", d.Name, err)
+		}
+	}
+	err := NewBulkError("sync", results)
+	if err == nil {
+		fmt.Fprintf(s.out, "Fixed %d containers\n", len(report.Drifts))
+	}
+	return err
+}
+
+func (s *Syncer) fix(ctx context.Context, d Drift) error {
+	switch d.Kind {
+	case DriftUntracked:
+		return NewAdopterWith(s.store, s.runtime).Adopt(ctx, d.Name)
+	case DriftMissing:
+		lock, err := lockContainer(d.Name, "sync")
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+		cfg := config.LoadOrDefault(s.store)
+		c := cfg.GetContainer(d.Name)
+		if c == nil {
+			return notFoundError(d.Name)
+		}
+		c.Stopped = true
+		if err := s.store.Save(cfg); err != nil {
+			return fmt.Errorf("Failed to save config: %v", err)
+		}
+		fmt.Fprintf(s.out, "Container '%s' marked stopped\n", d.Name)
+		return nil
+	case DriftImage:
+		manager := NewManagerWith(s.store, s.runtime, d.Name)
+		running := manager.runtime.IsRunning(ctx, d.Name)
+		if err := manager.Stop(ctx, true); err != nil {
+			return err
+		}
+		if !running {
+			return nil
+		}
+		return NewManagerWith(s.store, s.runtime, d.Name).Start(ctx, false)
+	}
+	return fmt.Errorf("Unknown drift '%s'", d.Kind)
+}
+
+// sameImage ignores the docker.io registry and library namespace engines add
+func sameImage(a, b string) bool {
+	normalize := func(image string) string {
+		image = strings.TrimPrefix(image, "docker.io/")
+		image = strings.TrimPrefix(image, "library/")
+		if !strings.Contains(image[strings.LastIndex(image, "/")+1:], ":") && !strings.Contains(image, "@") {
+			image += ":latest"
+		}
+		return image
+	}
+	return normalize(a) == normalize(b)
+}
@@ -0,0 +1,68 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func driftKinds(report *SyncReport) map[string]string {
+	kinds := make(map[string]string)
+	for _, d := range report.Drifts {
+		kinds[d.Name] = d.Kind
+	}
+	return kinds
+}
+
+func TestSyncReportsAndFixesDrift(t *testing.T) {
+	stubHost(t)
+	rt := newFakeRuntime()
+	managed := map[string]string{LabelManaged: "true", LabelName: "orphan"}
+	rt.containers["orphan"] = &fakeContainer{image: "redroid/redroid:13.0.0-latest", labels: managed}
+	rt.containers["other"] = &fakeContainer{image: "nginx:latest"}
+	rt.containers["swapped"] = &fakeContainer{image: "redroid/redroid:11.0.0-latest", running: true}
+	rt.containers["fine"] = &fakeContainer{image: "docker.io/redroid/redroid:13.0.0-latest"}
+
+	vanished := testContainer(t, "vanished")
+	vanished.RunSpec = "0123456789abcdef"
+	neverStarted := testContainer(t, "fresh")
+	fine := testContainer(t, "fine")
+	vanished.Port, neverStarted.Port, fine.Port = 5601, 5602, 5603
+	store := newMemStore(vanished, neverStarted, testContainer(t, "swapped"), fine)
+	syncer := NewSyncerWith(store, rt, &bytes.Buffer{})
+
+	report, err := syncer.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	want := map[string]string{"orphan": DriftUntracked, "vanished": DriftMissing, "swapped": DriftImage}
+	got := driftKinds(report)
+	if len(got) != len(want) {
+		t.Fatalf("drift = %v, want %v", got, want)
+	}
+	for name, kind := range want {
+		if got[name] != kind {
+			t.Errorf("%s: drift %q, want %q", name, got[name], kind)
+		}
+	}
+
+	if err := syncer.Fix(context.Background(), report); err != nil {
+		t.Fatalf("Fix: %v", err)
+	}
+	if store.cfg.GetContainer("orphan") == nil {
+		t.Error("untracked container not adopted")
+	}
+	if !store.cfg.GetContainer("vanished").Stopped {
+		t.Error("vanished container not marked stopped")
+	}
+	if !rt.called("Remove swapped") || !rt.called("Run swapped") || rt.containers["swapped"].image != "redroid/redroid:13.0.0-latest" {
+		t.Errorf("swapped container not recreated, calls = %v", rt.calls)
+	}
+
+	report, _ = syncer.Check(context.Background())
+	if len(report.Drifts) != 0 {
+		var out bytes.Buffer
+		report.Print(&out)
+		t.Fatalf("drift left after fixing:\n%s", out.String())
+	}
+}
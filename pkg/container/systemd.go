@@ -0,0 +1,238 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"reddock/pkg/config"
+)
+
+const (
+	// SystemdUnitDir is where --install places the generated units
+	SystemdUnitDir = "/etc/systemd/system"
+	// BinderUnitName sets up binder once per boot, before any container
+	BinderUnitName = "reddock-binder.service"
+)
+
+// UnitFile is a generated systemd unit
+type UnitFile struct {
+	Name    string
+	Content string
+}
+
+// ContainerUnitName returns the name of the service wrapping a container
+func ContainerUnitName(containerName string) string {
+	return "reddock-" + containerName + ".service"
+}
+
+// SystemdGenerator writes units that bring containers back after a reboot
+type SystemdGenerator struct {
+	store      config.Store
+	config     *config.Config
+	runtime    Runtime
+	executable string
+}
+
+func NewSystemdGenerator() *SystemdGenerator {
+	return NewSystemdGeneratorWith(config.NewFileStore(), nil, "")
+}
+
+func NewSystemdGeneratorWith(store config.Store, runtime Runtime, executable string) *SystemdGenerator {
+	return &SystemdGenerator{
+		store:      store,
+		config:     config.LoadOrDefault(store),
+		runtime:    runtime,
+		executable: executable,
+	}
+}
+
+// Units generates the services of the named containers and the binder unit
+func (g *SystemdGenerator) Units(names []string) ([]UnitFile, error) {
+	if len(names) == 0 {
+		for name, c := range g.config.Containers {
+			if c.Initialized {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("No initialized containers to generate units for")
+		}
+		sort.Strings(names)
+	}
+
+	executable, err := g.reddockPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var units []UnitFile
+	needsBinder := false
+	for _, name := range names {
+		c := g.config.GetContainer(name)
+		if c == nil {
+			return nil, notFoundError(name)
+		}
+		if !c.Initialized {
+			return nil, NewError(ErrNotInitialized, name,
+				"Container '%s' is not initialized. Run 'reddock init %s' first", name, name)
+		}
+		if !c.IsRemote() {
+			needsBinder = true
+		}
+		units = append(units, g.containerUnit(c, executable))
+	}
+	if needsBinder {
+		units = append([]UnitFile{binderUnit()}, units...)
+	}
+	return units, nil
+}
+
+func (g *SystemdGenerator) reddockPath() (string, error) {
+	if g.executable != "" {
+		return g.executable, nil
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("Failed to locate the reddock binary: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	return executable, nil
+}
+
+// binderUnit sets up binder the way init does, a failed modprobe is not fatal
+func binderUnit() UnitFile {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Binder devices for Reddock containers\n")
+	b.WriteString("Before=docker.service containerd.service podman.service\n")
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=oneshot\n")
+	b.WriteString("RemainAfterExit=yes\n")
+	b.WriteString("ExecStart=-modprobe binder_linux devices=binder,hwbinder,vndbinder\n")
+	b.WriteString("ExecStart=/bin/sh -c 'if grep -qw binder /proc/filesystems && ! mountpoint -q /dev/binderfs; then mkdir -p /dev/binderfs && mount -t binder binder /dev/binderfs; fi'\n")
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+	return UnitFile{Name: BinderUnitName, Content: b.String()}
+}
+
+// containerUnit wraps reddock start and stop
+func (g *SystemdGenerator) containerUnit(c *config.Container, executable string) UnitFile {
+	after := []string{"network-online.target"}
+	wants := []string{"network-online.target"}
+	if !c.IsRemote() {
+		after = append(after, BinderUnitName)
+		if unit := g.runtimeUnit(c); unit != "" {
+			after = append(after, unit)
+			wants = append(wants, unit)
+		}
+	}
+
+	startTimeout := g.config.Timeout(config.OpStart) + g.config.Timeout(config.OpRemove)
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=Reddock container %s\n", c.Name)
+	if !c.IsRemote() {
+		fmt.Fprintf(&b, "Requires=%s\n", BinderUnitName)
+	}
+	fmt.Fprintf(&b, "Wants=%s\n", strings.Join(wants, " "))
+	fmt.Fprintf(&b, "After=%s\n", strings.Join(after, " "))
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=oneshot\n")
+	b.WriteString("RemainAfterExit=yes\n")
+	// systemd sets no $HOME for root, so pin the config the units came from
+	fmt.Fprintf(&b, "Environment=\"%s=%s\"\n", config.ConfigEnvVar, g.configPath())
+	fmt.Fprintf(&b, "ExecStart=%s start %s\n", executable, c.Name)
+	fmt.Fprintf(&b, "ExecStop=%s stop %s\n", executable, c.Name)
+	fmt.Fprintf(&b, "TimeoutStartSec=%d\n", int(startTimeout.Seconds()))
+	fmt.Fprintf(&b, "TimeoutStopSec=%d\n", int(g.config.Timeout(config.OpStop).Seconds()))
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+	return UnitFile{Name: ContainerUnitName(c.Name), Content: b.String()}
+}
+
+// configPath is absolute since units do not run in the current directory
+func (g *SystemdGenerator) configPath() string {
+	path := config.GetConfigPath()
+	if store, ok := g.store.(*config.FileStore); ok {
+		path = store.Path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return path
+}
+
+// runtimeUnit names the engine unit of a container, empty for daemonless runtimes
+func (g *SystemdGenerator) runtimeUnit(c *config.Container) string {
+	runtime := g.runtime
+	if runtime == nil {
+		runtime = NewRuntimeForContainer(g.config, c)
+	}
+	switch r := runtime.(type) {
+	case *EngineRuntime:
+		return "docker.service"
+	case *PodmanRuntime:
+		return "podman.socket"
+	case *NerdctlRuntime:
+		return "containerd.service"
+	case *GenericRuntime:
+		if r.binary == "docker" {
+			return "docker.service"
+		}
+	}
+	return ""
+}
+
+func (g *SystemdGenerator) Write(units []UnitFile, dir string) ([]string, error) {
+	var paths []string
+	for _, unit := range units {
+		path := filepath.Join(dir, unit.Name)
+		if err := os.WriteFile(path, []byte(unit.Content), 0644); err != nil {
+			return paths, fmt.Errorf("Failed to write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Install places the units in the systemd unit directory and enables them
+func (g *SystemdGenerator) Install(ctx context.Context, units []UnitFile) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	paths, err := g.Write(units, SystemdUnitDir)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fmt.Printf("Wrote %s\n", path)
+	}
+
+	if err := systemctl(ctx, "daemon-reload"); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(units))
+	for _, unit := range units {
+		names = append(names, unit.Name)
+	}
+	if err := systemctl(ctx, append([]string{"enable"}, names...)...); err != nil {
+		return err
+	}
+	fmt.Printf("Enabled %s\n", strings.Join(names, ", "))
+	return nil
+}
+
+func systemctl(ctx context.Context, args ...string) error {
+	output, err := exec.CommandContext(ctx, "systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Failed to run systemctl %s: %v %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"reddock/pkg/config"
+)
+
+func TestSystemdUnits(t *testing.T) {
+	local := testContainer(t, "android")
+	remote := testContainer(t, "farm")
+	remote.Host = "tcp://10.0.0.5:2375"
+	store := newMemStore(local, remote)
+	gen := NewSystemdGeneratorWith(store, &GenericRuntime{binary: "docker"}, "/usr/local/bin/reddock")
+
+	units, err := gen.Units(nil)
+	if err != nil {
+		t.Fatalf("Units: %v", err)
+	}
+	var names []string
+	for _, unit := range units {
+		names = append(names, unit.Name)
+	}
+	want := []string{BinderUnitName, "reddock-android.service", "reddock-farm.service"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("units = %v, want %v", names, want)
+	}
+
+	android := units[1].Content
+	for _, line := range []string{
+		"Requires=reddock-binder.service\n",
+		"After=network-online.target reddock-binder.service docker.service\n",
+		"ExecStart=/usr/local/bin/reddock start android\n",
+		"ExecStop=/usr/local/bin/reddock stop android\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(android, line) {
+			t.Errorf("android unit lacks %q:\n%s", line, android)
+		}
+	}
+	if strings.Contains(units[2].Content, "binder") {
+		t.Errorf("remote unit should not depend on binder:\n%s", units[2].Content)
+	}
+}
+
+func TestSystemdUnitsPinConfigPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	store := &config.FileStore{Path: path}
+	cfg := config.GetDefault()
+	cfg.AddContainer(testContainer(t, "android"))
+	if err := store.Save(cfg); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	t.Setenv("HOME", "/home/someone")
+
+	units, err := NewSystemdGeneratorWith(store, newFakeRuntime(), "/usr/bin/reddock").Units([]string{"android"})
+	if err != nil {
+		t.Fatalf("Units: %v", err)
+	}
+	unit := units[len(units)-1].Content
+	if !strings.Contains(unit, "Environment=\"REDDOCK_CONFIG="+path+"\"\n") {
+		t.Errorf("unit does not pin the config path %s:\n%s", path, unit)
+	}
+	if strings.Contains(unit, "HOME") {
+		t.Errorf("unit should not copy $HOME:\n%s", unit)
+	}
+}
+
+func TestSystemdUnitsRemoteOnly(t *testing.T) {
+	remote := testContainer(t, "farm")
+	remote.Host = "ssh://ci@builder"
+	gen := NewSystemdGeneratorWith(newMemStore(remote), newFakeRuntime(), "/usr/bin/reddock")
+
+	units, err := gen.Units([]string{"farm"})
+	if err != nil {
+		t.Fatalf("Units: %v", err)
+	}
+	if len(units) != 1 || units[0].Name != "reddock-farm.service" {
+		t.Fatalf("units = %+v, want only the farm service", units)
+	}
+}
+
+func TestSystemdUnitsUnknownContainer(t *testing.T) {
+	gen := NewSystemdGeneratorWith(newMemStore(), newFakeRuntime(), "/usr/bin/reddock")
+	if _, err := gen.Units([]string{"missing"}); !errors.Is(err, ErrContainerNotFound) {
+		t.Fatalf("Units error = %v, want not found", err)
+	}
+}
+
+func TestSystemdWrite(t *testing.T) {
+	gen := NewSystemdGeneratorWith(newMemStore(testContainer(t, "android")), newFakeRuntime(), "/usr/bin/reddock")
+	units, err := gen.Units([]string{"android"})
+	if err != nil {
+		t.Fatalf("Units: %v", err)
+	}
+	dir := t.TempDir()
+	paths, err := gen.Write(units, dir)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("paths = %v, want binder and container units", paths)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "reddock-android.service"))
+	if err != nil || !strings.Contains(string(data), "ExecStart=/usr/bin/reddock start android") {
+		t.Fatalf("unit not written: %v\n%s", err, data)
+	}
+}
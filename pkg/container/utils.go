@@ -1,13 +1,34 @@
 package container
 
 import (
+	"context"
 	"fmt"
 	"os"
+
+	"reddock/pkg/config"
 )
 
+var requireRoot = CheckRoot
+
 func CheckRoot() error {
-	if os.Getuid() != 0 {
-		return fmt.Errorf("This program must be run as root (use sudo or enter as root)")
+	if os.Getuid() == 0 {
+		return nil
+	}
+	return checkRootless(NewRuntime())
+}
+
+// checkRootless lets a regular user through only for rootless podman
+func checkRootless(runtime Runtime) error {
+	if isRootlessPodman(runtime) && RootlessSupported() {
+		return nil
+	}
+	return fmt.Errorf("This program must be run as root (use sudo or enter as root), or use rootless podman with --runtime podman")
+}
+
+// WithTimeout bounds ctx by the configured timeout for an operation
+func WithTimeout(ctx context.Context, cfg *config.Config, op string) (context.Context, context.CancelFunc) {
+	if d := cfg.Timeout(op); d > 0 {
+		return context.WithTimeout(ctx, d)
 	}
-	return nil
+	return context.WithCancel(ctx)
 }
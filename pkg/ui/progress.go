@@ -7,6 +7,14 @@ import (
 	"time"
 )
 
+// quiet silences every spinner and progress bar
+var quiet bool
+
+// SetQuiet turns spinners off for commands that run several operations at once
+func SetQuiet(q bool) {
+	quiet = q
+}
+
 // Progress handles displaying progress bars and spinners
 type Progress struct {
 	message    string
@@ -42,6 +50,9 @@ func NewSpinner(message string) *Progress {
 
 // Start begins the progress display
 func (p *Progress) Start() {
+	if quiet {
+		return
+	}
 	if p.isSpinner {
 		go p.spin()
 	} else {
@@ -95,7 +106,7 @@ func (p *Progress) SetMessage(msg string) {
 }
 
 func (p *Progress) render() {
-	if p.isFinished {
+	if p.isFinished || quiet {
 		return
 	}
 	width := 40
@@ -120,6 +131,11 @@ func (p *Progress) render() {
 func (p *Progress) Finish(finalMsg string) {
 	p.mu.Lock()
 	// No defer unlock here because we might need to print after
+	if quiet {
+		p.isFinished = true
+		p.mu.Unlock()
+		return
+	}
 	p.isFinished = true
 	if p.isSpinner {
 		close(p.stopChan)
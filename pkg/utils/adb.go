@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 
@@ -19,32 +20,29 @@ func NewAdbManager(containerName string) *AdbManager {
 	}
 }
 
-func (a *AdbManager) ShowConnection() error {
+func (a *AdbManager) ShowConnection(ctx context.Context) error {
 	if err := container.CheckRoot(); err != nil {
 		return err
 	}
-	if !a.manager.IsRunning() {
-		return fmt.Errorf("The container '%s' is not running. Start it with 'reddock start %s'", a.containerName, a.containerName)
+	if !a.manager.IsRunning(ctx) {
+		return container.NewError(container.ErrNotRunning, a.containerName,
+			"The container '%s' is not running. Start it with 'reddock start %s'", a.containerName, a.containerName)
 	}
 
-	container := a.manager.GetContainer()
-	port := 5555
-	if container != nil && container.Port != 0 {
-		port = container.Port
-	}
+	address := a.manager.ConnectAddress(ctx)
 
-	ip, _ := a.manager.GetIP()
+	ip, _ := a.manager.GetIP(ctx)
 	if ip == "" {
 		ip = "localhost"
 	}
 
 	fmt.Println("\nADB Information:")
 	fmt.Println("===========================")
-	fmt.Printf("Connection: localhost:%d\n", port)
+	fmt.Printf("Connection: %s\n", address)
 	fmt.Printf("Internal IP: %s\n", ip)
 
 	fmt.Printf("\nAttempting to connect via ADB...\n")
-	cmd := exec.Command("adb", "connect", fmt.Sprintf("localhost:%d", port))
+	cmd := exec.CommandContext(ctx, "adb", "connect", address)
 	output, _ := cmd.CombinedOutput()
 	fmt.Printf("ADB Output: %s", string(output))
 
@@ -52,7 +50,7 @@ func (a *AdbManager) ShowConnection() error {
 	fmt.Printf("  adb shell              # Access Android shell\n")
 	fmt.Printf("  adb install app.apk    # Install APK\n")
 	fmt.Printf("  adb logcat             # View logs\n")
-	fmt.Printf("  scrcpy -s localhost:5555 # Run scrcpy\n")
+	fmt.Printf("  scrcpy -s %s # Run scrcpy\n", address)
 
 	return nil
 }
@@ -1,9 +1,9 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 
 	"reddock/pkg/config"
 	"reddock/pkg/container"
@@ -24,25 +24,28 @@ func NewLogManager(containerName string) *LogManager {
 	return &LogManager{
 		config:        cfg,
 		containerName: containerName,
-		runtime:       container.NewRuntime(),
+		runtime:       container.NewRuntimeForContainer(cfg, cfg.GetContainer(containerName)),
 	}
 }
 
-func (l *LogManager) Show() error {
+func (l *LogManager) Show(ctx context.Context) error {
 	if err := container.CheckRoot(); err != nil {
 		return err
 	}
 	cont := l.config.GetContainer(l.containerName)
 	if cont == nil {
-		return fmt.Errorf("container '%s' not found", l.containerName)
+		return container.NewError(container.ErrContainerNotFound, l.containerName, "container '%s' not found", l.containerName)
 	}
 
 	fmt.Printf("Showing the logs for container: %s\n", l.containerName)
 	fmt.Println("Press Ctrl+C to exit")
 
-	cmd := exec.Command(l.runtime.Name(), "logs", "-f", l.containerName)
+	cmd := l.runtime.Command(ctx, "logs", "-f", l.containerName)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	return cmd.Run()
+	if err := cmd.Run(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
 }
@@ -1,9 +1,9 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 
 	"reddock/pkg/container"
 )
@@ -20,17 +20,18 @@ func NewShellManager(containerName string) *ShellManager {
 	}
 }
 
-func (s *ShellManager) Enter() error {
+func (s *ShellManager) Enter(ctx context.Context) error {
 	if err := container.CheckRoot(); err != nil {
 		return err
 	}
-	if !s.manager.IsRunning() {
-		return fmt.Errorf("The container '%s' is not running. Start it with 'reddock start %s'", s.containerName, s.containerName)
+	if !s.manager.IsRunning(ctx) {
+		return container.NewError(container.ErrNotRunning, s.containerName,
+			"The container '%s' is not running. Start it with 'reddock start %s'", s.containerName, s.containerName)
 	}
 
 	fmt.Printf("Entering container shell for '%s'...\n", s.containerName)
 
-	cmd := exec.Command("docker", "exec", "-it", s.containerName, "sh")
+	cmd := s.manager.Runtime().Command(ctx, "exec", "-it", s.containerName, "sh")
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
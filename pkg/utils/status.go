@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"reddock/pkg/config"
 	"reddock/pkg/container"
@@ -11,54 +15,71 @@ type StatusManager struct {
 	manager       *container.Manager
 	config        *config.Config
 	containerName string
+	out           io.Writer
 }
 
 func NewStatusManager(containerName string) *StatusManager {
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Printf("Warning: Failed to load config: %v\n", err)
-		cfg = config.GetDefault()
-	}
+	return NewStatusManagerWith(config.NewFileStore(), containerName, os.Stdout)
+}
+
+func NewStatusManagerWith(store config.Store, containerName string, out io.Writer) *StatusManager {
 	return &StatusManager{
-		manager:       container.NewManagerForContainer(containerName),
-		config:        cfg,
+		manager:       container.NewManagerWith(store, nil, containerName),
+		config:        config.LoadOrDefault(store),
 		containerName: containerName,
+		out:           out,
 	}
 }
 
-func (s *StatusManager) Show() error {
+func (s *StatusManager) Show(ctx context.Context) error {
 	cont := s.config.GetContainer(s.containerName)
 	if cont == nil {
-		return fmt.Errorf("Container '%s' not found", s.containerName)
+		return container.NewError(container.ErrContainerNotFound, s.containerName, "Container '%s' not found", s.containerName)
 	}
 
-	fmt.Println("Reddock Status")
-	fmt.Println("==============")
+	fmt.Fprintln(s.out, "Reddock Status")
+	fmt.Fprintln(s.out, "==============")
 
-	fmt.Printf("\nContainer: %s\n", cont.Name)
-	fmt.Printf("Image: %s\n", cont.ImageURL)
-	fmt.Printf("Data Path: %s\n", cont.GetDataPath())
-	fmt.Printf("GPU Mode: %s\n", cont.GPUMode)
-	fmt.Printf("Initiated: %v\n", cont.Initialized)
+	fmt.Fprintf(s.out, "\nContainer: %s\n", cont.Name)
+	fmt.Fprintf(s.out, "Image: %s\n", cont.ImageURL)
+	fmt.Fprintf(s.out, "Data Path: %s\n", cont.GetDataPath())
+	fmt.Fprintf(s.out, "GPU Mode: %s\n", cont.GPUMode)
+	fmt.Fprintf(s.out, "Boot Args: %s\n", strings.Join(cont.BootArgs(), " "))
+	fmt.Fprintf(s.out, "Runtime: %s\n", s.manager.Runtime().Name())
+	if cont.Host != "" {
+		fmt.Fprintf(s.out, "Host: %s\n", cont.Host)
+	}
+	fmt.Fprintf(s.out, "Network: %s\n", container.NetworkLabel(cont))
+	if len(cont.Publish) > 0 && cont.PublishesPorts() {
+		fmt.Fprintf(s.out, "Published Ports: %s\n", strings.Join(cont.Publish, ", "))
+	}
+	fmt.Fprintf(s.out, "Initiated: %v\n", cont.Initialized)
 
 	if !cont.Initialized {
-		fmt.Printf("\nThe container is not initiated. Run 'reddock init %s' first.\n", cont.Name)
+		fmt.Fprintf(s.out, "\nThe container is not initiated. Run 'reddock init %s' first.\n", cont.Name)
 		return nil
 	}
 
-	if s.manager.IsRunning() {
-		fmt.Println("\nThe container is RUNNING")
+	if info, err := s.manager.Runtime().InspectContainer(ctx, s.containerName); err == nil && info.Paused {
+		fmt.Fprintln(s.out, "\nThe container is PAUSED")
+		fmt.Fprintf(s.out, "\nResume with: reddock resume %s\n", cont.Name)
+	} else if s.manager.IsRunning(ctx) {
+		fmt.Fprintln(s.out, "\nThe container is RUNNING")
 
-		ip, _ := s.manager.GetIP()
-		fmt.Printf("\nADB Connection:\n")
-		fmt.Printf("  adb connect localhost:5555  (via mapped port)\n")
-		fmt.Printf("  Internal IP: %s\n", ip)
+		ip, _ := s.manager.GetIP(ctx)
+		fmt.Fprintf(s.out, "\nADB Connection:\n")
+		if cont.PublishesPorts() {
+			fmt.Fprintf(s.out, "  adb connect %s  (via mapped port)\n", s.manager.ConnectAddress(ctx))
+		} else {
+			fmt.Fprintf(s.out, "  adb connect %s\n", s.manager.ConnectAddress(ctx))
+		}
+		fmt.Fprintf(s.out, "  Internal IP: %s\n", ip)
 
-		fmt.Printf("\nDirect Shell Access:\n")
-		fmt.Printf("  reddock shell %s\n", cont.Name)
+		fmt.Fprintf(s.out, "\nDirect Shell Access:\n")
+		fmt.Fprintf(s.out, "  reddock shell %s\n", cont.Name)
 	} else {
-		fmt.Println("\nThe container is STOPPED")
-		fmt.Printf("\nStart with: reddock start %s\n", cont.Name)
+		fmt.Fprintln(s.out, "\nThe container is STOPPED")
+		fmt.Fprintf(s.out, "\nStart with: reddock start %s\n", cont.Name)
 	}
 
 	return nil